@@ -1,169 +1,198 @@
 package config
 
 import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ppreeper/oda/ui"
 	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
 )
 
 const OdooBaseURL = "https://github.com/odoo"
 
+// Branch is an odoo version oda can build a base instance for
 type Branch struct {
-	Name             string   `json:"name"`
-	Version          string   `json:"version"`
-	Image            string   `json:"image"`
-	InstanceName     string   `json:"instance_name"`
-	Repos            []string `json:"repos"`
-	BaselinePackages []string `json:"baseline_packages"`
-	Odoobase         []string `json:"odoobase"`
+	Name             string   `json:"name" yaml:"name"`
+	Version          string   `json:"version" yaml:"version"`
+	Image            string   `json:"image" yaml:"image"`
+	InstanceName     string   `json:"instance_name" yaml:"instance_name"`
+	Repos            []string `json:"repos" yaml:"repos"`
+	BaselinePackages []string `json:"baseline_packages" yaml:"baseline_packages"`
+	// Odoobase are the python and system packages odoo depends on
+	Odoobase []string `json:"odoobase" yaml:"odoobase"`
+	// Source is the file the branch was defined in
+	Source string `json:"-" yaml:"-"`
 }
 
+// BranchesEmbedded is the source of the branches built into oda
+const BranchesEmbedded = "embedded"
+
+//go:embed branches.yaml
+var defaultBranches []byte
+
+type branchFile struct {
+	Branches []*Branch `yaml:"branches"`
+}
+
+// BranchesFile is the branches.yaml next to oda.yaml that overrides and
+// extends the embedded branches
+func BranchesFile() (string, error) {
+	odaFile, err := OdaConfigFile()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(odaFile), "branches.yaml"), nil
+}
+
+// LoadBranches reads the embedded branches and lays the user branches.yaml
+// over them, a user branch replaces the embedded one of the same version
+func LoadBranches() ([]*Branch, error) {
+	branches, err := parseBranches(defaultBranches, BranchesEmbedded)
+	if err != nil {
+		return nil, err
+	}
+	branchesFile, err := BranchesFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(branchesFile)
+	if os.IsNotExist(err) {
+		return branches, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", branchesFile, err)
+	}
+	userBranches, err := parseBranches(data, branchesFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, userBranch := range userBranches {
+		idx := slices.IndexFunc(branches, func(b *Branch) bool { return b.Version == userBranch.Version })
+		if idx == -1 {
+			branches = append(branches, userBranch)
+			continue
+		}
+		branches[idx] = userBranch
+	}
+	if err := validateBranches(branches); err != nil {
+		return nil, fmt.Errorf("%s: %w", branchesFile, err)
+	}
+	return branches, nil
+}
+
+func parseBranches(data []byte, source string) ([]*Branch, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	file := branchFile{}
+	if err := dec.Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not unmarshal %s: %w", source, err)
+	}
+	for _, branch := range file.Branches {
+		if branch == nil {
+			return nil, fmt.Errorf("%s: empty branch", source)
+		}
+		branch.Source = source
+	}
+	if err := validateBranches(file.Branches); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return file.Branches, nil
+}
+
+// validateBranches checks the fields oda needs and that names and
+// versions are unique
+func validateBranches(branches []*Branch) error {
+	names := map[string]bool{}
+	versions := map[string]bool{}
+	for i, branch := range branches {
+		switch {
+		case branch.Name == "":
+			return fmt.Errorf("branch %d has no name", i+1)
+		case branch.Version == "":
+			return fmt.Errorf("branch %s has no version", branch.Name)
+		case branch.Image == "":
+			return fmt.Errorf("branch %s has no image", branch.Name)
+		case branch.InstanceName == "":
+			return fmt.Errorf("branch %s has no instance_name", branch.Name)
+		case !slices.Contains(branch.Repos, "odoo"):
+			return fmt.Errorf("branch %s repos must include odoo", branch.Name)
+		case names[branch.Name]:
+			return fmt.Errorf("branch name %s is defined twice", branch.Name)
+		case versions[branch.Version]:
+			return fmt.Errorf("branch version %s is defined twice", branch.Version)
+		}
+		if _, err := parseVersion(branch.Version); err != nil {
+			return fmt.Errorf("branch %s: %w", branch.Name, err)
+		}
+		if strings.ContainsAny(branch.InstanceName, " ./") {
+			return fmt.Errorf("branch %s: invalid instance_name %s", branch.Name, branch.InstanceName)
+		}
+		names[branch.Name] = true
+		versions[branch.Version] = true
+	}
+	return nil
+}
+
+// branchCache holds the branches GetBranches loaded for a branches.yaml
+var branchCache struct {
+	sync.Mutex
+	file     string
+	branches []*Branch
+}
+
+// GetBranches lists the branches, loaded once for the branches.yaml in
+// use, a broken branches.yaml is reported and the embedded branches are
+// used instead
 func GetBranches() []*Branch {
-	return []*Branch{
-		{
-			Name:         "15.0",
-			Version:      "15.0",
-			Image:        "ubuntu/22.04",
-			InstanceName: "odoo-15-0",
-			Repos:        []string{"odoo", "enterprise", "design-themes"},
-			BaselinePackages: []string{
-				"apt-transport-https", "apt-utils", "bzip2", "ca-certificates", "curl",
-				"dirmngr", "git", "gnupg", "inetutils-ping", "libgnutls-dane0", "libgts-bin",
-				"libpaper-utils", "locales", "lsb-release", "nodejs", "npm", "odaserver",
-				"openssh-server", "postgresql-common", "python3", "python3-full",
-				"shared-mime-info", "sudo", "unzip", "vim", "wget", "xz-utils", "zip", "zstd",
-			},
-			Odoobase: []string{
-				"fonts-liberation", "fonts-noto", "fonts-noto-cjk", "fonts-noto-mono",
-				"geoip-database", "gsfonts", "python3-babel", "python3-chardet",
-				"python3-cryptography", "python3-cups", "python3-dateutil",
-				"python3-decorator", "python3-docutils", "python3-feedparser",
-				"python3-freezegun", "python3-geoip2", "python3-gevent", "python3-googleapi",
-				"python3-greenlet", "python3-html2text", "python3-idna", "python3-jinja2",
-				"python3-ldap", "python3-libsass", "python3-lxml", "python3-markupsafe",
-				"python3-num2words", "python3-odf", "python3-ofxparse", "python3-olefile",
-				"python3-openssl", "python3-paramiko", "python3-passlib", "python3-pdfminer",
-				"python3-phonenumbers", "python3-pil", "python3-pip", "python3-polib",
-				"python3-psutil", "python3-psycopg2", "python3-pydot", "python3-pylibdmtx",
-				"python3-pyparsing", "python3-pypdf2", "python3-qrcode", "python3-renderpm",
-				"python3-reportlab", "python3-reportlab-accel", "python3-requests",
-				"python3-rjsmin", "python3-serial", "python3-setuptools", "python3-stdnum",
-				"python3-tz", "python3-urllib3", "python3-usb", "python3-vobject",
-				"python3-werkzeug", "python3-xlrd", "python3-xlsxwriter", "python3-xlwt",
-				"python3-zeep",
-			},
-		},
-		{
-			Name:         "16.0",
-			Version:      "16.0",
-			Image:        "ubuntu/22.04",
-			InstanceName: "odoo-16-0",
-			Repos:        []string{"odoo", "enterprise", "design-themes", "industry"},
-			BaselinePackages: []string{
-				"apt-transport-https", "apt-utils", "bzip2", "ca-certificates", "curl",
-				"dirmngr", "git", "gnupg", "inetutils-ping", "libgnutls-dane0", "libgts-bin",
-				"libpaper-utils", "locales", "lsb-release", "nodejs", "npm", "odaserver",
-				"openssh-server", "postgresql-common", "python3", "python3-full",
-				"shared-mime-info", "sudo", "unzip", "vim", "wget", "xz-utils", "zip", "zstd",
-			},
-			Odoobase: []string{
-				"fonts-liberation", "fonts-noto", "fonts-noto-cjk", "fonts-noto-mono",
-				"geoip-database", "gsfonts", "python3-babel", "python3-chardet",
-				"python3-cryptography", "python3-cups", "python3-dateutil",
-				"python3-decorator", "python3-docutils", "python3-feedparser",
-				"python3-freezegun", "python3-geoip2", "python3-gevent", "python3-googleapi",
-				"python3-greenlet", "python3-html2text", "python3-idna", "python3-jinja2",
-				"python3-ldap", "python3-libsass", "python3-lxml", "python3-markupsafe",
-				"python3-num2words", "python3-odf", "python3-ofxparse", "python3-olefile",
-				"python3-openssl", "python3-paramiko", "python3-passlib", "python3-pdfminer",
-				"python3-phonenumbers", "python3-pil", "python3-pip", "python3-polib",
-				"python3-psutil", "python3-psycopg2", "python3-pydot", "python3-pylibdmtx",
-				"python3-pyparsing", "python3-pypdf2", "python3-qrcode", "python3-renderpm",
-				"python3-reportlab", "python3-reportlab-accel", "python3-requests",
-				"python3-rjsmin", "python3-serial", "python3-setuptools", "python3-stdnum",
-				"python3-tz", "python3-urllib3", "python3-usb", "python3-vobject",
-				"python3-werkzeug", "python3-xlrd", "python3-xlsxwriter", "python3-xlwt",
-				"python3-zeep",
-			},
-		},
-		{
-			Name:         "17.0",
-			Version:      "17.0",
-			Image:        "ubuntu/22.04",
-			InstanceName: "odoo-17-0",
-			Repos:        []string{"odoo", "enterprise", "design-themes", "industry"},
-			BaselinePackages: []string{
-				"apt-transport-https", "apt-utils", "bzip2", "ca-certificates", "curl",
-				"dirmngr", "git", "gnupg", "inetutils-ping", "libgnutls-dane0", "libgts-bin",
-				"libpaper-utils", "locales", "lsb-release", "nodejs", "npm", "odaserver",
-				"openssh-server", "postgresql-common", "python3", "python3-full",
-				"shared-mime-info", "sudo", "unzip", "vim", "wget", "xz-utils", "zip", "zstd",
-			},
-			Odoobase: []string{
-				"fonts-liberation", "fonts-noto", "fonts-noto-cjk", "fonts-noto-mono",
-				"geoip-database", "gsfonts", "python3-babel", "python3-chardet",
-				"python3-cryptography", "python3-cups", "python3-dateutil",
-				"python3-decorator", "python3-docutils", "python3-feedparser",
-				"python3-freezegun", "python3-geoip2", "python3-gevent", "python3-googleapi",
-				"python3-greenlet", "python3-html2text", "python3-idna", "python3-jinja2",
-				"python3-ldap", "python3-libsass", "python3-lxml", "python3-markupsafe",
-				"python3-num2words", "python3-odf", "python3-ofxparse", "python3-olefile",
-				"python3-openssl", "python3-paramiko", "python3-passlib", "python3-pdfminer",
-				"python3-phonenumbers", "python3-pil", "python3-pip", "python3-polib",
-				"python3-psutil", "python3-psycopg2", "python3-pydot", "python3-pylibdmtx",
-				"python3-pyparsing", "python3-pypdf2", "python3-qrcode", "python3-renderpm",
-				"python3-reportlab", "python3-reportlab-accel", "python3-requests",
-				"python3-rjsmin", "python3-serial", "python3-setuptools", "python3-stdnum",
-				"python3-tz", "python3-urllib3", "python3-usb", "python3-vobject",
-				"python3-werkzeug", "python3-xlrd", "python3-xlsxwriter", "python3-xlwt",
-				"python3-zeep",
-			},
-		},
-		{
-			Name:             "saas-17.2",
-			Version:          "17.2",
-			Image:            "ubuntu/22.04",
-			InstanceName:     "odoo-17-0",
-			Repos:            []string{"odoo", "enterprise", "design-themes", "industry"},
-			BaselinePackages: []string{},
-			Odoobase:         []string{},
-		},
-		{
-			Name:         "18.0",
-			Version:      "18.0",
-			Image:        "ubuntu/24.04",
-			InstanceName: "odoo-18-0",
-			Repos:        []string{"odoo", "enterprise", "design-themes", "industry"},
-			BaselinePackages: []string{
-				"apt-transport-https", "apt-utils", "bzip2", "ca-certificates", "curl",
-				"dirmngr", "git", "gnupg", "inetutils-ping", "libgnutls-dane0", "libgts-bin",
-				"libpaper-utils", "locales", "lsb-release", "nodejs", "npm", "odaserver",
-				"openssh-server", "postgresql-common", "python3", "python3-full",
-				"shared-mime-info", "sudo", "unzip", "vim", "wget", "xz-utils", "zip", "zstd",
-			},
-			Odoobase: []string{
-				"fonts-liberation", "fonts-noto", "fonts-noto-cjk", "fonts-noto-mono",
-				"geoip-database", "gsfonts", "python3-asn1crypto", "python3-babel",
-				"python3-cbor2", "python3-chardet", "python3-cryptography", "python3-cups",
-				"python3-dateutil", "python3-decorator", "python3-docutils",
-				"python3-feedparser", "python3-freezegun", "python3-geoip2",
-				"python3-gevent", "python3-googleapi", "python3-greenlet",
-				"python3-html2text", "python3-idna", "python3-jinja2", "python3-ldap",
-				"python3-libsass", "python3-lxml", "python3-lxml-html-clean",
-				"python3-markupsafe", "python3-num2words", "python3-odf", "python3-ofxparse",
-				"python3-olefile", "python3-openpyxl", "python3-openssl", "python3-paramiko",
-				"python3-passlib", "python3-pdfminer", "python3-phonenumbers", "python3-pil",
-				"python3-pip", "python3-polib", "python3-psutil", "python3-psycopg2",
-				"python3-pydot", "python3-pylibdmtx", "python3-pyparsing", "python3-pypdf2",
-				"python3-qrcode", "python3-renderpm", "python3-reportlab",
-				"python3-rl-renderpm", "python3-reportlab-accel", "python3-requests",
-				"python3-rjsmin", "python3-serial", "python3-setuptools", "python3-stdnum",
-				"python3-tz", "python3-urllib3", "python3-usb", "python3-vobject",
-				"python3-werkzeug", "python3-xlrd", "python3-xlsxwriter", "python3-xlwt",
-				"python3-zeep",
-			},
-		},
+	branchesFile, _ := BranchesFile()
+	branchCache.Lock()
+	defer branchCache.Unlock()
+	if branchCache.branches != nil && branchCache.file == branchesFile {
+		return branchCache.branches
+	}
+	branches, err := LoadBranches()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("invalid branches, using the embedded ones:", err.Error()))
+		branches, _ = parseBranches(defaultBranches, BranchesEmbedded)
+	}
+	branchCache.file, branchCache.branches = branchesFile, branches
+	return branches
+}
+
+// VMSuffix marks base instances and images built as virtual machines
+const VMSuffix = "-vm"
+
+// BaseInstanceName is the base instance of the instance type,
+// odoo-17-0 for containers and odoo-17-0-vm for virtual machines
+func (b *Branch) BaseInstanceName(instanceType string) string {
+	if instanceType == InstanceTypeVM {
+		return b.InstanceName + VMSuffix
+	}
+	return b.InstanceName
+}
+
+// ImageAlias is the alias the base instance is published under,
+// odoo-17-0 becomes oda/odoo-17.0 and odoo-17-0-vm becomes oda/odoo-17.0-vm
+func (b *Branch) ImageAlias(instanceType string) string {
+	name := b.InstanceName
+	if idx := strings.LastIndex(name, "-"); idx != -1 {
+		name = name[:idx] + "." + name[idx+1:]
+	}
+	if instanceType == InstanceTypeVM {
+		name += VMSuffix
 	}
+	return "oda/" + name
 }
 
+// GetVersion is the branch of version, nil when there is none
 func GetVersion(version string) *Branch {
 	for _, branch := range GetBranches() {
 		if branch.Version == version {
@@ -173,11 +202,36 @@ func GetVersion(version string) *Branch {
 	return nil
 }
 
+// GetBranchLatest is the branch with the highest version
 func GetBranchLatest() *Branch {
-	branchVersions := []string{}
+	var latest *Branch
+	var latestVersion [2]int
 	for _, branch := range GetBranches() {
-		branchVersions = append(branchVersions, branch.Version)
+		version, err := parseVersion(branch.Version)
+		if err != nil {
+			continue
+		}
+		if latest == nil || version[0] > latestVersion[0] ||
+			(version[0] == latestVersion[0] && version[1] > latestVersion[1]) {
+			latest, latestVersion = branch, version
+		}
+	}
+	return latest
+}
+
+// parseVersion splits a major.minor version like 17.0 or 17.2
+func parseVersion(version string) ([2]int, error) {
+	major, minor, ok := strings.Cut(version, ".")
+	if !ok {
+		return [2]int{}, fmt.Errorf("invalid version %s, use major.minor", version)
+	}
+	majorN, err := strconv.Atoi(major)
+	if err != nil {
+		return [2]int{}, fmt.Errorf("invalid version %s, use major.minor", version)
+	}
+	minorN, err := strconv.Atoi(minor)
+	if err != nil {
+		return [2]int{}, fmt.Errorf("invalid version %s, use major.minor", version)
 	}
-	branchVersionMax := slices.Max(branchVersions)
-	return GetVersion(branchVersionMax)
+	return [2]int{majorN, minorN}, nil
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useBranchesFile writes the user branches.yaml next to a test oda.yaml
+func useBranchesFile(t *testing.T, content string) string {
+	t.Helper()
+	odaFile := useConfigFile(t, "dirs:\n  project: /srv/odoo\n")
+	file := filepath.Join(filepath.Dir(odaFile), "branches.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadBranchesEmbedded(t *testing.T) {
+	useConfigFile(t, "dirs:\n  project: /srv/odoo\n")
+
+	branches, err := LoadBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []string{}
+	for _, branch := range branches {
+		versions = append(versions, branch.Version)
+		if branch.Source != BranchesEmbedded {
+			t.Errorf("%s source %s", branch.Name, branch.Source)
+		}
+	}
+	if got := strings.Join(versions, " "); got != "15.0 16.0 17.0 17.2 18.0" {
+		t.Errorf("versions %s", got)
+	}
+	if branch := GetVersion("16.0"); len(branch.BaselinePackages) == 0 || len(branch.Odoobase) == 0 {
+		t.Error("16.0 lost the shared package lists")
+	}
+	if got := GetBranchLatest().Version; got != "18.0" {
+		t.Errorf("latest %s, want 18.0", got)
+	}
+}
+
+func TestLoadBranchesUserFile(t *testing.T) {
+	file := useBranchesFile(t, `branches:
+  - name: "17.0"
+    version: "17.0"
+    image: ubuntu/24.04
+    instance_name: odoo-17-0
+    repos: [odoo]
+  - name: "saas-18.2"
+    version: "18.2"
+    image: ubuntu/24.04
+    instance_name: odoo-18-2
+    repos: [odoo, enterprise]
+`)
+
+	branch := GetVersion("17.0")
+	if branch.Image != "ubuntu/24.04" || branch.Source != file || len(branch.Repos) != 1 {
+		t.Errorf("17.0 not replaced %+v", branch)
+	}
+	if GetVersion("16.0").Source != BranchesEmbedded {
+		t.Error("16.0 not kept")
+	}
+	if got := GetBranchLatest().Name; got != "saas-18.2" {
+		t.Errorf("latest %s, want saas-18.2", got)
+	}
+}
+
+func TestLoadBranchesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown field", "branches:\n  - name: x\n    verison: \"19.0\"\n", "field verison not found"},
+		{"no image", "branches:\n  - name: x\n    version: \"19.0\"\n    instance_name: odoo-19-0\n    repos: [odoo]\n", "branch x has no image"},
+		{"no odoo repo", "branches:\n  - name: x\n    version: \"19.0\"\n    image: ubuntu/24.04\n    instance_name: odoo-19-0\n    repos: [enterprise]\n", "repos must include odoo"},
+		{"bad version", "branches:\n  - name: x\n    version: master\n    image: ubuntu/24.04\n    instance_name: odoo-master\n    repos: [odoo]\n", "invalid version master"},
+		{"name clash", "branches:\n  - name: \"17.0\"\n    version: \"19.0\"\n    image: ubuntu/24.04\n    instance_name: odoo-19-0\n    repos: [odoo]\n", "branch name 17.0 is defined twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBranchesFile(t, tt.content)
+			if _, err := LoadBranches(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %v, want %q", err, tt.want)
+			}
+			// commands keep working with the embedded branches
+			if branch := GetVersion("17.0"); branch == nil || branch.Source != BranchesEmbedded {
+				t.Errorf("17.0 fallback %+v", branch)
+			}
+		})
+	}
+}
+
+func TestGetBranchesLoadsOnce(t *testing.T) {
+	file := useBranchesFile(t, "branches:\n")
+	if GetVersion("17.0") == nil {
+		t.Fatal("no 17.0 branch")
+	}
+	if err := os.WriteFile(file, []byte("branches:\n  - name: x\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if branch := GetVersion("17.0"); branch == nil || branch.Source != BranchesEmbedded {
+		t.Errorf("branches loaded again %+v", branch)
+	}
+}
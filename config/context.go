@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultContext names the base settings of oda.yaml, used when no
+// context is selected
+const DefaultContext = "default"
+
+// contextName overrides current_context, set from --context
+var contextName string
+
+// SetContext makes oda load the named context instead of current_context
+func SetContext(name string) {
+	contextName = name
+}
+
+// OdaContext holds the settings a context changes, by section and key,
+// everything else comes from the base settings
+type OdaContext map[string]map[string]any
+
+// ActiveContext is the context the config loads, --context wins over
+// current_context and an empty name is the base settings
+func (c *OdaConf) ActiveContext() string {
+	name := c.CurrentContext
+	if contextName != "" {
+		name = contextName
+	}
+	if name == DefaultContext {
+		return ""
+	}
+	return name
+}
+
+// ContextNames lists the contexts in oda.yaml sorted by name
+func (c *OdaConf) ContextNames() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyContext lays the active context over the base settings and records
+// the context as the source of the settings it changes
+func applyContext(c *OdaConf, sources map[string]string) error {
+	name := c.ActiveContext()
+	if name == "" {
+		return nil
+	}
+	ctx, ok := c.Contexts[name]
+	if !ok {
+		return fmt.Errorf("context %s not found, use oda context list", name)
+	}
+	ctxOut, err := yaml.Marshal(ctx)
+	if err != nil {
+		return fmt.Errorf("could not marshal context %s: %w", name, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(ctxOut))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("invalid context %s: %w", name, err)
+	}
+	for _, key := range ctx.Keys() {
+		sources[key] = "context " + name
+	}
+	return nil
+}
+
+// Keys lists the settings the context changes
+func (ctx OdaContext) Keys() []string {
+	var keys []string
+	for section, settings := range ctx {
+		for key := range settings {
+			keys = append(keys, section+"."+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set changes the setting key, given as section.key, in the context, the
+// value is parsed as the type of the setting
+func (ctx OdaContext) Set(key, value string) error {
+	section, name, ok := strings.Cut(key, ".")
+	if !ok {
+		return fmt.Errorf("invalid setting %s, use section.key", key)
+	}
+	var kind reflect.Kind
+	eachSetting(reflect.ValueOf(&OdaConf{}).Elem(), "", func(k string, field reflect.Value) {
+		if k == key {
+			kind = field.Kind()
+		}
+	})
+
+	var val any
+	switch kind {
+	case reflect.String:
+		val = value
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		val = n
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		val = b
+	default:
+		return fmt.Errorf("unknown setting %s, see oda config show", key)
+	}
+	if ctx[section] == nil {
+		ctx[section] = map[string]any{}
+	}
+	ctx[section][name] = val
+	return nil
+}
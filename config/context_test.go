@@ -0,0 +1,125 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const contextsYAML = `database:
+  host: db
+  port: 5432
+dirs:
+  project: /srv/odoo
+incus:
+  type: unix
+current_context: build
+contexts:
+  build:
+    database:
+      host: pg
+    incus:
+      type: https
+      limit_cpu: 8
+  ci:
+    dirs:
+      project: /ci/odoo
+`
+
+func TestLoadOdaConfigContext(t *testing.T) {
+	file := useConfigFile(t, contextsYAML)
+
+	odaConf, sources, err := LoadOdaConfigSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odaConf.Database.Host != "pg" || odaConf.Database.Port != 5432 || odaConf.Incus.Type != "https" ||
+		odaConf.Incus.LimitCPU != 8 || odaConf.Dirs.Project != "/srv/odoo" {
+		t.Errorf("build context config %+v", odaConf)
+	}
+	for key, want := range map[string]string{
+		"database.host":   "context build",
+		"database.port":   file,
+		"incus.limit_cpu": "context build",
+	} {
+		if sources[key] != want {
+			t.Errorf("source of %s = %q, want %q", key, sources[key], want)
+		}
+	}
+
+	// the environment still wins over the context
+	t.Setenv("ODA_DATABASE_HOST", "envdb")
+	if odaConf, _ = LoadOdaConfig(); odaConf.Database.Host != "envdb" {
+		t.Errorf("host %s, want envdb", odaConf.Database.Host)
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	useConfigFile(t, contextsYAML)
+	t.Cleanup(func() { SetContext("") })
+
+	SetContext("ci")
+	odaConf, err := LoadOdaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odaConf.Database.Host != "db" || odaConf.Dirs.Project != "/ci/odoo" {
+		t.Errorf("ci context config %+v", odaConf)
+	}
+
+	SetContext(DefaultContext)
+	if odaConf, _ = LoadOdaConfig(); odaConf.Database.Host != "db" || odaConf.Incus.Type != "unix" {
+		t.Errorf("default context config %+v", odaConf)
+	}
+
+	SetContext("missing")
+	if _, err := LoadOdaConfig(); err == nil || !strings.Contains(err.Error(), "context missing not found") {
+		t.Errorf("error %v, want context not found", err)
+	}
+
+	// saving starts from the file without the context
+	fileConf, err := LoadOdaConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileConf.Database.Host != "db" || len(fileConf.Contexts) != 2 {
+		t.Errorf("file config %+v", fileConf)
+	}
+}
+
+func TestLoadOdaConfigInvalidContext(t *testing.T) {
+	useConfigFile(t, "current_context: bad\ncontexts:\n  bad:\n    database:\n      hots: pg\n")
+
+	if _, err := LoadOdaConfig(); err == nil || !strings.Contains(err.Error(), "invalid context bad") {
+		t.Errorf("error %v, want invalid context", err)
+	}
+}
+
+func TestOdaContextSet(t *testing.T) {
+	ctx := OdaContext{}
+	for _, kv := range [][2]string{
+		{"database.host", "pg"},
+		{"database.port", "5433"},
+		{"system.ipv6", "true"},
+	} {
+		if err := ctx.Set(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ctx["database"]["host"] != "pg" || ctx["database"]["port"] != 5433 || ctx["system"]["ipv6"] != true {
+		t.Errorf("context %v", ctx)
+	}
+	if got := strings.Join(ctx.Keys(), " "); got != "database.host database.port system.ipv6" {
+		t.Errorf("keys %s", got)
+	}
+
+	for _, kv := range [][2]string{
+		{"database.port", "five"},
+		{"database.hots", "pg"},
+		{"database", "pg"},
+		{"current_context", "x"},
+	} {
+		if err := ctx.Set(kv[0], kv[1]); err == nil {
+			t.Errorf("Set(%s, %s) succeeded", kv[0], kv[1])
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// serverNameRe is a valid database server name, it is also the name of
+// the incus instance
+var serverNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// postgresPort is the port the servers oda db create builds listen on
+const postgresPort = 5432
+
+// DatabaseServers are the database servers, the default server first,
+// settings the others leave unset are those of the default server
+func (c *OdaConf) DatabaseServers() []OdaDatabase {
+	def := c.Database
+	if def.Name == "" {
+		def.Name = def.Host
+	}
+	servers := []OdaDatabase{def}
+	for _, db := range c.Databases {
+		if db.Host == "" {
+			db.Host = db.Name
+		}
+		if db.Port == 0 {
+			db.Port = def.Port
+		}
+		if db.Username == "" {
+			db.Username = def.Username
+		}
+		if db.Password == "" {
+			db.Password = def.Password
+		}
+		if db.Version == 0 {
+			db.Version = def.Version
+		}
+		if db.Image == "" {
+			db.Image = def.Image
+		}
+		servers = append(servers, db)
+	}
+	return servers
+}
+
+// DatabaseServer is the database server called name, the default server
+// when name is empty
+func (c *OdaConf) DatabaseServer(name string) (OdaDatabase, error) {
+	servers := c.DatabaseServers()
+	if name == "" {
+		return servers[0], nil
+	}
+	for _, db := range servers {
+		if db.Name == name {
+			return db, nil
+		}
+	}
+	return OdaDatabase{}, fmt.Errorf("database server %s not found, use oda db list", name)
+}
+
+// ProjectDatabase is the database server the project picked in .oda.yaml
+func (c *OdaConf) ProjectDatabase(project *OdaProject) (OdaDatabase, error) {
+	if project == nil {
+		return c.DatabaseServer("")
+	}
+	return c.DatabaseServer(project.DBServer)
+}
+
+// NewestDatabaseVersion is the newest postgresql version of the servers,
+// the client of that version works with all of them
+func (c *OdaConf) NewestDatabaseVersion() int {
+	version := 0
+	for _, db := range c.DatabaseServers() {
+		version = max(version, db.Version)
+	}
+	return version
+}
+
+// validateDatabases checks the servers in databases have a valid name,
+// listen on the postgresql port and do not share a name or an instance
+// with another server
+func (c *OdaConf) validateDatabases() error {
+	servers := c.DatabaseServers()
+	names := map[string]bool{servers[0].Name: true}
+	hosts := map[string]bool{servers[0].Host: true}
+	for i, db := range servers[1:] {
+		if c.Databases[i].Name == "" {
+			return fmt.Errorf("databases entry %d has no name", i+1)
+		}
+		if !serverNameRe.MatchString(db.Name) {
+			return fmt.Errorf("invalid database server name %q", db.Name)
+		}
+		if !serverNameRe.MatchString(db.Host) {
+			return fmt.Errorf("invalid host %q of database server %s", db.Host, db.Name)
+		}
+		if c.Databases[i].Port != 0 && c.Databases[i].Port != postgresPort {
+			return fmt.Errorf("database server %s port %d is not supported, its postgresql listens on %d", db.Name, c.Databases[i].Port, postgresPort)
+		}
+		if names[db.Name] {
+			return fmt.Errorf("duplicate database server %s", db.Name)
+		}
+		if hosts[db.Host] {
+			return fmt.Errorf("database server %s shares host %s with another server", db.Name, db.Host)
+		}
+		names[db.Name], hosts[db.Host] = true, true
+	}
+	return nil
+}
+
+// OdooConf are the odoo.conf options that connect odoo to the server
+func (db OdaDatabase) OdooConf() map[string]string {
+	return map[string]string{
+		"db_host":     db.Host,
+		"db_port":     strconv.Itoa(db.Port),
+		"db_user":     db.Username,
+		"db_password": db.Password,
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDatabases = `database:
+  host: db
+  port: 5432
+  username: odoo
+  password: odooodoo
+  version: 17
+  image: debian/12
+databases:
+  - name: pg12
+    version: 12
+    image: debian/11
+  - name: pg16
+    host: pg16-host
+    version: 16
+`
+
+func TestDatabaseServers(t *testing.T) {
+	useConfigFile(t, testDatabases)
+	odaConf, err := LoadOdaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := odaConf.DatabaseServers()
+	want := []OdaDatabase{
+		{Name: "db", Host: "db", Port: 5432, Username: "odoo", Password: "odooodoo", Version: 17, Image: "debian/12"},
+		{Name: "pg12", Host: "pg12", Port: 5432, Username: "odoo", Password: "odooodoo", Version: 12, Image: "debian/11"},
+		{Name: "pg16", Host: "pg16-host", Port: 5432, Username: "odoo", Password: "odooodoo", Version: 16, Image: "debian/12"},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Errorf("servers\n%+v\nwant\n%+v", servers, want)
+	}
+	if v := odaConf.NewestDatabaseVersion(); v != 17 {
+		t.Errorf("newest version %d", v)
+	}
+
+	for name, host := range map[string]string{"": "db", "db": "db", "pg16": "pg16-host"} {
+		if db, err := odaConf.DatabaseServer(name); err != nil || db.Host != host {
+			t.Errorf("server %q = %s, %v", name, db.Host, err)
+		}
+	}
+	if _, err := odaConf.DatabaseServer("pg9"); err == nil {
+		t.Error("found server pg9")
+	}
+	if db, _ := odaConf.ProjectDatabase(&OdaProject{DBServer: "pg12"}); db.Version != 12 {
+		t.Errorf("project server %+v", db)
+	}
+	if db, _ := odaConf.ProjectDatabase(&OdaProject{}); db.Name != "db" {
+		t.Errorf("project default server %+v", db)
+	}
+
+	db, _ := odaConf.DatabaseServer("pg16")
+	if got := db.OdooConf(); !reflect.DeepEqual(got, map[string]string{
+		"db_host": "pg16-host", "db_port": "5432", "db_user": "odoo", "db_password": "odooodoo",
+	}) {
+		t.Errorf("odoo.conf options %v", got)
+	}
+}
+
+func TestDatabaseServersInvalid(t *testing.T) {
+	for content, want := range map[string]string{
+		"databases:\n  - version: 12\n":                                     "has no name",
+		"databases:\n  - name: 12pg\n":                                      "invalid database server name",
+		"databases:\n  - name: pg12\n  - name: pg12\n":                      "duplicate database server",
+		"database:\n  host: db\ndatabases:\n  - name: db\n":                 "duplicate database server",
+		"database:\n  host: db\ndatabases:\n  - name: pg12\n    host: db\n": "shares host db",
+		"databases:\n  - name: pg12\n    host: pg_12\n":                     "invalid host",
+		"database:\n  host: db\ndatabases:\n  - name: a\n  - {}\n":          "entry 2 has no name",
+		"databases:\n  - name: pg12\n    port: 5433\n":                      "port 5433 is not supported",
+	} {
+		useConfigFile(t, content)
+		if _, err := LoadOdaConfig(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: %v, want %s", content, err, want)
+		}
+	}
+}
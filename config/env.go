@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override oda.yaml,
+// database.host is set with ODA_DATABASE_HOST
+const EnvPrefix = "ODA_"
+
+// Setting is one oda.yaml setting and its effective value
+type Setting struct {
+	Key   string
+	Env   string
+	Value string
+}
+
+// EnvName is the environment variable that overrides the setting key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Settings lists every setting of the config in oda.yaml order
+func (c *OdaConf) Settings() []Setting {
+	var settings []Setting
+	eachSetting(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		settings = append(settings, Setting{
+			Key:   key,
+			Env:   EnvName(key),
+			Value: fmt.Sprint(field.Interface()),
+		})
+	})
+	return settings
+}
+
+// eachSetting calls fn with the key and field of every section.key setting
+// in v, top level fields that are not sections are not settings
+func eachSetting(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			eachSetting(field, key, fn)
+		case prefix != "":
+			fn(key, field)
+		}
+	}
+}
+
+// applyEnv sets the settings that have an environment variable and
+// records the variable as their source
+func applyEnv(c *OdaConf, sources map[string]string) error {
+	var err error
+	eachSetting(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		env := EnvName(key)
+		val, ok := os.LookupEnv(env)
+		if !ok || err != nil {
+			return
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(val)
+		case reflect.Int:
+			n, perr := strconv.Atoi(val)
+			if perr != nil {
+				err = fmt.Errorf("invalid %s %q: %w", env, val, perr)
+				return
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, perr := strconv.ParseBool(val)
+			if perr != nil {
+				err = fmt.Errorf("invalid %s %q: %w", env, val, perr)
+				return
+			}
+			field.SetBool(b)
+		default:
+			return
+		}
+		sources[key] = "env " + env
+	})
+	return err
+}
+
+// fileSources marks the settings present in the yaml file as coming from
+// it, the contexts are left to applyContext
+func fileSources(yamlFile []byte, yamlFilename string) (map[string]string, error) {
+	var raw map[string]any
+	if err := yaml.Unmarshal(yamlFile, &raw); err != nil {
+		return nil, fmt.Errorf("could not unmarshal config: %w", err)
+	}
+	sources := map[string]string{}
+	var walk func(m map[string]any, prefix string)
+	walk = func(m map[string]any, prefix string) {
+		for k, v := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			if sub, ok := v.(map[string]any); ok {
+				walk(sub, key)
+				continue
+			}
+			sources[key] = yamlFilename
+		}
+	}
+	for section, v := range raw {
+		if sub, ok := v.(map[string]any); ok && section != "contexts" {
+			walk(sub, section)
+		}
+	}
+	return sources, nil
+}
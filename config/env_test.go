@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "oda.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	SetConfigFile(file)
+	t.Cleanup(func() { SetConfigFile("") })
+	return file
+}
+
+func TestEnvName(t *testing.T) {
+	for key, want := range map[string]string{
+		"database.host":   "ODA_DATABASE_HOST",
+		"dirs.project":    "ODA_DIRS_PROJECT",
+		"incus.limit_cpu": "ODA_INCUS_LIMIT_CPU",
+	} {
+		if got := EnvName(key); got != want {
+			t.Errorf("EnvName(%s) = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestLoadOdaConfigSources(t *testing.T) {
+	file := useConfigFile(t, "database:\n  host: db\n  port: 5432\ndirs:\n  project: /srv/odoo\n")
+	t.Setenv("ODA_DATABASE_HOST", "pg")
+	t.Setenv("ODA_INCUS_LIMIT_CPU", "4")
+	t.Setenv("ODA_SYSTEM_IPV6", "true")
+
+	odaConf, sources, err := LoadOdaConfigSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odaConf.Database.Host != "pg" || odaConf.Database.Port != 5432 || odaConf.Dirs.Project != "/srv/odoo" ||
+		odaConf.Incus.LimitCPU != 4 || !odaConf.System.IPv6 {
+		t.Errorf("merged config %+v", odaConf)
+	}
+	for key, want := range map[string]string{
+		"database.host":   "env ODA_DATABASE_HOST",
+		"database.port":   file,
+		"dirs.project":    file,
+		"incus.limit_cpu": "env ODA_INCUS_LIMIT_CPU",
+	} {
+		if sources[key] != want {
+			t.Errorf("source of %s = %q, want %q", key, sources[key], want)
+		}
+	}
+	if _, ok := sources["dirs.repo"]; ok {
+		t.Error("dirs.repo has a source but is set nowhere")
+	}
+
+	// saving starts from the file alone
+	fileConf, err := LoadOdaConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileConf.Database.Host != "db" {
+		t.Errorf("file config host %s, want db", fileConf.Database.Host)
+	}
+}
+
+func TestLoadOdaConfigInvalidEnv(t *testing.T) {
+	useConfigFile(t, "database:\n  port: 5432\n")
+	t.Setenv("ODA_DATABASE_PORT", "five")
+
+	if _, err := LoadOdaConfig(); err == nil || !strings.Contains(err.Error(), "ODA_DATABASE_PORT") {
+		t.Fatalf("error %v, want invalid ODA_DATABASE_PORT", err)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	settings := NewOdaConfig().Settings()
+	got := map[string]string{}
+	for _, s := range settings {
+		got[s.Key] = s.Value
+	}
+	if settings[0].Key != "database.host" {
+		t.Errorf("first setting %s, want database.host", settings[0].Key)
+	}
+	if got["incus.limit_cpu"] != "2" || got["dirs.project"] != "/home/odoo/workspace/odoo" {
+		t.Errorf("settings %v", got)
+	}
+}
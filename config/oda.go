@@ -4,51 +4,134 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ppreeper/oda/lib"
+	"github.com/ppreeper/oda/secret"
 	"gopkg.in/yaml.v3"
 )
 
-func LoadOdaConfigUser(user string) (*OdaConf, error) {
-	var odaConf *OdaConf
-
-	cfgDir := lib.UserConfigDir(user)
+// configFile overrides the location of oda.yaml, set from --config
+var configFile string
 
-	yamlFilename := filepath.Join(cfgDir, "oda", "oda.yaml")
+// SetConfigFile makes oda read and write path instead of the user oda.yaml,
+// a relative path is made absolute as commands change into project dirs
+func SetConfigFile(path string) {
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	configFile = path
+}
 
-	yamlFile, err := os.ReadFile(yamlFilename)
+// OdaConfigFile is the oda.yaml in use
+func OdaConfigFile() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	cfgDir, err := os.UserConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("oda.yaml not found in %s", cfgDir)
+		return "", fmt.Errorf("could not get user config dir: %w", err)
 	}
+	return filepath.Join(cfgDir, "oda", "oda.yaml"), nil
+}
 
-	err = yaml.Unmarshal(yamlFile, &odaConf)
-	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal config: %w", err)
+// LoadOdaConfigUser loads the oda.yaml of user, for commands run with sudo,
+// secret references are left unresolved as the keyring is the user's
+func LoadOdaConfigUser(user string) (*OdaConf, error) {
+	yamlFilename := configFile
+	if yamlFilename == "" {
+		yamlFilename = filepath.Join(lib.UserConfigDir(user), "oda", "oda.yaml")
 	}
+	odaConf, _, err := loadOdaConfig(yamlFilename, true)
+	return odaConf, err
+}
 
+// LoadOdaConfig loads oda.yaml with the active context and the ODA_*
+// environment variables over it and the secret references resolved,
+// a secret that cannot be resolved is left as the reference and reported
+// with the config
+func LoadOdaConfig() (*OdaConf, error) {
+	odaConf, _, err := LoadOdaConfigSources()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := secret.ResolveRefs(odaConf, odaConf.OpenSecrets); err != nil {
+		return odaConf, fmt.Errorf("could not resolve oda.yaml secrets: %w", err)
+	}
 	return odaConf, nil
 }
 
-func LoadOdaConfig() (*OdaConf, error) {
-	var odaConf *OdaConf
-	cfgDir, err := os.UserConfigDir()
+// LoadOdaConfigSources loads the config like LoadOdaConfig, without
+// resolving secrets, and tells where each setting came from, keyed by
+// setting, settings in neither are left out
+func LoadOdaConfigSources() (*OdaConf, map[string]string, error) {
+	yamlFilename, err := OdaConfigFile()
 	if err != nil {
-		return nil, fmt.Errorf("could not get user config dir: %w", err)
+		return nil, nil, err
 	}
+	return loadOdaConfig(yamlFilename, true)
+}
 
-	yamlFilename := filepath.Join(cfgDir, "oda", "oda.yaml")
+// LoadOdaConfigFile loads oda.yaml alone, for changing and saving it
+// without writing the context or environment overrides into it
+func LoadOdaConfigFile() (*OdaConf, error) {
+	yamlFilename, err := OdaConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	odaConf, _, err := loadOdaConfig(yamlFilename, false)
+	return odaConf, err
+}
 
+func loadOdaConfig(yamlFilename string, effective bool) (*OdaConf, map[string]string, error) {
 	yamlFile, err := os.ReadFile(yamlFilename)
 	if err != nil {
-		return nil, fmt.Errorf("oda.yaml not found in %s", cfgDir)
+		return nil, nil, fmt.Errorf("oda.yaml not found at %s", yamlFilename)
 	}
 
-	err = yaml.Unmarshal(yamlFile, &odaConf)
+	odaConf := &OdaConf{}
+	if err := yaml.Unmarshal(yamlFile, odaConf); err != nil {
+		return nil, nil, fmt.Errorf("could not unmarshal config: %w", err)
+	}
+	sources, err := fileSources(yamlFile, yamlFilename)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal config: %w", err)
+		return nil, nil, err
 	}
+	if effective {
+		if err := applyContext(odaConf, sources); err != nil {
+			return nil, nil, err
+		}
+		if err := applyEnv(odaConf, sources); err != nil {
+			return nil, nil, err
+		}
+		if err := odaConf.validateDatabases(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return odaConf, sources, nil
+}
 
-	return odaConf, nil
+// SaveOdaConfig writes odaConf to the oda.yaml in use
+func SaveOdaConfig(odaConf *OdaConf) error {
+	yamlFilename, err := OdaConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(yamlFilename), 0o750); err != nil {
+		return fmt.Errorf("could not create config dir: %w", err)
+	}
+
+	yamlOut, err := yaml.Marshal(odaConf)
+	if err != nil {
+		return fmt.Errorf("could not marshal config: %w", err)
+	}
+	if err := os.WriteFile(yamlFilename, yamlOut, 0o640); err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+	return nil
 }
 
 func NewOdaConfig() *OdaConf {
@@ -66,15 +149,22 @@ func NewOdaConfig() *OdaConf {
 			Project: "/home/odoo/workspace/odoo",
 		},
 		Incus: OdaIncus{
-			Socket:      "/var/lib/incus/unix.socket",
-			Type:        "unix",
-			URL:         "http://unix.socket/1.0",
-			LimitCPU:    2,
-			LimitMemory: "2GiB",
+			Socket:       "/var/lib/incus/unix.socket",
+			Type:         "unix",
+			URL:          "http://unix.socket/1.0",
+			Project:      "oda",
+			InstanceType: InstanceTypeContainer,
+			LimitCPU:     2,
+			LimitMemory:  "2GiB",
+		},
+		Secrets: OdaSecrets{
+			Backend: secret.BackendAuto,
 		},
 		System: OdaSystem{
-			Domain: "local",
-			SSHKey: "id_rsa",
+			Domain:        "local",
+			SSHKey:        "id_rsa",
+			ExposePorts:   DefaultExposePorts,
+			ExposeAddress: DefaultExposeAddress,
 		},
 	}
 }
@@ -86,25 +176,142 @@ type OdaDatabase struct {
 	Password string `json:"password" yaml:"password"`
 	Version  int    `json:"version" yaml:"version"`
 	Image    string `json:"image" yaml:"image"`
+	// Name is the server name projects pick in .oda.yaml, the host by default
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 }
 type OdaDirs struct {
 	Repo    string `json:"repo" yaml:"repo"`
 	Project string `json:"project" yaml:"project"`
 }
+
+// instance types of project and base instances
+const (
+	InstanceTypeContainer = "container"
+	InstanceTypeVM        = "virtual-machine"
+)
+
 type OdaIncus struct {
-	Socket      string `json:"socket" yaml:"socket"`
-	Type        string `json:"type" yaml:"type"`
-	URL         string `json:"url" yaml:"url"`
-	LimitCPU    int    `json:"limit_cpu" yaml:"limit_cpu"`
-	LimitMemory string `json:"limit_memory" yaml:"limit_memory"`
+	Socket            string `json:"socket" yaml:"socket"`
+	Type              string `json:"type" yaml:"type"`
+	URL               string `json:"url" yaml:"url"`
+	ClientCert        string `json:"client_cert,omitempty" yaml:"client_cert,omitempty"`
+	ClientKey         string `json:"client_key,omitempty" yaml:"client_key,omitempty"`
+	ServerCA          string `json:"server_ca,omitempty" yaml:"server_ca,omitempty"`
+	ServerFingerprint string `json:"server_fingerprint,omitempty" yaml:"server_fingerprint,omitempty"`
+	Project           string `json:"project,omitempty" yaml:"project,omitempty"`
+	InstanceType      string `json:"instance_type,omitempty" yaml:"instance_type,omitempty"`
+	LimitCPU          int    `json:"limit_cpu" yaml:"limit_cpu"`
+	LimitMemory       string `json:"limit_memory" yaml:"limit_memory"`
 }
 type OdaSystem struct {
 	Domain string `json:"domain" yaml:"domain"`
 	SSHKey string `json:"ssh_key" yaml:"ssh_key"`
+	// IPv6 adds AAAA entries to the hosts file and prefers ipv6 for ssh
+	IPv6 bool `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+	// ExposePorts is the host port range oda expose allocates from, as first-last
+	ExposePorts string `json:"expose_ports,omitempty" yaml:"expose_ports,omitempty"`
+	// ExposeAddress is the host address exposed ports listen on
+	ExposeAddress string `json:"expose_address,omitempty" yaml:"expose_address,omitempty"`
 }
+
+// OdaSecrets is where secret:// references are looked up
+type OdaSecrets struct {
+	// Backend is auto, keyring or file
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	// Identity is the age identity of the file backend, secrets.key next
+	// to oda.yaml by default
+	Identity string `json:"identity,omitempty" yaml:"identity,omitempty"`
+}
+
+// OpenSecrets opens the secret store, the file backend keeps its files
+// next to oda.yaml
+func (c *OdaConf) OpenSecrets() (secret.Store, error) {
+	odaFile, err := OdaConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return secret.Open(c.Secrets.Backend, filepath.Dir(odaFile), c.Secrets.Identity)
+}
+
+// default host port range and listen address of exposed projects
+const (
+	DefaultExposePorts   = "18000-18999"
+	DefaultExposeAddress = "127.0.0.1"
+)
+
+// ExposePortRange parses the expose port range
+func (s OdaSystem) ExposePortRange() (int, int, error) {
+	portRange := s.ExposePorts
+	if portRange == "" {
+		portRange = DefaultExposePorts
+	}
+	first, last, ok := strings.Cut(portRange, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid expose port range %s, use first-last", portRange)
+	}
+	firstPort, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid expose port range %s %w", portRange, err)
+	}
+	lastPort, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid expose port range %s %w", portRange, err)
+	}
+	if firstPort < 1 || lastPort > 65535 || firstPort >= lastPort {
+		return 0, 0, fmt.Errorf("invalid expose port range %s", portRange)
+	}
+	return firstPort, lastPort, nil
+}
+
+// ExposeListenAddress is the host address exposed ports listen on
+func (s OdaSystem) ExposeListenAddress() string {
+	if s.ExposeAddress == "" {
+		return DefaultExposeAddress
+	}
+	return s.ExposeAddress
+}
+
 type OdaConf struct {
 	Database OdaDatabase `json:"database" yaml:"database"`
-	Dirs     OdaDirs     `json:"dirs" yaml:"dirs"`
-	Incus    OdaIncus    `json:"incus" yaml:"incus"`
-	System   OdaSystem   `json:"system" yaml:"system"`
+	// Databases are more database servers, database is the default one
+	Databases []OdaDatabase `json:"databases,omitempty" yaml:"databases,omitempty"`
+	Dirs      OdaDirs       `json:"dirs" yaml:"dirs"`
+	Incus     OdaIncus      `json:"incus" yaml:"incus"`
+	System    OdaSystem     `json:"system" yaml:"system"`
+	Secrets   OdaSecrets    `json:"secrets" yaml:"secrets"`
+	// CurrentContext is the context oda use selected
+	CurrentContext string `json:"current_context,omitempty" yaml:"current_context,omitempty"`
+	// Contexts are named sets of settings laid over the ones above
+	Contexts map[string]OdaContext `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+}
+
+// InstanceType is the instance type of a project, the project setting in
+// .oda.yaml wins over oda.yaml and containers are the default
+func (c *OdaConf) InstanceType(project *OdaProject) (string, error) {
+	instanceType := c.Incus.InstanceType
+	if project != nil && project.InstanceType != "" {
+		instanceType = project.InstanceType
+	}
+	switch instanceType {
+	case "":
+		return InstanceTypeContainer, nil
+	case InstanceTypeContainer, InstanceTypeVM:
+		return instanceType, nil
+	}
+	return "", fmt.Errorf("unknown instance type %s, use %s or %s", instanceType, InstanceTypeContainer, InstanceTypeVM)
+}
+
+// OpenSecretStore opens the secret store of the oda.yaml in use
+func OpenSecretStore() (secret.Store, error) {
+	odaConf, _, err := LoadOdaConfigSources()
+	if err != nil {
+		return nil, err
+	}
+	return odaConf.OpenSecrets()
+}
+
+// ResolveSecret is the secret value refers to, other values are
+// returned as they are
+func ResolveSecret(value string) (string, error) {
+	return secret.Resolve(value, OpenSecretStore)
 }
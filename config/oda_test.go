@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstanceType(t *testing.T) {
+	tests := []struct {
+		name    string
+		oda     string
+		project *OdaProject
+		want    string
+		wantErr bool
+	}{
+		{"default", "", nil, InstanceTypeContainer, false},
+		{"oda.yaml", InstanceTypeVM, nil, InstanceTypeVM, false},
+		{"project override", InstanceTypeContainer, &OdaProject{InstanceType: InstanceTypeVM}, InstanceTypeVM, false},
+		{"empty project setting", InstanceTypeVM, &OdaProject{}, InstanceTypeVM, false},
+		{"unknown", "vm", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			odaConf := NewOdaConfig()
+			odaConf.Incus.InstanceType = tt.oda
+			got, err := odaConf.InstanceType(tt.project)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchNames(t *testing.T) {
+	branch := GetVersion("17.0")
+	if branch == nil {
+		t.Fatal("no branch for 17.0")
+	}
+	if got := branch.BaseInstanceName(InstanceTypeContainer); got != "odoo-17-0" {
+		t.Errorf("container base %q", got)
+	}
+	if got := branch.BaseInstanceName(InstanceTypeVM); got != "odoo-17-0-vm" {
+		t.Errorf("vm base %q", got)
+	}
+	if got := branch.ImageAlias(InstanceTypeContainer); got != "oda/odoo-17.0" {
+		t.Errorf("container alias %q", got)
+	}
+	if got := branch.ImageAlias(InstanceTypeVM); got != "oda/odoo-17.0-vm" {
+		t.Errorf("vm alias %q", got)
+	}
+}
+
+func TestSetConfigFileRelative(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oda.yaml"), []byte("dirs:\n  project: /srv/odoo\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	SetConfigFile("./oda.yaml")
+	t.Cleanup(func() { SetConfigFile("") })
+
+	// commands like project init change into the project directory
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := OdaConfigFile(); file != filepath.Join(dir, "oda.yaml") {
+		t.Errorf("config file %s, want %s", file, filepath.Join(dir, "oda.yaml"))
+	}
+	if odaConf, err := LoadOdaConfig(); err != nil || odaConf.Dirs.Project != "/srv/odoo" {
+		t.Errorf("load after chdir: %v", err)
+	}
+}
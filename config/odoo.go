@@ -1,13 +1,14 @@
 package config
 
 import (
-	"bufio"
+	"bytes"
 	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -65,34 +66,29 @@ func NewOdooConfig() *OdooConfig {
 	}
 }
 
-func (odoo *OdooConfig) Write(projectName, projectDir, edition string, embedFS embed.FS) error {
+// Write creates conf/odoo.conf of the project from its .oda.yaml settings,
+// an existing file keeps the options and comments added by hand
+func (odoo *OdooConfig) Write(projectName, projectDir string, project *OdaProject, embedFS embed.FS) error {
 	odaConf, err := LoadOdaConfig()
 	if err != nil {
 		return err
 	}
 
-	projectName = strings.ReplaceAll(projectName, "-", "_")
-	dbname := projectName + "_" + odaConf.System.Domain
-
-	odooConfFile := filepath.Join(projectDir, "conf", "odoo.conf")
-
-	fo, err := os.Create(odooConfFile)
+	dbname := project.DBName(projectName, odaConf.System.Domain)
+	db, err := odaConf.ProjectDatabase(project)
 	if err != nil {
-		return fmt.Errorf("cannot create odoo.conf file %w", err)
+		return err
 	}
-	defer fo.Close()
+
+	odooConfFile := filepath.Join(projectDir, "conf", "odoo.conf")
 
 	data := map[string]string{
-		"enterprise_dir":      "",
+		"addons_path":         project.AddonsPath(),
 		"admin_passwd":        odoo.AdminPasswd,
 		"without_demo":        odoo.WithoutDemo,
 		"reportgz":            odoo.Reportgz,
 		"server_wide_modules": odoo.ServerWideModules,
-		"db_host":             odaConf.Database.Host,
-		"db_port":             fmt.Sprintf("%d", odaConf.Database.Port),
 		"db_maxconn":          fmt.Sprintf("%d", odoo.DbMaxconn),
-		"db_user":             odaConf.Database.Username,
-		"db_password":         odaConf.Database.Password,
 		"db_name":             dbname,
 		"db_template":         odoo.DbTemplate,
 		"db_sslmode":          odoo.DbSslmode,
@@ -104,58 +100,51 @@ func (odoo *OdooConfig) Write(projectName, projectDir, edition string, embedFS e
 		"log_handler":         odoo.LogHandler,
 		"workers":             fmt.Sprintf("%d", odoo.Workers),
 	}
-	if edition == "enterprise" {
-		data["enterprise_dir"] = "/opt/odoo/enterprise,"
+	for key, value := range db.OdooConf() {
+		data[key] = value
 	}
+	return writeOdooConfTemplate(odooConfFile, data, embedFS)
+}
 
-	// load and write template
-	t, err := template.ParseFS(embedFS, "templates/odoo.conf")
+// writeOdooConfTemplate writes the odoo.conf template to file, an existing
+// file only gets the template options changed and keeps everything else
+func writeOdooConfTemplate(file string, data map[string]string, templates fs.FS) error {
+	t, err := template.ParseFS(templates, "templates/odoo.conf")
 	if err != nil {
 		return fmt.Errorf("cannot parse odoo.conf template %w", err)
 	}
-	err = t.Execute(fo, data)
-	if err != nil {
+	var rendered bytes.Buffer
+	if err := t.Execute(&rendered, data); err != nil {
 		return fmt.Errorf("cannot write odoo.conf file %w", err)
 	}
 
-	return nil
-}
-
-func LoadOdooConfig(cwd string) (*OdooConfig, error) {
-	// fmt.Println("LoadOdooConfig", cwd)
-
-	confFileName := filepath.Join(cwd, "conf", "odoo.conf")
-	// fmt.Println("confFile", confFileName)
-
-	confFile, err := os.Open(confFileName)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err := os.WriteFile(file, rendered.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("cannot create odoo.conf file %w", err)
+		}
+		return nil
+	}
+	conf, err := LoadOdooConfFile(file)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open odoo.conf file %w", err)
+		return err
 	}
-	defer func() {
-		if err := confFile.Close(); err != nil {
-			panic(err)
-		}
-	}()
-
-	kvals := map[string]string{}
-
-	scanner := bufio.NewScanner(confFile)
-	for scanner.Scan() {
-		line := scanner.Text()
-		kv := strings.SplitN(line, "=", 2)
-		if len(kv) == 2 {
-			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			kvals[key] = value
+	tmpl := ParseOdooConf(file, rendered.Bytes())
+	for _, key := range tmpl.Keys() {
+		value, _ := tmpl.Get(key)
+		if current, ok := conf.Get(key); !ok || current != value {
+			conf.Set(key, value)
 		}
 	}
-	// fmt.Println(kvals)
-
-	odooConf := BuildOdooConfig(kvals)
-	// fmt.Println("Loaded:", odooConf)
+	return conf.Save()
+}
 
-	// fmt.Println("LoadOdaConfig", odaConf)
-	return odooConf, nil
+// LoadOdooConfig reads the [options] of the project conf/odoo.conf
+func LoadOdooConfig(cwd string) (*OdooConfig, error) {
+	conf, err := LoadOdooConfFile(filepath.Join(cwd, "conf", "odoo.conf"))
+	if err != nil {
+		return nil, err
+	}
+	return BuildOdooConfig(conf.Options()), nil
 }
 
 func BuildOdooConfig(kvals map[string]string) *OdooConfig {
@@ -196,24 +185,15 @@ func BuildOdooConfig(kvals map[string]string) *OdooConfig {
 	return &odooConf
 }
 
+// ReadConfValue is the value of key in an odoo.conf, def when the file
+// or the key is missing
 func ReadConfValue(conffile, key, def string) string {
-	c, err := os.Open(conffile)
+	conf, err := LoadOdooConfFile(conffile)
 	if err != nil {
 		return def
 	}
-	defer func() {
-		if err := c.Close(); err != nil {
-			panic(err)
-		}
-	}()
-	scanner := bufio.NewScanner(c)
-	for scanner.Scan() {
-		line := scanner.Text()
-		re := regexp.MustCompile(`^` + key + ` = (.+)$`)
-		if re.MatchString(line) {
-			match := re.FindStringSubmatch(line)
-			return match[1]
-		}
+	if value, ok := conf.Get(key); ok {
+		return value
 	}
 	return def
 }
@@ -229,31 +209,31 @@ func WriteOdooConf(file, projectName, edition string, embedFS embed.FS) error {
 	projectName = strings.ReplaceAll(projectName, "-", "_")
 	dbname := projectName + "_" + odaConf.System.Domain
 
-	fo, err := os.Create(file)
-	if err != nil {
-		return fmt.Errorf("cannot create odoo.conf file %w", err)
-	}
-	defer fo.Close()
-
 	data := map[string]string{
-		"db_host":        odaConf.Database.Host,
-		"db_port":        string(odaConf.Database.Port),
-		"db_user":        odaConf.Database.Username,
-		"db_password":    odaConf.Database.Password,
-		"db_name":        dbname,
-		"enterprise_dir": "",
-	}
-	if edition == "enterprise" {
-		data["enterprise_dir"] = "/opt/odoo/enterprise,"
-	}
-	t, err := template.ParseFS(embedFS, "templates/odoo.conf")
+		"db_host":     odaConf.Database.Host,
+		"db_port":     fmt.Sprintf("%d", odaConf.Database.Port),
+		"db_user":     odaConf.Database.Username,
+		"db_password": odaConf.Database.Password,
+		"db_name":     dbname,
+		"addons_path": (&OdaProject{Edition: edition}).AddonsPath(),
+	}
+	return writeOdooConfTemplate(file, data, embedFS)
+}
+
+// SetOdooConfValues replaces the given keys in an odoo.conf file,
+// keys not in the file are added at the end of the [options] section
+func SetOdooConfValues(file string, values map[string]string) error {
+	conf, err := LoadOdooConfFile(file)
 	if err != nil {
-		return fmt.Errorf("cannot parse odoo.conf template %w", err)
+		return err
 	}
-	err = t.Execute(fo, data)
-	if err != nil {
-		return fmt.Errorf("cannot write odoo.conf file %w", err)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
 	}
-
-	return nil
+	sort.Strings(keys)
+	for _, key := range keys {
+		conf.Set(key, values[key])
+	}
+	return conf.Save()
 }
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OdooOptions is the odoo.conf section odoo reads its options from
+const OdooOptions = "options"
+
+// OdooConfFile is an odoo.conf kept line by line, so saving it keeps the
+// comments, unknown keys and extra sections a developer added by hand
+type OdooConfFile struct {
+	Path    string
+	entries []odooConfEntry
+}
+
+// odooConfEntry is a key with its continuation lines, or a comment,
+// blank line or section header when key is empty
+type odooConfEntry struct {
+	section string
+	key     string
+	value   string
+	lines   []string
+}
+
+// LoadOdooConfFile reads an odoo.conf for changing it
+func LoadOdooConfFile(path string) (*OdooConfFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open odoo.conf file %w", err)
+	}
+	return ParseOdooConf(path, content), nil
+}
+
+// ParseOdooConf reads odoo.conf content the way odoo's configparser does:
+// key = value or key: value lines in [sections], ; and # comments, and
+// indented lines continuing the value before them
+func ParseOdooConf(path string, content []byte) *OdooConfFile {
+	conf := &OdooConfFile{Path: path}
+	section := ""
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return conf
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		last := len(conf.entries) - 1
+		switch {
+		case trimmed != "" && line[0] != trimmed[0] && last >= 0 && conf.entries[last].key != "":
+			conf.entries[last].value += "\n" + trimmed
+			conf.entries[last].lines = append(conf.entries[last].lines, line)
+			continue
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			conf.entries = append(conf.entries, odooConfEntry{section: section, lines: []string{line}})
+			continue
+		case trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#"):
+			conf.entries = append(conf.entries, odooConfEntry{section: section, lines: []string{line}})
+			continue
+		}
+		key, value := splitOdooConfLine(trimmed)
+		conf.entries = append(conf.entries, odooConfEntry{section: section, key: key, value: value, lines: []string{line}})
+	}
+	return conf
+}
+
+// splitOdooConfLine splits at the first = or :, a line without either is
+// a key with an empty value
+func splitOdooConfLine(line string) (string, string) {
+	idx := strings.IndexAny(line, "=:")
+	if idx == -1 {
+		return line, ""
+	}
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+}
+
+// splitOdooConfKey splits section.key, a plain key is in [options]
+func splitOdooConfKey(key string) (string, string) {
+	if section, name, ok := strings.Cut(key, "."); ok {
+		return section, name
+	}
+	return OdooOptions, key
+}
+
+func (c *OdooConfFile) index(key string) int {
+	section, name := splitOdooConfKey(key)
+	for i, entry := range c.entries {
+		if entry.key == name && entry.section == section {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get is the value of key, given as key for [options] or section.key
+func (c *OdooConfFile) Get(key string) (string, bool) {
+	if i := c.index(key); i != -1 {
+		return c.entries[i].value, true
+	}
+	return "", false
+}
+
+// Set changes key in place, a new key is added at the end of its
+// section and a new section at the end of the file
+func (c *OdooConfFile) Set(key, value string) {
+	section, name := splitOdooConfKey(key)
+	entry := odooConfEntry{section: section, key: name, value: value, lines: []string{name + " = " + value}}
+	if i := c.index(key); i != -1 {
+		c.entries[i] = entry
+		return
+	}
+	end := -1
+	for i, e := range c.entries {
+		if e.section != section {
+			continue
+		}
+		if e.key != "" || strings.HasPrefix(strings.TrimSpace(e.lines[0]), "[") {
+			end = i
+		}
+	}
+	if end == -1 {
+		c.entries = append(c.entries, odooConfEntry{section: section, lines: []string{"[" + section + "]"}}, entry)
+		return
+	}
+	c.entries = append(c.entries[:end+1], append([]odooConfEntry{entry}, c.entries[end+1:]...)...)
+}
+
+// Unset removes key and reports whether it was set
+func (c *OdooConfFile) Unset(key string) bool {
+	i := c.index(key)
+	if i == -1 {
+		return false
+	}
+	c.entries = append(c.entries[:i], c.entries[i+1:]...)
+	return true
+}
+
+// Keys lists the keys in file order, [options] keys plain and the others
+// as section.key
+func (c *OdooConfFile) Keys() []string {
+	keys := []string{}
+	for _, entry := range c.entries {
+		switch {
+		case entry.key == "":
+		case entry.section == OdooOptions:
+			keys = append(keys, entry.key)
+		default:
+			keys = append(keys, entry.section+"."+entry.key)
+		}
+	}
+	return keys
+}
+
+// Options are the [options] keys and values
+func (c *OdooConfFile) Options() map[string]string {
+	options := map[string]string{}
+	for _, entry := range c.entries {
+		if entry.key != "" && entry.section == OdooOptions {
+			options[entry.key] = entry.value
+		}
+	}
+	return options
+}
+
+// Bytes is the file content
+func (c *OdooConfFile) Bytes() []byte {
+	var b strings.Builder
+	for _, entry := range c.entries {
+		for _, line := range entry.lines {
+			b.WriteString(line + "\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// Save writes the file back to Path
+func (c *OdooConfFile) Save() error {
+	if err := os.WriteFile(c.Path, c.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("cannot write odoo.conf file %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const handEditedConf = `; project options
+[options]
+addons_path = /opt/odoo/odoo/addons,/opt/odoo/addons
+db_host = db
+db_name: p1_local
+# added by hand
+limit_time_real = 1200
+server_wide_modules = base,
+    web,
+    queue_job
+
+[queue_job]
+channels = root:2
+`
+
+func TestParseOdooConfRoundTrip(t *testing.T) {
+	conf := ParseOdooConf("odoo.conf", []byte(handEditedConf))
+	if got := string(conf.Bytes()); got != handEditedConf {
+		t.Errorf("round trip\n%s\nwant\n%s", got, handEditedConf)
+	}
+	for key, want := range map[string]string{
+		"db_name":             "p1_local",
+		"limit_time_real":     "1200",
+		"server_wide_modules": "base,\nweb,\nqueue_job",
+		"queue_job.channels":  "root:2",
+	} {
+		if got, ok := conf.Get(key); !ok || got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := conf.Get("channels"); ok {
+		t.Error("queue_job channels found in [options]")
+	}
+	want := []string{"addons_path", "db_host", "db_name", "limit_time_real", "server_wide_modules", "queue_job.channels"}
+	if got := conf.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys %v", got)
+	}
+}
+
+func TestOdooConfFileSetUnset(t *testing.T) {
+	conf := ParseOdooConf("odoo.conf", []byte(handEditedConf))
+	conf.Set("db_host", "pg")
+	conf.Set("workers", "4")
+	conf.Set("queue_job.jobrunner_db_host", "pg")
+	conf.Set("fs_storage.enabled", "true")
+	if !conf.Unset("limit_time_real") || conf.Unset("limit_time_real") {
+		t.Error("unset limit_time_real")
+	}
+
+	want := `; project options
+[options]
+addons_path = /opt/odoo/odoo/addons,/opt/odoo/addons
+db_host = pg
+db_name: p1_local
+# added by hand
+server_wide_modules = base,
+    web,
+    queue_job
+workers = 4
+
+[queue_job]
+channels = root:2
+jobrunner_db_host = pg
+[fs_storage]
+enabled = true
+`
+	if got := string(conf.Bytes()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteOdooConfTemplateKeepsHandEdits(t *testing.T) {
+	templates := fstest.MapFS{"templates/odoo.conf": {Data: []byte(
+		"[options]\naddons_path = {{ .addons_path }}\ndb_host = {{ .db_host }}\ndb_name = {{ .db_name }}\n")}}
+	file := filepath.Join(t.TempDir(), "odoo.conf")
+	data := map[string]string{"addons_path": "/opt/odoo/odoo/addons,/opt/odoo/addons", "db_host": "db", "db_name": "p1_local"}
+
+	if err := writeOdooConfTemplate(file, data, templates); err != nil {
+		t.Fatal(err)
+	}
+	if got := ReadConfValue(file, "db_name", ""); got != "p1_local" {
+		t.Errorf("new file db_name %q", got)
+	}
+
+	if err := os.WriteFile(file, []byte(handEditedConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data["db_host"] = "pg"
+	if err := writeOdooConfTemplate(file, data, templates); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := LoadOdooConfFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"db_host":            "pg",
+		"limit_time_real":    "1200",
+		"queue_job.channels": "root:2",
+	} {
+		if got, _ := conf.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	// unchanged options keep their formatting
+	if got := string(conf.Bytes()); !strings.HasPrefix(got, "; project options") ||
+		!strings.Contains(got, "db_name: p1_local") {
+		t.Errorf("hand edits lost\n%s", got)
+	}
+}
@@ -4,21 +4,80 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/ppreeper/oda/secret"
 	"gopkg.in/yaml.v3"
 )
 
+// ProjectSchema is the current layout of .oda.yaml, files without a
+// schema were written before it was versioned and only hold the version
+const ProjectSchema = 2
+
+// odoo editions
+const (
+	EditionCommunity  = "community"
+	EditionEnterprise = "enterprise"
+)
+
 type OdaProject struct {
-	Version string `json:"version"`
+	Schema       int               `json:"schema" yaml:"schema"`
+	Version      string            `json:"version"`
+	Edition      string            `json:"edition,omitempty" yaml:"edition,omitempty"`
+	Database     string            `json:"database,omitempty" yaml:"database,omitempty"`
+	DBServer     string            `json:"db_server,omitempty" yaml:"db_server,omitempty"`
+	InstanceType string            `json:"instance_type,omitempty" yaml:"instance_type,omitempty"`
+	Image        string            `json:"image,omitempty" yaml:"image,omitempty"`
+	Limits       *OdaProjectLimits `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Addons       []OdaAddons       `json:"addons,omitempty" yaml:"addons,omitempty"`
+	Modules      []string          `json:"modules,omitempty" yaml:"modules,omitempty"`
+	Expose       *OdaExpose        `json:"expose,omitempty" yaml:"expose,omitempty"`
+
+	// secretRefs are the secret references resolved on load, written
+	// back by WriteConfig
+	secretRefs secret.Refs
+}
+
+// OdaProjectLimits override the limits of the oda profile for the project instance
+type OdaProjectLimits struct {
+	CPU    string `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty" yaml:"memory,omitempty"`
+}
+
+// OdaAddons is an extra addons repository on the host, mounted in the
+// instance at /opt/odoo/extra/<name> and added to the addons path
+type OdaAddons struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
 }
 
+// OdaExpose are the host ports forwarded to the project instance
+type OdaExpose struct {
+	HTTPPort        int `json:"http_port" yaml:"http_port"`
+	LongpollingPort int `json:"longpolling_port" yaml:"longpolling_port"`
+}
+
+var (
+	addonsNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	moduleNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+	databaseRe   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	memoryRe     = regexp.MustCompile(`^[0-9]+(B|kB|MB|GB|TB|KiB|MiB|GiB|TiB|%)?$`)
+)
+
 func LoadProjectConfig() (*OdaProject, error) {
-	var config *OdaProject
 	cwd, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("could not get current working directory: %w", err)
 	}
-	yamlFilename := filepath.Join(cwd, ".oda.yaml")
+	return LoadProjectConfigFrom(cwd)
+}
+
+// LoadProjectConfigFrom reads and validates .oda.yaml of the project in dir
+func LoadProjectConfigFrom(dir string) (*OdaProject, error) {
+	var config *OdaProject
+	yamlFilename := filepath.Join(dir, ".oda.yaml")
 	yamlFile, err := os.ReadFile(yamlFilename)
 	if err != nil {
 		return nil, fmt.Errorf("could not read project config file: %w", err)
@@ -27,14 +86,183 @@ func LoadProjectConfig() (*OdaProject, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not unmarshal config: %w", err)
 	}
+	if config == nil {
+		config = &OdaProject{}
+	}
+	if config.Schema < ProjectSchema {
+		config.migrate(dir)
+	}
+	if config.secretRefs, err = secret.ResolveRefs(config, OpenSecretStore); err != nil {
+		return nil, fmt.Errorf("could not resolve %s secrets: %w", yamlFilename, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", yamlFilename, err)
+	}
 	return config, nil
 }
 
+// migrate fills the settings older schemas left to odoo.conf
+func (p *OdaProject) migrate(dir string) {
+	conf := filepath.Join(dir, "conf", "odoo.conf")
+	if p.Edition == "" {
+		p.Edition = EditionCommunity
+		if strings.Contains(ReadConfValue(conf, "addons_path", ""), "/opt/odoo/enterprise") {
+			p.Edition = EditionEnterprise
+		}
+	}
+	if p.Database == "" {
+		p.Database = ReadConfValue(conf, "db_name", "")
+	}
+	p.Schema = ProjectSchema
+}
+
+// Validate checks the settings of the project
+func (p *OdaProject) Validate() error {
+	if p.Schema > ProjectSchema {
+		return fmt.Errorf("schema %d is newer than this oda supports (%d)", p.Schema, ProjectSchema)
+	}
+	if p.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	if GetVersion(p.Version) == nil {
+		return fmt.Errorf("unknown version %s", p.Version)
+	}
+	switch p.Edition {
+	case "", EditionCommunity, EditionEnterprise:
+	default:
+		return fmt.Errorf("unknown edition %s", p.Edition)
+	}
+	if p.Database != "" && !databaseRe.MatchString(p.Database) {
+		return fmt.Errorf("invalid database name %s", p.Database)
+	}
+	if p.DBServer != "" && !serverNameRe.MatchString(p.DBServer) {
+		return fmt.Errorf("invalid database server %s", p.DBServer)
+	}
+	switch p.InstanceType {
+	case "", InstanceTypeContainer, InstanceTypeVM:
+	default:
+		return fmt.Errorf("unknown instance type %s", p.InstanceType)
+	}
+	if p.Limits != nil {
+		if p.Limits.CPU != "" {
+			if cpu, err := strconv.Atoi(p.Limits.CPU); err != nil || cpu < 1 {
+				return fmt.Errorf("invalid cpu limit %s", p.Limits.CPU)
+			}
+		}
+		if p.Limits.Memory != "" && !memoryRe.MatchString(p.Limits.Memory) {
+			return fmt.Errorf("invalid memory limit %s", p.Limits.Memory)
+		}
+	}
+	names := map[string]bool{}
+	for _, addons := range p.Addons {
+		if !addonsNameRe.MatchString(addons.Name) {
+			return fmt.Errorf("invalid addons name %q", addons.Name)
+		}
+		if names[addons.Name] {
+			return fmt.Errorf("duplicate addons name %s", addons.Name)
+		}
+		names[addons.Name] = true
+		if addons.Path == "" {
+			return fmt.Errorf("addons %s has no path", addons.Name)
+		}
+	}
+	for _, module := range p.Modules {
+		if !moduleNameRe.MatchString(module) {
+			return fmt.Errorf("invalid module name %q", module)
+		}
+	}
+	if p.Expose != nil {
+		for _, port := range []int{p.Expose.HTTPPort, p.Expose.LongpollingPort} {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("invalid expose port %d", port)
+			}
+		}
+	}
+	return nil
+}
+
+// IsEnterprise is true when the project uses the enterprise addons
+func (p *OdaProject) IsEnterprise() bool {
+	return p.Edition == EditionEnterprise
+}
+
+// DBName is the database of the project, by default derived from the project name
+func (p *OdaProject) DBName(projectName, domain string) string {
+	if p.Database != "" {
+		return p.Database
+	}
+	return DefaultDBName(projectName, domain)
+}
+
+// DefaultDBName is the database name oda gives a new project
+func DefaultDBName(projectName, domain string) string {
+	return strings.ReplaceAll(projectName, "-", "_") + "_" + domain
+}
+
+// InstanceConfig is the instance configuration that overrides the profile limits
+func (p *OdaProject) InstanceConfig() map[string]string {
+	instanceConfig := map[string]string{}
+	if p.Limits != nil {
+		if p.Limits.CPU != "" {
+			instanceConfig["limits.cpu"] = p.Limits.CPU
+		}
+		if p.Limits.Memory != "" {
+			instanceConfig["limits.memory"] = p.Limits.Memory
+		}
+	}
+	return instanceConfig
+}
+
+// AddonsPath is the odoo addons_path inside the project instance
+func (p *OdaProject) AddonsPath() string {
+	paths := []string{"/opt/odoo/odoo/addons"}
+	if p.IsEnterprise() {
+		paths = append(paths, "/opt/odoo/enterprise")
+	}
+	paths = append(paths, "/opt/odoo/design-themes", "/opt/odoo/industry", "/opt/odoo/addons")
+	for _, addons := range p.Addons {
+		paths = append(paths, addons.AddonsPath())
+	}
+	return strings.Join(paths, ",")
+}
+
+// AddonsPath is the path of an extra addons repository inside the instance
+func (a OdaAddons) AddonsPath() string {
+	return "/opt/odoo/extra/" + a.Name
+}
+
+// HostPath resolves the repository path on the host, relative paths
+// are relative to the project directory
+func (a OdaAddons) HostPath(projectDir string) string {
+	p := a.Path
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(projectDir, p)
+	}
+	return filepath.Clean(p)
+}
+
 func (p *OdaProject) WriteConfig(configPath string) error {
+	p.Schema = ProjectSchema
 	odaYamlData, err := yaml.Marshal(p)
 	if err != nil {
 		return fmt.Errorf("could not marshal config: %w", err)
 	}
+	if len(p.secretRefs) > 0 {
+		// write the references, not the secrets they resolved to
+		out := &OdaProject{}
+		if err := yaml.Unmarshal(odaYamlData, out); err != nil {
+			return fmt.Errorf("could not marshal config: %w", err)
+		}
+		secret.RestoreRefs(out, p.secretRefs)
+		if odaYamlData, err = yaml.Marshal(out); err != nil {
+			return fmt.Errorf("could not marshal config: %w", err)
+		}
+	}
 	if err := os.WriteFile(configPath, odaYamlData, 0o644); err != nil {
 		return fmt.Errorf("cannot create project .oda.yaml file %w", err)
 	}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProject(t *testing.T, odaYaml, odooConf string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "conf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".oda.yaml"), []byte(odaYaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "conf", "odoo.conf"), []byte(odooConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadProjectConfigMigrates(t *testing.T) {
+	dir := writeProject(t, "version: \"17.0\"\n",
+		"[options]\naddons_path = /opt/odoo/odoo/addons,/opt/odoo/enterprise,/opt/odoo/addons\ndb_name = shop_local\n")
+
+	p, err := LoadProjectConfigFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Schema != ProjectSchema || p.Edition != EditionEnterprise || p.Database != "shop_local" {
+		t.Errorf("migrated to schema %d edition %q database %q", p.Schema, p.Edition, p.Database)
+	}
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	dir := writeProject(t, `schema: 2
+version: "17.0"
+edition: community
+database: shop
+image: 0123456789abcdef
+limits:
+  cpu: "4"
+  memory: 4GiB
+addons:
+  - name: oca-web
+    path: ../oca/web
+modules:
+  - sale
+  - web_responsive
+`, "[options]\n")
+
+	p, err := LoadProjectConfigFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.DBName("shop-1", "local"); got != "shop" {
+		t.Errorf("DBName %q, want shop", got)
+	}
+	if got := p.InstanceConfig(); got["limits.cpu"] != "4" || got["limits.memory"] != "4GiB" {
+		t.Errorf("InstanceConfig %v", got)
+	}
+	want := "/opt/odoo/odoo/addons,/opt/odoo/design-themes,/opt/odoo/industry,/opt/odoo/addons,/opt/odoo/extra/oca-web"
+	if got := p.AddonsPath(); got != want {
+		t.Errorf("AddonsPath %q, want %q", got, want)
+	}
+	if got := p.Addons[0].HostPath(dir); got != filepath.Join(filepath.Dir(dir), "oca", "web") {
+		t.Errorf("HostPath %q", got)
+	}
+}
+
+func TestProjectValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		project OdaProject
+		wantErr string
+	}{
+		{"minimal", OdaProject{Version: "17.0"}, ""},
+		{"no version", OdaProject{}, "version is required"},
+		{"unknown version", OdaProject{Version: "9.0"}, "unknown version"},
+		{"newer schema", OdaProject{Schema: ProjectSchema + 1, Version: "17.0"}, "newer"},
+		{"edition", OdaProject{Version: "17.0", Edition: "ultimate"}, "unknown edition"},
+		{"database", OdaProject{Version: "17.0", Database: "a b"}, "invalid database"},
+		{"cpu", OdaProject{Version: "17.0", Limits: &OdaProjectLimits{CPU: "0"}}, "invalid cpu"},
+		{"memory", OdaProject{Version: "17.0", Limits: &OdaProjectLimits{Memory: "lots"}}, "invalid memory"},
+		{"addons name", OdaProject{Version: "17.0", Addons: []OdaAddons{{Name: "A/B", Path: "x"}}}, "invalid addons name"},
+		{"addons duplicate", OdaProject{Version: "17.0", Addons: []OdaAddons{{Name: "a", Path: "x"}, {Name: "a", Path: "y"}}}, "duplicate"},
+		{"addons path", OdaProject{Version: "17.0", Addons: []OdaAddons{{Name: "a"}}}, "no path"},
+		{"module", OdaProject{Version: "17.0", Modules: []string{"sale,crm"}}, "invalid module"},
+		{"expose", OdaProject{Version: "17.0", Expose: &OdaExpose{HTTPPort: 18000}}, "invalid expose port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.project.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
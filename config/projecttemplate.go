@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectTemplatesEmbedded is the source of the project templates built
+// into oda
+const ProjectTemplatesEmbedded = "embedded"
+
+// projectTemplateFile describes a template and is not copied
+const projectTemplateFile = "template.yaml"
+
+// templateSuffix marks the files rendered with text/template, other files
+// are copied as they are, paths are always rendered
+const templateSuffix = ".tmpl"
+
+//go:embed all:projecttemplates
+var embeddedProjectTemplates embed.FS
+
+var templateNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ProjectTemplate is a set of files oda project init adds to a new project
+type ProjectTemplate struct {
+	Name        string `yaml:"-"`
+	Description string `yaml:"description"`
+	// EditorSettings writes the pyright and vscode settings of the project
+	EditorSettings bool `yaml:"editor_settings"`
+	// Source is the directory the template was loaded from
+	Source string `yaml:"-"`
+
+	files fs.FS
+}
+
+// ProjectTemplateData is what the template files are rendered with
+type ProjectTemplateData struct {
+	// Name is the project name
+	Name string
+	// Module is the project name usable as a python module name
+	Module   string
+	Version  string
+	Edition  string
+	Database string
+}
+
+// NewProjectTemplateData is the template data of a project
+func NewProjectTemplateData(projectName string, project *OdaProject) ProjectTemplateData {
+	return ProjectTemplateData{
+		Name:     projectName,
+		Module:   strings.ReplaceAll(projectName, "-", "_"),
+		Version:  project.Version,
+		Edition:  project.Edition,
+		Database: project.Database,
+	}
+}
+
+// ProjectTemplatesDir holds the user project templates, next to oda.yaml
+func ProjectTemplatesDir() (string, error) {
+	odaFile, err := OdaConfigFile()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(odaFile), "templates"), nil
+}
+
+// LoadProjectTemplates lists the embedded and user project templates by
+// name, a user template replaces the embedded one of the same name
+func LoadProjectTemplates() ([]*ProjectTemplate, error) {
+	embedded, err := fs.Sub(embeddedProjectTemplates, "projecttemplates")
+	if err != nil {
+		return nil, err
+	}
+	templates, err := loadProjectTemplates(embedded, ProjectTemplatesEmbedded)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ProjectTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return sortProjectTemplates(templates), nil
+	}
+	userTemplates, err := loadProjectTemplates(os.DirFS(dir), dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, tmpl := range userTemplates {
+		templates[name] = tmpl
+	}
+	return sortProjectTemplates(templates), nil
+}
+
+// GetProjectTemplate is the project template called name
+func GetProjectTemplate(name string) (*ProjectTemplate, error) {
+	templates, err := LoadProjectTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for _, tmpl := range templates {
+		if tmpl.Name == name {
+			return tmpl, nil
+		}
+	}
+	return nil, fmt.Errorf("project template %s not found, use oda project templates list", name)
+}
+
+// loadProjectTemplates reads each directory of fsys as a template
+func loadProjectTemplates(fsys fs.FS, source string) (map[string]*ProjectTemplate, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read project templates %s: %w", source, err)
+	}
+	templates := map[string]*ProjectTemplate{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if !templateNameRe.MatchString(entry.Name()) {
+			return nil, fmt.Errorf("invalid project template name %s in %s", entry.Name(), source)
+		}
+		files, err := fs.Sub(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		tmpl := &ProjectTemplate{Name: entry.Name(), Source: source, files: files}
+		data, err := fs.ReadFile(files, projectTemplateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not read %s of template %s: %w", projectTemplateFile, entry.Name(), err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(tmpl); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("could not unmarshal %s of template %s: %w", projectTemplateFile, entry.Name(), err)
+		}
+		templates[entry.Name()] = tmpl
+	}
+	return templates, nil
+}
+
+func sortProjectTemplates(templates map[string]*ProjectTemplate) []*ProjectTemplate {
+	sorted := make([]*ProjectTemplate, 0, len(templates))
+	for _, tmpl := range templates {
+		sorted = append(sorted, tmpl)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// Render writes the template files into the project dir and returns them,
+// nothing is written when a file fails to render or is already there
+func (t *ProjectTemplate) Render(dir string, data ProjectTemplateData) ([]string, error) {
+	rendered := map[string][]byte{}
+	err := fs.WalkDir(t.files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || name == projectTemplateFile {
+			return nil
+		}
+		target, err := renderTemplate(name, []byte(name), data)
+		if err != nil {
+			return err
+		}
+		content, err := fs.ReadFile(t.files, name)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, templateSuffix) {
+			if content, err = renderTemplate(name, content, data); err != nil {
+				return err
+			}
+			target = bytes.TrimSuffix(target, []byte(templateSuffix))
+		}
+		file := path.Clean(string(target))
+		if !filepath.IsLocal(file) {
+			return fmt.Errorf("%s renders outside the project: %s", name, file)
+		}
+		rendered[file] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("project template %s: %w", t.Name, err)
+	}
+
+	files := make([]string, 0, len(rendered))
+	for file := range rendered {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return nil, fmt.Errorf("project template %s: %s already exists", t.Name, file)
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		target := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, fmt.Errorf("cannot create %s %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, rendered[file], 0o644); err != nil {
+			return nil, fmt.Errorf("cannot write %s %w", target, err)
+		}
+	}
+	return files, nil
+}
+
+func renderTemplate(name string, text []byte, data ProjectTemplateData) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %w", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("cannot render %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useProjectTemplate writes the files of a user project template
+func useProjectTemplate(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	dir, err := ProjectTemplatesDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		path := filepath.Join(dir, name, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadProjectTemplates(t *testing.T) {
+	useConfigFile(t, "")
+	useProjectTemplate(t, "customer", map[string]string{"template.yaml": "description: our customers\n"})
+	useProjectTemplate(t, "shop", map[string]string{"README.md": "shop\n"})
+
+	templates, err := LoadProjectTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ProjectTemplatesDir()
+	names := []string{}
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+		if tmpl.Source != dir {
+			t.Errorf("%s source %s, want %s", tmpl.Name, tmpl.Source, dir)
+		}
+	}
+	if strings.Join(names, ",") != "customer,shop" {
+		t.Errorf("templates %v, want customer,shop", names)
+	}
+	if templates[0].Description != "our customers" {
+		t.Errorf("customer description %q, the user template should replace the embedded one", templates[0].Description)
+	}
+}
+
+func TestGetProjectTemplate(t *testing.T) {
+	useConfigFile(t, "")
+	tmpl, err := GetProjectTemplate("customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Source != ProjectTemplatesEmbedded || !tmpl.EditorSettings {
+		t.Errorf("customer %+v, want embedded with editor settings", tmpl)
+	}
+	if _, err := GetProjectTemplate("shop"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("unknown template: %v", err)
+	}
+
+	useProjectTemplate(t, "shop", map[string]string{"template.yaml": "descripton: typo\n"})
+	if _, err := GetProjectTemplate("shop"); err == nil {
+		t.Error("unknown field in template.yaml should fail")
+	}
+}
+
+func TestProjectTemplateRender(t *testing.T) {
+	useConfigFile(t, "")
+	useProjectTemplate(t, "shop", map[string]string{
+		"template.yaml":                          "description: web shop\n",
+		"addons/{{.Module}}_shop/__init__.py":    "",
+		"addons/{{.Module}}_shop/README.md.tmpl": "{{.Name}} {{.Edition}} {{.Version}} on {{.Database}}\n",
+		".github/workflow.yml":                   "run: ${{ github.ref }}\n",
+	})
+	tmpl, err := GetProjectTemplate("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := NewProjectTemplateData("acme-shop", &OdaProject{Version: "17.0", Edition: "community", Database: "acme"})
+	dir := t.TempDir()
+
+	files, err := tmpl.Render(dir, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ".github/workflow.yml,addons/acme_shop_shop/README.md,addons/acme_shop_shop/__init__.py"
+	if strings.Join(files, ",") != want {
+		t.Errorf("files %v, want %s", files, want)
+	}
+	for file, content := range map[string]string{
+		"addons/acme_shop_shop/README.md": "acme-shop community 17.0 on acme\n",
+		".github/workflow.yml":            "run: ${{ github.ref }}\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", file, got, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "template.yaml")); !os.IsNotExist(err) {
+		t.Error("template.yaml should not be copied")
+	}
+
+	conflict := t.TempDir()
+	if err := os.WriteFile(filepath.Join(conflict, ".github"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(conflict, "addons", "acme_shop_shop"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(conflict, "addons", "acme_shop_shop", "README.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Render(conflict, data); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("existing file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(conflict, "addons", "acme_shop_shop", "__init__.py")); !os.IsNotExist(err) {
+		t.Error("nothing should be written when a file already exists")
+	}
+}
+
+func TestProjectTemplateRenderErrors(t *testing.T) {
+	useConfigFile(t, "")
+	data := NewProjectTemplateData("acme", &OdaProject{Version: "17.0", Edition: "community"})
+	for want, files := range map[string]map[string]string{
+		"cannot parse":        {"README.md.tmpl": "{{.Name"},
+		"cannot render":       {"README.md.tmpl": "{{.Customer}}"},
+		"outside the project": {`{{".."}}/escape.txt`: ""},
+	} {
+		os.RemoveAll(filepath.Join(filepath.Dir(configFile), "templates"))
+		useProjectTemplate(t, "broken", files)
+		tmpl, err := GetProjectTemplate("broken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if _, err := tmpl.Render(dir, data); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%v: %v, want %s", files, err, want)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%v: wrote %d entries", files, len(entries))
+		}
+	}
+}
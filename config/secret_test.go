@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/secret"
+)
+
+func TestLoadOdaConfigSecrets(t *testing.T) {
+	file := useConfigFile(t, "database:\n  host: db\n  password: secret://db/password\nsecrets:\n  backend: file\n")
+	store, err := OpenSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Backend() != secret.BackendFile {
+		t.Fatalf("backend %s", store.Backend())
+	}
+
+	// an unresolved reference is reported with the config
+	odaConf, err := LoadOdaConfig()
+	if err == nil || odaConf == nil || odaConf.Database.Password != "secret://db/password" {
+		t.Fatalf("missing secret: %v %+v", err, odaConf)
+	}
+
+	if err := store.Set("db/password", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(file), "secrets.age")); err != nil {
+		t.Error("secrets not kept next to oda.yaml")
+	}
+	if odaConf, err = LoadOdaConfig(); err != nil || odaConf.Database.Password != "s3cret" {
+		t.Errorf("password %q, %v", odaConf.Database.Password, err)
+	}
+	// config show and saving see the reference
+	if sourced, _, _ := LoadOdaConfigSources(); sourced.Database.Password != "secret://db/password" {
+		t.Errorf("sources password %q", sourced.Database.Password)
+	}
+	if got, err := ResolveSecret("secret://db/password"); err != nil || got != "s3cret" {
+		t.Errorf("ResolveSecret = %q, %v", got, err)
+	}
+	if got, _ := ResolveSecret("admin"); got != "admin" {
+		t.Errorf("plain value resolved to %q", got)
+	}
+}
+
+func TestProjectConfigSecrets(t *testing.T) {
+	useConfigFile(t, "secrets:\n  backend: file\n")
+	store, err := OpenSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("addons/oca", "/srv/oca")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".oda.yaml")
+	os.WriteFile(file, []byte("schema: 2\nversion: \"17.0\"\nedition: community\ndatabase: p1_local\naddons:\n  - name: oca\n    path: secret://addons/oca\n"), 0o644)
+
+	project, err := LoadProjectConfigFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Addons[0].Path != "/srv/oca" {
+		t.Errorf("addons path %q", project.Addons[0].Path)
+	}
+
+	project.Modules = []string{"sale"}
+	if err := project.WriteConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "path: secret://addons/oca") || strings.Contains(string(content), "/srv/oca") {
+		t.Errorf("secret written to .oda.yaml\n%s", content)
+	}
+	if project.Addons[0].Path != "/srv/oca" {
+		t.Error("WriteConfig changed the loaded project")
+	}
+}
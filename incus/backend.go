@@ -0,0 +1,65 @@
+package incus
+
+import "io"
+
+// InstanceManager creates, removes and controls instances
+type InstanceManager interface {
+	GetInstance(instanceName string) (Instance, error)
+	GetInstances(filter InstanceFilter) ([]Instance, error)
+	GetInstanceState(instanceName string) (IncusInstanceStatus, error)
+	SetInstanceState(instanceName string, state string) error
+	CreateInstance(instanceName string, source string, instanceType string, profiles []string, instanceConfig map[string]string) error
+	CreateInstanceFromImage(instanceName string, image string, instanceType string, instanceConfig map[string]string) error
+	CopyInstance(sourceName string, instanceName string) error
+	DeleteInstance(instanceName string) error
+	InstanceMounts(project string) error
+	AddInstanceDevices(instanceName string, devices map[string]map[string]string) error
+	RemoveInstanceDevices(instanceName string, names ...string) error
+}
+
+// Executor runs commands inside instances
+type Executor interface {
+	Exec(instanceName string, opts ExecOptions, command ...string) error
+	IncusExec(instanceName string, args ...string) error
+	IncusExecVerbose(instanceName string, args ...string) error
+	IncusGetUid(instanceName, username string) (int, error)
+	IncusGetGid(instanceName, username string) (int, error)
+}
+
+// FileManager transfers files to and from instances
+type FileManager interface {
+	PushFile(instanceName, filePath string, content io.Reader, opts FileOptions) error
+	PullFile(instanceName, filePath string, w io.Writer) error
+	MkdirAll(instanceName, dirPath string, opts FileOptions) error
+}
+
+// SnapshotManager handles instance snapshots
+type SnapshotManager interface {
+	GetSnapshots(instanceName string) ([]Snapshot, error)
+	CreateSnapshot(instanceName, snapshotName string) error
+	RestoreSnapshot(instanceName, snapshotName string) error
+	DeleteSnapshot(instanceName, snapshotName string) error
+}
+
+// ImageManager handles published images and their aliases
+type ImageManager interface {
+	GetImages() ([]Image, error)
+	PublishImage(instanceName string, properties map[string]string) (string, error)
+	GetImageAlias(alias string) (string, error)
+	SetImageAlias(alias, fingerprint, description string) error
+	DeleteImage(fingerprint string) error
+}
+
+// Backend is everything oda needs from the container host,
+// Incus is the real implementation
+type Backend interface {
+	InstanceManager
+	Executor
+	FileManager
+	SnapshotManager
+	ImageManager
+	EnsureProject() error
+	SyncProfile() error
+}
+
+var _ Backend = (*Incus)(nil)
@@ -0,0 +1,249 @@
+package incus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds how long a single API call, including the wait on
+// any background operation it started, may take
+const DefaultTimeout = 10 * time.Minute
+
+// operation status codes returned by the Incus API
+const (
+	operationSuccess   = 200
+	operationFailure   = 400
+	operationCancelled = 401
+)
+
+// IncusResponse is the envelope common to every Incus API response
+type IncusResponse struct {
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	StatusCode int             `json:"status_code"`
+	Operation  string          `json:"operation"`
+	ErrorCode  int             `json:"error_code"`
+	Error      string          `json:"error"`
+	Metadata   json.RawMessage `json:"metadata"`
+}
+
+// IncusOperation is the metadata of a background operation
+type IncusOperation struct {
+	ID          string `json:"id"`
+	Class       string `json:"class"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Status      string `json:"status"`
+	StatusCode  int    `json:"status_code"`
+	Resources   struct {
+		Containers []string `json:"containers"`
+		Instances  []string `json:"instances"`
+	} `json:"resources"`
+	Metadata  map[string]any `json:"metadata"`
+	MayCancel bool           `json:"may_cancel"`
+	Err       string         `json:"err"`
+	Location  string         `json:"location"`
+}
+
+// IncusError is returned when the Incus API rejects a request
+// or a background operation does not complete successfully
+type IncusError struct {
+	Method  string
+	Path    string
+	Code    int
+	Message string
+}
+
+func (e *IncusError) Error() string {
+	return fmt.Sprintf("incus %s %s: %s (%d)", e.Method, e.Path, e.Message, e.Code)
+}
+
+// IsNotFound reports whether err is an Incus "not found" error
+func IsNotFound(err error) bool {
+	var incusErr *IncusError
+	return errors.As(err, &incusErr) && incusErr.Code == http.StatusNotFound
+}
+
+// httpClient returns the client for the configured connection type,
+// it is built once so connections to the server are reused
+func (i *Incus) httpClient() (*http.Client, error) {
+	if i.client != nil {
+		return i.client, nil
+	}
+	transport := &http.Transport{}
+	switch i.OdaConf.Incus.Type {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", i.OdaConf.Incus.Socket)
+		}
+	case "https":
+		tlsConfig, err := i.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyFromEnvironment
+		transport.TLSClientConfig = tlsConfig
+	default:
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	i.client = &http.Client{Transport: transport}
+	return i.client, nil
+}
+
+// apiURL joins urlparam onto the configured API url
+// and scopes it to the configured Incus project
+func (i *Incus) apiURL(urlparam ...string) (*url.URL, error) {
+	urlpath, err := url.JoinPath(i.OdaConf.Incus.URL, urlparam...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid incus url %w", err)
+	}
+	u, err := url.Parse(urlpath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid incus url %w", err)
+	}
+	if i.OdaConf.Incus.Project != "" {
+		query := u.Query()
+		query.Set("project", i.OdaConf.Incus.Project)
+		u.RawQuery = query.Encode()
+	}
+	return u, nil
+}
+
+// request sends a single request to the Incus API and decodes the response
+// envelope, an error response is returned as an *IncusError
+func (i *Incus) request(ctx context.Context, verb string, body io.Reader, u *url.URL) (*IncusResponse, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, verb, u.String(), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return i.do(req)
+}
+
+// do sends req and decodes the response envelope
+func (i *Incus) do(req *http.Request) (*IncusResponse, []byte, error) {
+	client, err := i.httpClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error sending request %w", err)
+	}
+	defer response.Body.Close()
+	return decodeResponse(req, response)
+}
+
+// decodeResponse reads the response envelope of req
+func decodeResponse(req *http.Request, response *http.Response) (*IncusResponse, []byte, error) {
+	respBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response %w", err)
+	}
+
+	var resp IncusResponse
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		if response.StatusCode >= http.StatusBadRequest {
+			return nil, nil, &IncusError{Method: req.Method, Path: req.URL.Path, Code: response.StatusCode, Message: response.Status}
+		}
+		return nil, nil, fmt.Errorf("error unmarshalling response from %s %w", req.URL.Path, err)
+	}
+	if resp.Type == "error" || response.StatusCode >= http.StatusBadRequest {
+		code := resp.ErrorCode
+		if code == 0 {
+			code = response.StatusCode
+		}
+		return nil, nil, &IncusError{Method: req.Method, Path: req.URL.Path, Code: code, Message: resp.Error}
+	}
+	return &resp, respBytes, nil
+}
+
+// Incusapi calls the Incus API and returns the raw response body,
+// when Incus starts a background operation the call blocks until
+// the operation has finished or the client timeout has expired
+func (i *Incus) Incusapi(verb string, data string, urlparam ...string) ([]byte, error) {
+	return i.IncusapiQuery(verb, data, nil, urlparam...)
+}
+
+// IncusapiQuery is Incusapi with query parameters added to the url
+func (i *Incus) IncusapiQuery(verb string, data string, query url.Values, urlparam ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+
+	u, err := i.apiURL(urlparam...)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		values := u.Query()
+		for k, v := range query {
+			values[k] = v
+		}
+		u.RawQuery = values.Encode()
+	}
+
+	var body io.Reader
+	if data != "" {
+		body = strings.NewReader(data)
+	}
+
+	resp, respBytes, err := i.request(ctx, verb, body, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Type == "async" && resp.Operation != "" {
+		if _, err := i.WaitOperation(ctx, resp.Operation); err != nil {
+			return nil, err
+		}
+	}
+	return respBytes, nil
+}
+
+// WaitOperation blocks until the background operation has completed,
+// it returns an error if the operation failed, was cancelled or ctx expired
+func (i *Incus) WaitOperation(ctx context.Context, operation string) (*IncusOperation, error) {
+	u, err := i.apiURL("operations", path.Base(operation), "wait")
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("timeout", "-1")
+	if deadline, ok := ctx.Deadline(); ok {
+		query.Set("timeout", fmt.Sprintf("%d", int(time.Until(deadline).Seconds())+1))
+	}
+	u.RawQuery = query.Encode()
+
+	resp, _, err := i.request(ctx, "GET", nil, u)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out waiting for operation %s", operation)
+		}
+		return nil, err
+	}
+
+	var op IncusOperation
+	if err := json.Unmarshal(resp.Metadata, &op); err != nil {
+		return nil, fmt.Errorf("error unmarshalling operation %s %w", operation, err)
+	}
+
+	switch op.StatusCode {
+	case operationSuccess:
+		return &op, nil
+	case operationFailure, operationCancelled:
+		return &op, &IncusError{Method: "GET", Path: u.Path, Code: op.StatusCode, Message: op.Err}
+	default:
+		return &op, fmt.Errorf("operation %s did not complete, status %s", operation, op.Status)
+	}
+}
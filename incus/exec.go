@@ -0,0 +1,307 @@
+package incus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// ExecOptions describes how a command is run inside an instance
+type ExecOptions struct {
+	User        int
+	Group       int
+	Cwd         string
+	Env         map[string]string
+	Interactive bool
+	Stdin       io.Reader
+	Stdout      io.Writer
+	Stderr      io.Writer
+}
+
+// ExitError carries the non-zero exit status of a command run in an instance
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// execOperation is the metadata of a running exec operation
+type execOperation struct {
+	ID       string `json:"id"`
+	Metadata struct {
+		Fds map[string]string `json:"fds"`
+	} `json:"metadata"`
+}
+
+// websocketURL returns the url of an operation websocket
+func (i *Incus) websocketURL(operationID, secret string) (string, error) {
+	u, err := i.apiURL("operations", operationID, "websocket")
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	query := u.Query()
+	query.Set("secret", secret)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (i *Incus) websocketDialer() (*websocket.Dialer, error) {
+	dialer := &websocket.Dialer{}
+	switch i.OdaConf.Incus.Type {
+	case "unix":
+		dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", i.OdaConf.Incus.Socket)
+		}
+	case "https":
+		tlsConfig, err := i.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLSClientConfig = tlsConfig
+	}
+	return dialer, nil
+}
+
+func (i *Incus) dialOperation(operationID, secret string) (*websocket.Conn, error) {
+	wsURL, err := i.websocketURL(operationID, secret)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := i.websocketDialer()
+	if err != nil {
+		return nil, err
+	}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to operation websocket %w", err)
+	}
+	return conn, nil
+}
+
+// Exec runs command in the instance and streams its input and output
+// through the operation websockets, a non-zero exit status is returned
+// as an *ExitError
+func (i *Incus) Exec(instanceName string, opts ExecOptions, command ...string) error {
+	env := map[string]string{}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+
+	var stdinFd int
+	var isTerminal bool
+	if opts.Interactive {
+		if f, ok := opts.Stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			stdinFd = int(f.Fd())
+			isTerminal = true
+		}
+		if _, ok := env["TERM"]; !ok {
+			env["TERM"] = os.Getenv("TERM")
+			if env["TERM"] == "" {
+				env["TERM"] = "xterm"
+			}
+		}
+	}
+
+	data := map[string]any{
+		"command":            command,
+		"environment":        env,
+		"interactive":        opts.Interactive,
+		"wait-for-websocket": true,
+		"record-output":      false,
+		"user":               opts.User,
+		"group":              opts.Group,
+	}
+	if opts.Cwd != "" {
+		data["cwd"] = opts.Cwd
+	}
+	if isTerminal {
+		if width, height, err := term.GetSize(stdinFd); err == nil {
+			data["width"] = width
+			data["height"] = height
+		}
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+	u, err := i.apiURL("instances", instanceName, "exec")
+	if err != nil {
+		return err
+	}
+	resp, _, err := i.request(ctx, "POST", bytes.NewReader(dataBytes), u)
+	if err != nil {
+		return fmt.Errorf("could not exec in %s %w", instanceName, err)
+	}
+	var op execOperation
+	if err := json.Unmarshal(resp.Metadata, &op); err != nil {
+		return fmt.Errorf("error unmarshalling exec operation %w", err)
+	}
+
+	control, err := i.dialOperation(op.ID, op.Metadata.Fds["control"])
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+
+	if opts.Interactive {
+		err = i.execInteractive(op, control, opts, stdinFd, isTerminal)
+	} else {
+		err = i.execPiped(op, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the command runs until the operation finishes, no client timeout applies
+	result, err := i.WaitOperation(context.Background(), resp.Operation)
+	if err != nil {
+		return fmt.Errorf("exec in %s failed %w", instanceName, err)
+	}
+	if code, ok := result.Metadata["return"].(float64); ok && code != 0 {
+		return &ExitError{Code: int(code)}
+	}
+	return nil
+}
+
+// execInteractive attaches a single bidirectional websocket to the terminal
+func (i *Incus) execInteractive(op execOperation, control *websocket.Conn, opts ExecOptions, stdinFd int, isTerminal bool) error {
+	conn, err := i.dialOperation(op.ID, op.Metadata.Fds["0"])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if isTerminal {
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("could not set terminal raw mode %w", err)
+		}
+		defer term.Restore(stdinFd, oldState)
+
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		defer signal.Stop(resize)
+		go func() {
+			for range resize {
+				width, height, err := term.GetSize(stdinFd)
+				if err != nil {
+					continue
+				}
+				control.WriteJSON(map[string]any{
+					"command": "window-resize",
+					"args": map[string]string{
+						"width":  strconv.Itoa(width),
+						"height": strconv.Itoa(height),
+					},
+				})
+			}
+		}()
+	}
+
+	if opts.Stdin != nil {
+		go copyToWebsocket(conn, opts.Stdin)
+	}
+	return copyFromWebsocket(writerOrDiscard(opts.Stdout), conn)
+}
+
+// execPiped attaches separate websockets to stdin, stdout and stderr
+func (i *Incus) execPiped(op execOperation, opts ExecOptions) error {
+	conns := make([]*websocket.Conn, 3)
+	for fd := range conns {
+		conn, err := i.dialOperation(op.ID, op.Metadata.Fds[strconv.Itoa(fd)])
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conns[fd] = conn
+	}
+
+	stdin := opts.Stdin
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	go copyToWebsocket(conns[0], stdin)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for n, w := range []io.Writer{opts.Stdout, opts.Stderr} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[n] = copyFromWebsocket(writerOrDiscard(w), conns[n+1])
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// copyToWebsocket sends r to the websocket and signals end of input
+func copyToWebsocket(conn *websocket.Conn, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte{})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// copyFromWebsocket writes websocket messages to w until the stream ends
+func copyFromWebsocket(w io.Writer, conn *websocket.Conn) error {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) || errors.Is(err, io.EOF) ||
+				errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("error reading exec output %w", err)
+		}
+		if messageType == websocket.TextMessage {
+			return nil
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("error writing exec output %w", err)
+		}
+	}
+}
+
+func writerOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
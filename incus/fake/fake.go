@@ -0,0 +1,673 @@
+// Package fake provides an in-memory incus.Backend that records every call,
+// it lets the command flows run in tests without an Incus host
+package fake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+)
+
+// Call is a single recorded backend call
+type Call struct {
+	Method string
+	Args   []string
+	// Stdin holds what an Exec call read from its input
+	Stdin string
+}
+
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Method}, c.Args...), " ")
+}
+
+// Instance is the state kept for a fake instance
+type Instance struct {
+	Name  string
+	State string
+	// Type is container or virtual-machine
+	Type      string
+	IP4       string
+	IP6       string
+	Source    string
+	Profiles  []string
+	Config    map[string]string
+	Devices   map[string]map[string]string
+	Snapshots []incus.Snapshot
+}
+
+// Backend is an in-memory incus.Backend
+type Backend struct {
+	mu sync.Mutex
+
+	Instances map[string]*Instance
+	Images    []incus.Image
+	Aliases   map[string]string
+	// Files holds pushed file content by instance and path
+	Files map[string][]byte
+	// Dirs holds directories created by MkdirAll by instance and path
+	Dirs map[string]incus.FileOptions
+	// UIDs maps user names to the uid IncusGetUid returns
+	UIDs map[string]int
+	// GIDs maps user names to the gid IncusGetGid returns
+	GIDs  map[string]int
+	Calls []Call
+
+	// ExecFunc handles Exec when set, by default commands succeed silently
+	ExecFunc func(instanceName string, opts incus.ExecOptions, command ...string) error
+	// Errors makes the named method fail with the given error
+	Errors map[string]error
+}
+
+var _ incus.Backend = (*Backend)(nil)
+
+// New returns an empty fake backend
+func New() *Backend {
+	return &Backend{
+		Instances: map[string]*Instance{},
+		Aliases:   map[string]string{},
+		Files:     map[string][]byte{},
+		Dirs:      map[string]incus.FileOptions{},
+		UIDs:      map[string]int{"root": 0, "odoo": 1001, "postgres": 999},
+		GIDs:      map[string]int{"root": 0, "odoo": 1002, "postgres": 998},
+		Errors:    map[string]error{},
+	}
+}
+
+// AddInstance adds an instance in the given state, Running or Stopped
+func (b *Backend) AddInstance(name, state string) *Instance {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	inst := &Instance{
+		Name:    name,
+		State:   state,
+		Type:    config.InstanceTypeContainer,
+		IP4:     fmt.Sprintf("10.0.0.%d", len(b.Instances)+2),
+		Config:  map[string]string{},
+		Devices: map[string]map[string]string{},
+	}
+	b.Instances[name] = inst
+	return inst
+}
+
+// CallsTo returns the recorded calls of method as strings
+func (b *Backend) CallsTo(method string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calls := []string{}
+	for _, call := range b.Calls {
+		if call.Method == method {
+			calls = append(calls, call.String())
+		}
+	}
+	return calls
+}
+
+// record logs the call and returns the error configured for method
+func (b *Backend) record(method string, args ...string) error {
+	b.Calls = append(b.Calls, Call{Method: method, Args: args})
+	return b.Errors[method]
+}
+
+func notFound(path string) error {
+	return &incus.IncusError{Method: "GET", Path: path, Code: http.StatusNotFound, Message: "not found"}
+}
+
+func conflict(path string) error {
+	return &incus.IncusError{Method: "POST", Path: path, Code: http.StatusConflict, Message: "already exists"}
+}
+
+func badRequest(path, message string) error {
+	return &incus.IncusError{Method: "POST", Path: path, Code: http.StatusBadRequest, Message: message}
+}
+
+// view is the instance as the backend reports it
+func (inst *Instance) view() incus.Instance {
+	state := inst.state()
+	return incus.NewInstance(incus.InstanceFull{
+		Name:   inst.Name,
+		Status: inst.State,
+		Type:   inst.Type,
+		Config: inst.Config,
+		State:  &state,
+	})
+}
+
+// state is the runtime state, eth0 carries a link local ipv6 address
+// ahead of the global ones like a real container does
+func (inst *Instance) state() incus.InstanceState {
+	addresses := []incus.NetworkAddress{
+		{Family: "inet6", Address: "fe80::216:3eff:fe00:1", Netmask: "64", Scope: "link"},
+	}
+	if inst.IP6 != "" {
+		addresses = append(addresses, incus.NetworkAddress{Family: "inet6", Address: inst.IP6, Netmask: "64", Scope: "global"})
+	}
+	if inst.IP4 != "" {
+		addresses = append(addresses, incus.NetworkAddress{Family: "inet", Address: inst.IP4, Netmask: "24", Scope: "global"})
+	}
+	return incus.InstanceState{
+		Status:  inst.State,
+		Network: map[string]incus.InstanceNetwork{"eth0": {Addresses: addresses, State: "up", Type: "broadcast"}},
+	}
+}
+
+func (b *Backend) instance(name string) (*Instance, error) {
+	inst, ok := b.Instances[name]
+	if !ok {
+		return nil, notFound("/1.0/instances/" + name)
+	}
+	return inst, nil
+}
+
+func (b *Backend) GetInstance(instanceName string) (incus.Instance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetInstance", instanceName); err != nil {
+		return incus.Instance{}, err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return incus.Instance{}, err
+	}
+	return inst.view(), nil
+}
+
+func (b *Backend) GetInstances(filter incus.InstanceFilter) ([]incus.Instance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetInstances"); err != nil {
+		return []incus.Instance{}, err
+	}
+	instances := []incus.Instance{}
+	for _, inst := range b.Instances {
+		if instance := inst.view(); filter.Match(instance) {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances, nil
+}
+
+func (b *Backend) GetInstanceState(instanceName string) (incus.IncusInstanceStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetInstanceState", instanceName); err != nil {
+		return incus.IncusInstanceStatus{}, err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return incus.IncusInstanceStatus{}, err
+	}
+	return incus.IncusInstanceStatus{Type: "sync", Metadata: inst.state()}, nil
+}
+
+func (b *Backend) SetInstanceState(instanceName string, state string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("SetInstanceState", instanceName, state); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case "start", "restart", "unfreeze":
+		inst.State = "Running"
+	case "stop":
+		inst.State = "Stopped"
+	case "freeze":
+		inst.State = "Frozen"
+	default:
+		return fmt.Errorf("unknown instance state action %s", state)
+	}
+	return nil
+}
+
+func (b *Backend) CreateInstance(instanceName string, source string, instanceType string, profiles []string, instanceConfig map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("CreateInstance", instanceName, source, instanceType); err != nil {
+		return err
+	}
+	if _, ok := b.Instances[instanceName]; ok {
+		return conflict("/1.0/instances")
+	}
+	inst := &Instance{
+		Name:     instanceName,
+		State:    "Running",
+		Type:     instanceType,
+		IP4:      fmt.Sprintf("10.0.0.%d", len(b.Instances)+2),
+		Source:   source,
+		Profiles: profiles,
+		Config:   map[string]string{},
+		Devices:  map[string]map[string]string{},
+	}
+	for k, v := range instanceConfig {
+		inst.Config[k] = v
+	}
+	inst.Config[incus.ManagedKey] = "true"
+	b.Instances[instanceName] = inst
+	return nil
+}
+
+func (b *Backend) CreateInstanceFromImage(instanceName string, image string, instanceType string, instanceConfig map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("CreateInstanceFromImage", instanceName, image, instanceType); err != nil {
+		return err
+	}
+	if !b.hasImage(image) {
+		return notFound("/1.0/images/aliases/" + image)
+	}
+	if _, ok := b.Instances[instanceName]; ok {
+		return conflict("/1.0/instances")
+	}
+	b.Instances[instanceName] = &Instance{
+		Name:     instanceName,
+		State:    "Stopped",
+		Type:     instanceType,
+		IP4:      fmt.Sprintf("10.0.0.%d", len(b.Instances)+2),
+		Source:   image,
+		Profiles: []string{"default", incus.ProfileFor(instanceType)},
+		Config:   map[string]string{incus.ManagedKey: "true"},
+		Devices:  map[string]map[string]string{},
+	}
+	for k, v := range instanceConfig {
+		b.Instances[instanceName].Config[k] = v
+	}
+	return nil
+}
+
+// hasImage finds an image by alias or fingerprint prefix
+func (b *Backend) hasImage(image string) bool {
+	if _, ok := b.Aliases[image]; ok {
+		return true
+	}
+	if !incus.IsFingerprint(image) {
+		return false
+	}
+	for _, img := range b.Images {
+		if strings.HasPrefix(img.Fingerprint, image) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) CopyInstance(sourceName string, instanceName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("CopyInstance", sourceName, instanceName); err != nil {
+		return err
+	}
+	src, err := b.instance(sourceName)
+	if err != nil {
+		return err
+	}
+	if _, ok := b.Instances[instanceName]; ok {
+		return conflict("/1.0/instances")
+	}
+	inst := *src
+	inst.Name = instanceName
+	inst.State = "Stopped"
+	inst.Source = sourceName
+	inst.Snapshots = nil
+	b.Instances[instanceName] = &inst
+	return nil
+}
+
+func (b *Backend) DeleteInstance(instanceName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("DeleteInstance", instanceName); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	if inst.State == "Running" {
+		return badRequest("/1.0/instances/"+instanceName, "instance is running")
+	}
+	delete(b.Instances, instanceName)
+	return nil
+}
+
+func (b *Backend) InstanceMounts(project string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("InstanceMounts", project); err != nil {
+		return err
+	}
+	_, err := b.instance(project)
+	return err
+}
+
+func (b *Backend) AddInstanceDevices(instanceName string, devices map[string]map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := []string{}
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := b.record("AddInstanceDevices", append([]string{instanceName}, names...)...); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	for name, device := range devices {
+		inst.Devices[name] = device
+	}
+	return nil
+}
+
+func (b *Backend) RemoveInstanceDevices(instanceName string, names ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("RemoveInstanceDevices", append([]string{instanceName}, names...)...); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		delete(inst.Devices, name)
+	}
+	return nil
+}
+
+func (b *Backend) Exec(instanceName string, opts incus.ExecOptions, command ...string) error {
+	// read the input before taking the lock, it may be fed by a slow producer
+	var stdin string
+	if opts.Stdin != nil && !opts.Interactive {
+		input, err := io.ReadAll(opts.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading exec input %w", err)
+		}
+		stdin = string(input)
+	}
+
+	b.mu.Lock()
+	b.Calls = append(b.Calls, Call{Method: "Exec", Args: append([]string{instanceName}, command...), Stdin: stdin})
+	err := b.Errors["Exec"]
+	if err == nil {
+		var inst *Instance
+		inst, err = b.instance(instanceName)
+		if err == nil && inst.State != "Running" {
+			err = badRequest("/1.0/instances/"+instanceName+"/exec", "instance is not running")
+		}
+	}
+	execFunc := b.ExecFunc
+	b.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if execFunc != nil {
+		return execFunc(instanceName, opts, command...)
+	}
+	return nil
+}
+
+func (b *Backend) IncusExec(instanceName string, args ...string) error {
+	return b.Exec(instanceName, incus.ExecOptions{}, args...)
+}
+
+func (b *Backend) IncusExecVerbose(instanceName string, args ...string) error {
+	return b.Exec(instanceName, incus.ExecOptions{}, args...)
+}
+
+func (b *Backend) IncusGetUid(instanceName, username string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("IncusGetUid", instanceName, username); err != nil {
+		return 0, err
+	}
+	if _, err := b.instance(instanceName); err != nil {
+		return 0, err
+	}
+	uid, ok := b.UIDs[username]
+	if !ok {
+		return 0, fmt.Errorf("could not get uid for %s: user not found", username)
+	}
+	return uid, nil
+}
+
+func (b *Backend) IncusGetGid(instanceName, username string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("IncusGetGid", instanceName, username); err != nil {
+		return 0, err
+	}
+	if _, err := b.instance(instanceName); err != nil {
+		return 0, err
+	}
+	gid, ok := b.GIDs[username]
+	if !ok {
+		return 0, fmt.Errorf("could not get gid for %s: user not found", username)
+	}
+	return gid, nil
+}
+
+func (b *Backend) PushFile(instanceName, filePath string, content io.Reader, opts incus.FileOptions) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("error reading content %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("PushFile", instanceName, filePath, fmt.Sprintf("%d:%d", opts.UID, opts.GID), fmt.Sprintf("%04o", opts.Mode.Perm())); err != nil {
+		return err
+	}
+	if _, err := b.instance(instanceName); err != nil {
+		return err
+	}
+	b.Files[instanceName+":"+filePath] = data
+	return nil
+}
+
+func (b *Backend) PullFile(instanceName, filePath string, w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("PullFile", instanceName, filePath); err != nil {
+		return err
+	}
+	data, ok := b.Files[instanceName+":"+filePath]
+	if !ok {
+		return notFound("/1.0/instances/" + instanceName + "/files")
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (b *Backend) MkdirAll(instanceName, dirPath string, opts incus.FileOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("MkdirAll", instanceName, dirPath); err != nil {
+		return err
+	}
+	if _, err := b.instance(instanceName); err != nil {
+		return err
+	}
+	b.Dirs[instanceName+":"+dirPath] = opts
+	return nil
+}
+
+func (b *Backend) GetSnapshots(instanceName string) ([]incus.Snapshot, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetSnapshots", instanceName); err != nil {
+		return []incus.Snapshot{}, err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return []incus.Snapshot{}, err
+	}
+	return append([]incus.Snapshot{}, inst.Snapshots...), nil
+}
+
+func (b *Backend) CreateSnapshot(instanceName, snapshotName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("CreateSnapshot", instanceName, snapshotName); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range inst.Snapshots {
+		if snapshot.Name == snapshotName {
+			return conflict("/1.0/instances/" + instanceName + "/snapshots")
+		}
+	}
+	inst.Snapshots = append(inst.Snapshots, incus.Snapshot{Name: snapshotName, CreatedAt: time.Now()})
+	return nil
+}
+
+func (b *Backend) RestoreSnapshot(instanceName, snapshotName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("RestoreSnapshot", instanceName, snapshotName); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range inst.Snapshots {
+		if snapshot.Name == snapshotName {
+			return nil
+		}
+	}
+	return notFound("/1.0/instances/" + instanceName + "/snapshots/" + snapshotName)
+}
+
+func (b *Backend) DeleteSnapshot(instanceName, snapshotName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("DeleteSnapshot", instanceName, snapshotName); err != nil {
+		return err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return err
+	}
+	for idx, snapshot := range inst.Snapshots {
+		if snapshot.Name == snapshotName {
+			inst.Snapshots = append(inst.Snapshots[:idx], inst.Snapshots[idx+1:]...)
+			return nil
+		}
+	}
+	return notFound("/1.0/instances/" + instanceName + "/snapshots/" + snapshotName)
+}
+
+func (b *Backend) GetImages() ([]incus.Image, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetImages"); err != nil {
+		return []incus.Image{}, err
+	}
+	images := []incus.Image{}
+	for _, image := range b.Images {
+		image.Aliases = []string{}
+		for alias, fingerprint := range b.Aliases {
+			if fingerprint == image.Fingerprint {
+				image.Aliases = append(image.Aliases, alias)
+			}
+		}
+		sort.Strings(image.Aliases)
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+func (b *Backend) PublishImage(instanceName string, properties map[string]string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("PublishImage", instanceName); err != nil {
+		return "", err
+	}
+	inst, err := b.instance(instanceName)
+	if err != nil {
+		return "", err
+	}
+	if inst.State == "Running" {
+		return "", badRequest("/1.0/images", "instance is running")
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", instanceName, len(b.Images))))
+	fingerprint := hex.EncodeToString(sum[:])
+	props := map[string]string{}
+	for k, v := range properties {
+		props[k] = v
+	}
+	b.Images = append(b.Images, incus.Image{
+		Fingerprint: fingerprint,
+		Properties:  props,
+		CreatedAt:   time.Now(),
+	})
+	return fingerprint, nil
+}
+
+func (b *Backend) GetImageAlias(alias string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("GetImageAlias", alias); err != nil {
+		return "", err
+	}
+	fingerprint, ok := b.Aliases[alias]
+	if !ok {
+		return "", notFound("/1.0/images/aliases/" + alias)
+	}
+	return fingerprint, nil
+}
+
+func (b *Backend) SetImageAlias(alias, fingerprint, description string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("SetImageAlias", alias, fingerprint); err != nil {
+		return err
+	}
+	b.Aliases[alias] = fingerprint
+	return nil
+}
+
+func (b *Backend) DeleteImage(fingerprint string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.record("DeleteImage", fingerprint); err != nil {
+		return err
+	}
+	for idx, image := range b.Images {
+		if image.Fingerprint == fingerprint {
+			b.Images = append(b.Images[:idx], b.Images[idx+1:]...)
+			return nil
+		}
+	}
+	return notFound("/1.0/images/" + fingerprint)
+}
+
+func (b *Backend) EnsureProject() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.record("EnsureProject")
+}
+
+func (b *Backend) SyncProfile() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.record("SyncProfile")
+}
@@ -0,0 +1,167 @@
+package incus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// FileOptions sets the ownership and permissions of a file or directory
+// written to an instance
+type FileOptions struct {
+	UID  int
+	GID  int
+	Mode os.FileMode
+}
+
+// filesRequest builds a request on the instance files endpoint for filePath
+func (i *Incus) filesRequest(ctx context.Context, verb, instanceName, filePath string, body io.Reader) (*http.Request, error) {
+	u, err := i.apiURL("instances", instanceName, "files")
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("path", filePath)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, verb, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request %w", err)
+	}
+	return req, nil
+}
+
+func setFileHeaders(req *http.Request, fileType string, opts FileOptions) {
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Incus-type", fileType)
+	req.Header.Set("X-Incus-uid", strconv.Itoa(opts.UID))
+	req.Header.Set("X-Incus-gid", strconv.Itoa(opts.GID))
+	req.Header.Set("X-Incus-mode", fmt.Sprintf("%04o", opts.Mode.Perm()))
+	req.Header.Set("X-Incus-write", "overwrite")
+}
+
+// PushFile writes content to filePath in the instance,
+// replacing any existing file
+func (i *Incus) PushFile(instanceName, filePath string, content io.Reader, opts FileOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+
+	if opts.Mode == 0 {
+		opts.Mode = 0o644
+	}
+	req, err := i.filesRequest(ctx, "POST", instanceName, filePath, content)
+	if err != nil {
+		return err
+	}
+	setFileHeaders(req, "file", opts)
+	if _, _, err := i.do(req); err != nil {
+		return fmt.Errorf("could not push %s to %s %w", filePath, instanceName, err)
+	}
+	return nil
+}
+
+// PullFile copies the content of filePath in the instance to w
+func (i *Incus) PullFile(instanceName, filePath string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+
+	req, err := i.filesRequest(ctx, "GET", instanceName, filePath, nil)
+	if err != nil {
+		return err
+	}
+	client, err := i.httpClient()
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		_, _, err := decodeResponse(req, response)
+		if err == nil {
+			err = &IncusError{Method: "GET", Path: req.URL.Path, Code: response.StatusCode, Message: response.Status}
+		}
+		return fmt.Errorf("could not pull %s from %s %w", filePath, instanceName, err)
+	}
+	if fileType := response.Header.Get("X-Incus-type"); fileType != "" && fileType != "file" {
+		return fmt.Errorf("could not pull %s from %s: not a file (%s)", filePath, instanceName, fileType)
+	}
+	if _, err := io.Copy(w, response.Body); err != nil {
+		return fmt.Errorf("could not pull %s from %s %w", filePath, instanceName, err)
+	}
+	return nil
+}
+
+// fileType returns the type of filePath in the instance
+func (i *Incus) fileType(ctx context.Context, instanceName, filePath string) (string, error) {
+	req, err := i.filesRequest(ctx, "GET", instanceName, filePath, nil)
+	if err != nil {
+		return "", err
+	}
+	client, err := i.httpClient()
+	if err != nil {
+		return "", err
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode == http.StatusNotFound {
+		return "", &IncusError{Method: "GET", Path: req.URL.Path, Code: response.StatusCode, Message: "not found"}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", &IncusError{Method: "GET", Path: req.URL.Path, Code: response.StatusCode, Message: response.Status}
+	}
+	return response.Header.Get("X-Incus-type"), nil
+}
+
+// MkdirAll creates dirPath in the instance along with any missing parents,
+// only directories that are created get the ownership and mode of opts
+func (i *Incus) MkdirAll(instanceName, dirPath string, opts FileOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+
+	if opts.Mode == 0 {
+		opts.Mode = 0o755
+	}
+
+	current := "/"
+	for _, part := range strings.Split(path.Clean("/"+dirPath), "/") {
+		if part == "" {
+			continue
+		}
+		current = path.Join(current, part)
+
+		fileType, err := i.fileType(ctx, instanceName, current)
+		if err == nil {
+			if fileType != "directory" {
+				return fmt.Errorf("could not create %s in %s: %s is a %s", dirPath, instanceName, current, fileType)
+			}
+			continue
+		}
+		if !IsNotFound(err) {
+			return fmt.Errorf("could not create %s in %s %w", dirPath, instanceName, err)
+		}
+
+		req, err := i.filesRequest(ctx, "POST", instanceName, current, nil)
+		if err != nil {
+			return err
+		}
+		setFileHeaders(req, "directory", opts)
+		if _, _, err := i.do(req); err != nil {
+			return fmt.Errorf("could not create %s in %s %w", current, instanceName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package incus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ppreeper/oda/ui"
+)
+
+type Image struct {
+	Fingerprint string
+	Aliases     []string
+	Properties  map[string]string
+	Size        int64
+	CreatedAt   time.Time
+}
+
+// ShortFingerprint is the abbreviated fingerprint shown by incus image list
+func (img Image) ShortFingerprint() string {
+	return shortFingerprint(img.Fingerprint)
+}
+
+func shortFingerprint(fingerprint string) string {
+	if len(fingerprint) > 12 {
+		return fingerprint[:12]
+	}
+	return fingerprint
+}
+
+// GetImages lists the images in the local image store
+func (i *Incus) GetImages() ([]Image, error) {
+	respBytes, err := i.IncusapiQuery("GET", "", url.Values{"recursion": {"1"}}, "images")
+	if err != nil {
+		return []Image{}, err
+	}
+	var incusImages IncusImages
+	if err := json.Unmarshal(respBytes, &incusImages); err != nil {
+		return []Image{}, fmt.Errorf("error unmarshalling images %w", err)
+	}
+	images := []Image{}
+	for _, v := range incusImages.Metadata {
+		aliases := []string{}
+		for _, alias := range v.Aliases {
+			aliases = append(aliases, alias.Name)
+		}
+		images = append(images, Image{
+			Fingerprint: v.Fingerprint,
+			Aliases:     aliases,
+			Properties:  v.Properties,
+			Size:        v.Size,
+			CreatedAt:   v.CreatedAt,
+		})
+	}
+	return images, nil
+}
+
+// PublishImage turns a stopped instance into an image
+// and returns the fingerprint of the new image
+func (i *Incus) PublishImage(instanceName string, properties map[string]string) (string, error) {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Publishing", instanceName, "as an image"))
+	data := map[string]any{
+		"source": map[string]any{
+			"type": "instance",
+			"name": instanceName,
+		},
+		"properties": properties,
+		"public":     false,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling json %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+	u, err := i.apiURL("images")
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := i.request(ctx, "POST", bytes.NewReader(dataBytes), u)
+	if err != nil {
+		return "", fmt.Errorf("could not publish %s %w", instanceName, err)
+	}
+	op, err := i.WaitOperation(ctx, resp.Operation)
+	if err != nil {
+		return "", fmt.Errorf("could not publish %s %w", instanceName, err)
+	}
+	fingerprint, _ := op.Metadata["fingerprint"].(string)
+	if fingerprint == "" {
+		return "", fmt.Errorf("publish of %s returned no fingerprint", instanceName)
+	}
+	return fingerprint, nil
+}
+
+// GetImageAlias returns the fingerprint of the image alias points at
+func (i *Incus) GetImageAlias(alias string) (string, error) {
+	respBytes, err := i.Incusapi("GET", "", "images", "aliases", alias)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Metadata struct {
+			Target string `json:"target"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return "", fmt.Errorf("error unmarshalling alias %s %w", alias, err)
+	}
+	return resp.Metadata.Target, nil
+}
+
+// SetImageAlias points alias at the image, creating the alias if needed
+func (i *Incus) SetImageAlias(alias, fingerprint, description string) error {
+	data := map[string]any{
+		"target":      fingerprint,
+		"description": description,
+	}
+	_, err := i.GetImageAlias(alias)
+	switch {
+	case IsNotFound(err):
+		data["name"] = alias
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshalling json %w", err)
+		}
+		if _, err := i.Incusapi("POST", string(dataBytes), "images", "aliases"); err != nil {
+			return fmt.Errorf("could not create alias %s %w", alias, err)
+		}
+	case err != nil:
+		return fmt.Errorf("could not get alias %s %w", alias, err)
+	default:
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshalling json %w", err)
+		}
+		if _, err := i.Incusapi("PUT", string(dataBytes), "images", "aliases", alias); err != nil {
+			return fmt.Errorf("could not update alias %s %w", alias, err)
+		}
+	}
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("alias", alias, "->", shortFingerprint(fingerprint)))
+	return nil
+}
+
+// DeleteImage removes the image from the local image store
+func (i *Incus) DeleteImage(fingerprint string) error {
+	fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("deleting image:", shortFingerprint(fingerprint)))
+	if _, err := i.Incusapi("DELETE", "", "images", fingerprint); err != nil {
+		return fmt.Errorf("could not delete image %s %w", fingerprint, err)
+	}
+	return nil
+}
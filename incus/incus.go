@@ -1,17 +1,14 @@
 package incus
 
 import (
-	"context"
+	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
-	"os/user"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,158 +17,141 @@ import (
 	"github.com/ppreeper/oda/ui"
 )
 
+// ManagedKey is the config key that marks instances created by oda
+const ManagedKey = "user.oda.managed"
+
 type Instance struct {
-	Name  string
-	State string
-	IP4   string
+	Name    string
+	State   string
+	Type    string
+	Managed bool
+	// IP4 and IP6 are the primary global addresses, empty when there is none
+	IP4        string
+	IP6        string
+	Interfaces []NetworkInterface
 }
 
-type Incus struct {
-	OdaConf *config.OdaConf
+// InstanceFilter selects instances from a listing, the zero value selects all
+type InstanceFilter struct {
+	// Prefix keeps instances whose name starts with it
+	Prefix string
+	// Managed keeps only instances labelled with ManagedKey
+	Managed bool
 }
 
-func NewIncus(odaconf *config.OdaConf) *Incus {
-	return &Incus{
-		OdaConf: odaconf,
+// Match reports whether the instance passes the filter
+func (f InstanceFilter) Match(instance Instance) bool {
+	if !strings.HasPrefix(instance.Name, f.Prefix) {
+		return false
 	}
+	return !f.Managed || instance.Managed
 }
 
-func (i *Incus) Incusapi(verb string, data string, urlparam ...string) []byte {
-	var response *http.Response
-	var httpc http.Client
-
-	switch i.OdaConf.Incus.Type {
-	case "http":
-		httpc = http.Client{}
-	case "unix":
-		httpc = http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", i.OdaConf.Incus.Socket)
-				},
-			},
-		}
-	}
-
-	urlpath, _ := url.JoinPath(i.OdaConf.Incus.URL, urlparam...)
+type Incus struct {
+	OdaConf *config.OdaConf
+	Timeout time.Duration
 
-	switch verb {
-	case "GET":
-		req, err := http.NewRequest("GET", urlpath, nil)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error creating request", err)
-			return []byte{}
-		}
-		req.Header.Set("Content-Type", "application/json")
-		response, err = httpc.Do(req)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error sending request", err)
-			return []byte{}
-		}
-	case "POST":
-		req, err := http.NewRequest("POST", urlpath, strings.NewReader(data))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error creating request", err)
-			return []byte{}
-		}
-		req.Header.Set("Content-Type", "application/json")
-		response, err = httpc.Do(req)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error sending request", err)
-			return []byte{}
-		}
-	case "PUT":
-		req, err := http.NewRequest("PUT", urlpath, strings.NewReader(data))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error creating request", err)
-			return []byte{}
-		}
-		req.Header.Set("Content-Type", "application/json")
-		response, err = httpc.Do(req)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error sending request", err)
-			return []byte{}
-		}
-	case "DELETE":
-		req, err := http.NewRequest("DELETE", urlpath, nil)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error creating request", err)
-			return []byte{}
-		}
-		req.Header.Set("Content-Type", "application/json")
-		response, err = httpc.Do(req)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error sending request", err)
-			return []byte{}
-		}
-	}
-	defer response.Body.Close()
+	client *http.Client
+}
 
-	respBytes, err := io.ReadAll(response.Body)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error reading response", err)
-		return []byte{}
+func NewIncus(odaconf *config.OdaConf) *Incus {
+	return &Incus{
+		OdaConf: odaconf,
+		Timeout: DefaultTimeout,
 	}
-	return respBytes
 }
 
+// GetInstance fetches the instance and its state in one call
 func (i *Incus) GetInstance(instanceName string) (Instance, error) {
-	respBytes := i.Incusapi("GET", "", "instances", instanceName)
-	var instance IncusInstance
-	if err := json.Unmarshal(respBytes, &instance); err != nil {
-		fmt.Fprintln(os.Stderr, "error unmarshalling json", err)
+	respBytes, err := i.IncusapiQuery("GET", "", url.Values{"recursion": {"1"}}, "instances", instanceName)
+	if err != nil {
 		return Instance{}, err
 	}
-
-	i.Incusapi("GET", "", "instances", instanceName, "state")
-	instanceStatus := i.GetInstanceState(instanceName)
-	var ip4 string
-	if len(instanceStatus.Metadata.Network.Eth0.Addresses) != 0 {
-		ip4 = instanceStatus.Metadata.Network.Eth0.Addresses[0].Address
+	var instance IncusInstanceFull
+	if err := json.Unmarshal(respBytes, &instance); err != nil {
+		return Instance{}, fmt.Errorf("error unmarshalling instance %s %w", instanceName, err)
 	}
-
-	return Instance{
-		Name:  instance.Metadata.Name,
-		State: instance.Metadata.Status,
-		IP4:   ip4,
-	}, nil
+	return NewInstance(instance.Metadata), nil
 }
 
-func (i *Incus) GetInstances() ([]Instance, error) {
-	var instances []Instance
-
-	respBytes := i.Incusapi("GET", "", "instances")
+// GetInstances lists the instances that pass filter, the config and
+// state of every instance come back in a single recursion=2 call
+func (i *Incus) GetInstances(filter InstanceFilter) ([]Instance, error) {
+	respBytes, err := i.IncusapiQuery("GET", "", url.Values{"recursion": {"2"}}, "instances")
+	if err != nil {
+		return []Instance{}, err
+	}
 
-	var incusInstances IncusInstances
+	var incusInstances IncusInstancesFull
 	if err := json.Unmarshal(respBytes, &incusInstances); err != nil {
-		fmt.Fprintln(os.Stderr, "error unmarshalling json", err)
-		return []Instance{}, err
+		return []Instance{}, fmt.Errorf("error unmarshalling instances %w", err)
 	}
+	instances := []Instance{}
 	for _, v := range incusInstances.Metadata {
-		instance, err := i.GetInstance(strings.TrimPrefix(v, "/1.0/instances/"))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error getting instance %w", err)
-			return []Instance{}, err
+		if instance := NewInstance(v); filter.Match(instance) {
+			instances = append(instances, instance)
 		}
-		instances = append(instances, instance)
 	}
 	return instances, nil
 }
 
-func (i *Incus) GetInstanceState(instanceName string) IncusInstanceStatus {
-	respBytes := i.Incusapi("GET", "", "instances", instanceName, "state")
+// NewInstance converts the API instance, the addresses are only
+// filled in when the state was fetched with it
+func NewInstance(full InstanceFull) Instance {
+	instance := Instance{
+		Name:    full.Name,
+		State:   full.Status,
+		Type:    full.Type,
+		Managed: full.ExpandedConfig[ManagedKey] == "true" || full.Config[ManagedKey] == "true",
+	}
+	if full.State != nil {
+		instance.Interfaces = full.State.Interfaces()
+		instance.IP4 = primaryAddress(instance.Interfaces, "inet")
+		instance.IP6 = primaryAddress(instance.Interfaces, "inet6")
+	}
+	return instance
+}
+
+func (i *Incus) GetInstanceState(instanceName string) (IncusInstanceStatus, error) {
+	respBytes, err := i.Incusapi("GET", "", "instances", instanceName, "state")
+	if err != nil {
+		return IncusInstanceStatus{}, err
+	}
 	var instanceStatus IncusInstanceStatus
 	if err := json.Unmarshal(respBytes, &instanceStatus); err != nil {
-		fmt.Fprintln(os.Stderr, "error unmarshalling json", err)
-		return IncusInstanceStatus{}
+		return IncusInstanceStatus{}, fmt.Errorf("error unmarshalling state of %s %w", instanceName, err)
 	}
-	return instanceStatus
+	return instanceStatus, nil
 }
 
 // SetInstanceState changes the state of the instance
 // possible state values: start, stop, restart, freeze, unfreeze
 // running values are: RUNNING, STOPPED, FROZEN
-func (i *Incus) SetInstanceState(instanceName string, state string) {
+func (i *Incus) SetInstanceState(instanceName string, state string) error {
+	var containeState string
+	switch state {
+	case "start", "restart", "unfreeze":
+		containeState = "RUNNING"
+	case "stop":
+		containeState = "STOPPED"
+	case "freeze":
+		containeState = "FROZEN"
+	default:
+		return fmt.Errorf("unknown instance state action %s", state)
+	}
+
+	currentState, err := i.GetInstanceState(instanceName)
+	if err != nil {
+		return err
+	}
+	if state != "restart" && strings.EqualFold(currentState.Metadata.Status, containeState) {
+		// a virtual machine that was just started may still be booting
+		if containeState == "RUNNING" {
+			return i.WaitForAgent(instanceName)
+		}
+		return nil
+	}
+
 	data := map[string]any{
 		"action":   state,
 		"force":    false,
@@ -180,62 +160,96 @@ func (i *Incus) SetInstanceState(instanceName string, state string) {
 	}
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error marshalling json", err)
-		return
-	}
-	respBytes := i.Incusapi("PUT", string(dataBytes), "instances", instanceName, "state")
-	var instanceStatus IncusInstanceStatus
-	if err := json.Unmarshal(respBytes, &instanceStatus); err != nil {
-		fmt.Fprintln(os.Stderr, "error unmarshalling json", err)
-		return
+		return fmt.Errorf("error marshalling json %w", err)
 	}
-	if instanceStatus.Type == "error" {
-		return
+	if _, err := i.Incusapi("PUT", string(dataBytes), "instances", instanceName, "state"); err != nil {
+		return fmt.Errorf("could not %s %s %w", state, instanceName, err)
 	}
 
-	var containeState string
 	switch state {
 	case "start":
-		containeState = "RUNNING"
 		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(instanceName, "started"))
 	case "stop":
-		containeState = "STOPPED"
 		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(instanceName, "stopped"))
 	case "restart":
-		containeState = "RUNNING"
 		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(instanceName, "restarted"))
 	case "freeze":
-		containeState = "FROZEN"
 		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(instanceName, "frozen"))
 	case "unfreeze":
-		containeState = "RUNNING"
 		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(instanceName, "unfrozen"))
 	}
 
-	i.WaitForInstance(instanceName, containeState)
+	if err := i.WaitForInstance(instanceName, containeState); err != nil {
+		return err
+	}
+	if containeState == "RUNNING" {
+		return i.WaitForAgent(instanceName)
+	}
+	return nil
+}
+
+// WaitForAgent waits until the incus agent of a virtual machine answers,
+// exec and file transfers need it, containers return right away
+func (i *Incus) WaitForAgent(instanceName string) error {
+	instance, err := i.GetInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	if instance.Type != config.InstanceTypeVM {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Waiting for the agent of", instanceName))
+	deadline := time.Now().Add(i.Timeout)
+	for {
+		currentState, err := i.GetInstanceState(instanceName)
+		if err != nil {
+			return err
+		}
+		// the process count is only reported once the agent is running
+		if currentState.Metadata.Processes > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the agent of %s", instanceName)
+		}
+		time.Sleep(time.Second)
+	}
 }
 
-func (i *Incus) WaitForInstance(instanceName string, containeState string) {
+// WaitForInstance polls the instance until it reaches containeState,
+// giving up once the client timeout has expired
+func (i *Incus) WaitForInstance(instanceName string, containeState string) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Waiting for instance", instanceName, "to be", containeState))
+	deadline := time.Now().Add(i.Timeout)
 	for {
-		currentState := i.GetInstanceState(instanceName)
+		currentState, err := i.GetInstanceState(instanceName)
+		if err != nil {
+			return err
+		}
 		if strings.EqualFold(currentState.Metadata.Status, containeState) {
-			break
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s to be %s, currently %s",
+				instanceName, containeState, currentState.Metadata.Status)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 }
 
-func (i *Incus) CreateInstance(instanceName string, source string, cpu int, mem string) {
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating instance", instanceName, "from", source))
+// CreateInstance creates and starts a container or virtual machine from a remote image
+func (i *Incus) CreateInstance(instanceName string, source string, instanceType string, profiles []string, instanceConfig map[string]string) error {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating", instanceType, instanceName, "from", source))
+	if instanceConfig == nil {
+		instanceConfig = map[string]string{}
+	}
+	instanceConfig[ManagedKey] = "true"
 	data := map[string]any{
-		"name":  instanceName,
-		"type":  "container",
-		"start": true,
-		"config": map[string]any{
-			"limits.cpu":    fmt.Sprintf("%d", cpu),
-			"limits.memory": mem,
-		},
+		"name":     instanceName,
+		"type":     instanceType,
+		"start":    true,
+		"profiles": profiles,
+		"config":   instanceConfig,
 		"source": map[string]any{
 			"type":     "image",
 			"alias":    source,
@@ -246,18 +260,54 @@ func (i *Incus) CreateInstance(instanceName string, source string, cpu int, mem
 	}
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error marshalling json", err)
-		return
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("POST", string(dataBytes), "instances"); err != nil {
+		return fmt.Errorf("could not create instance %s %w", instanceName, err)
 	}
-	// fmt.Println(string(dataBytes))
-	i.Incusapi("POST", string(dataBytes), "instances")
-	// respBytes := incusapi("POST", string(dataBytes), "instances")
-	// fmt.Println(string(respBytes))
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Instance", instanceName, "created"))
-	i.SetInstanceState(instanceName, "start")
+	return i.SetInstanceState(instanceName, "start")
+}
+
+// CreateInstanceFromImage creates a stopped instance from a local image alias
+// or fingerprint, the instance type has to match the type the image was
+// published from, instanceConfig is added to the instance configuration
+func (i *Incus) CreateInstanceFromImage(instanceName string, image string, instanceType string, instanceConfig map[string]string) error {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating", instanceType, instanceName, "from image", image))
+	cfg := map[string]string{}
+	for k, v := range instanceConfig {
+		cfg[k] = v
+	}
+	cfg[ManagedKey] = "true"
+	source := map[string]any{"type": "image", "alias": image}
+	if IsFingerprint(image) {
+		source = map[string]any{"type": "image", "fingerprint": image}
+	}
+	data := map[string]any{
+		"name":     instanceName,
+		"type":     instanceType,
+		"profiles": []string{"default", ProfileFor(instanceType)},
+		"config":   cfg,
+		"source":   source,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("POST", string(dataBytes), "instances"); err != nil {
+		return fmt.Errorf("could not create instance %s from %s %w", instanceName, image, err)
+	}
+	return nil
 }
 
-func (i *Incus) CopyInstance(sourceName string, instanceName string) {
+// IsFingerprint tells image fingerprints, or a unique prefix of one, from aliases
+func IsFingerprint(image string) bool {
+	return fingerprintRe.MatchString(image)
+}
+
+var fingerprintRe = regexp.MustCompile(`^[0-9a-f]{12,64}$`)
+
+func (i *Incus) CopyInstance(sourceName string, instanceName string) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Copying instance", instanceName, "from", sourceName))
 	data := map[string]any{
 		"name": instanceName,
@@ -268,62 +318,80 @@ func (i *Incus) CopyInstance(sourceName string, instanceName string) {
 	}
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error marshalling json", err)
-		return
+		return fmt.Errorf("error marshalling json %w", err)
 	}
-	i.Incusapi("POST", string(dataBytes), "instances")
+	if _, err := i.Incusapi("POST", string(dataBytes), "instances"); err != nil {
+		return fmt.Errorf("could not copy %s to %s %w", sourceName, instanceName, err)
+	}
+	return nil
 }
 
-func (i *Incus) DeleteInstance(instanceName string) {
+func (i *Incus) DeleteInstance(instanceName string) error {
 	fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("destroying:", instanceName))
-	i.Incusapi("DELETE", "", "instances", instanceName)
+	if _, err := i.Incusapi("DELETE", "", "instances", instanceName); err != nil {
+		return fmt.Errorf("could not delete instance %s %w", instanceName, err)
+	}
+	return nil
 }
 
-func (i *Incus) IncusGetUid(instanceName, username string) (string, error) {
-	// conf := GetConf()
-	cmd := "incus"
-	cmdArgs := []string{"exec", instanceName, "-t", "--", "grep", "^" + username, "/etc/passwd"}
-	// if conf.DEBUG == "true" {
-	// 	fmt.Fprintln(cmd, cmdArgs)
-	// }
-	out, err := exec.Command(cmd, cmdArgs...).Output()
+// IncusGetUid looks up the uid of username in the instance /etc/passwd
+func (i *Incus) IncusGetUid(instanceName, username string) (int, error) {
+	uid, err := i.passwdID(instanceName, username, 2)
 	if err != nil {
-		return "", fmt.Errorf("could not get uid for %s %w", username, err)
+		return 0, fmt.Errorf("could not get uid for %s %w", username, err)
 	}
-	return strings.Split(string(out), ":")[2], nil
+	return uid, nil
 }
 
-func (i *Incus) IncusExec(instanceName string, args ...string) error {
-	cmdArgs := []string{"exec", instanceName, "--"}
-	cmdArgs = append(cmdArgs, args...)
-	c := exec.Command("incus", cmdArgs...)
-	err := c.Run()
+// IncusGetGid looks up the primary gid of username in the instance
+// /etc/passwd, it is not always the same as the uid
+func (i *Incus) IncusGetGid(instanceName, username string) (int, error) {
+	gid, err := i.passwdID(instanceName, username, 3)
 	if err != nil {
-		if errors.Is(err, exec.ErrWaitDelay) {
-			return fmt.Errorf("failed to exec command %w", err)
-		}
+		return 0, fmt.Errorf("could not get gid for %s %w", username, err)
+	}
+	return gid, nil
+}
+
+// passwdID is the numeric field of the /etc/passwd entry of username
+func (i *Incus) passwdID(instanceName, username string, field int) (int, error) {
+	var out bytes.Buffer
+	if err := i.Exec(instanceName, ExecOptions{Stdout: &out}, "grep", "^"+username+":", "/etc/passwd"); err != nil {
+		return 0, err
+	}
+	return parsePasswdID(out.String(), field)
+}
+
+// parsePasswdID is a numeric field of an /etc/passwd entry
+func parsePasswdID(entry string, field int) (int, error) {
+	fields := strings.Split(entry, ":")
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("user not found")
+	}
+	return strconv.Atoi(fields[field])
+}
+
+// IncusExec runs a command as root in the instance discarding its output
+func (i *Incus) IncusExec(instanceName string, args ...string) error {
+	if err := i.Exec(instanceName, ExecOptions{}, args...); err != nil {
+		return fmt.Errorf("failed to exec command %w", err)
 	}
 	return nil
 }
 
+// IncusExecVerbose runs a command as root in the instance
+// passing its output through to stdout and stderr
 func (i *Incus) IncusExecVerbose(instanceName string, args ...string) error {
-	cmdArgs := []string{"exec", instanceName, "--"}
-	cmdArgs = append(cmdArgs, args...)
-	c := exec.Command("incus", cmdArgs...)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	err := c.Run()
-	if err != nil {
-		if errors.Is(err, exec.ErrWaitDelay) {
-			return fmt.Errorf("failed to exec command %w", err)
-		}
+	if err := i.Exec(instanceName, ExecOptions{Stdout: os.Stdout, Stderr: os.Stderr}, args...); err != nil {
+		return fmt.Errorf("failed to exec command %w", err)
 	}
 	return nil
 }
 
+// InstanceMounts adds the project specific mounts to the instance,
+// the shared settings come from the oda profile
 func (i *Incus) InstanceMounts(project string) error {
 	repoDir := i.OdaConf.Dirs.Repo
-	projDir := i.OdaConf.Dirs.Project
 
 	cwd, _ := lib.GetProject()
 	projectCfg, err := config.LoadProjectConfig()
@@ -332,37 +400,22 @@ func (i *Incus) InstanceMounts(project string) error {
 	}
 	version := projectCfg.Version
 
-	i.IncusMount(project, "backups", projDir+"/backups", "/opt/odoo/backups")
-	i.IncusMount(project, "addons", cwd+"/addons", "/opt/odoo/addons")
-	i.IncusMount(project, "conf", cwd+"/conf", "/opt/odoo/conf")
-	i.IncusMount(project, "data", cwd+"/data", "/opt/odoo/data")
+	devices := map[string]map[string]string{
+		"addons": diskDevice(cwd+"/addons", "/opt/odoo/addons"),
+		"conf":   diskDevice(cwd+"/conf", "/opt/odoo/conf"),
+		"data":   diskDevice(cwd+"/data", "/opt/odoo/data"),
+	}
 
 	branch := config.GetVersion(version)
-	for _, repo := range branch.Repos {
-		i.IncusMount(project, repo, repoDir+"/"+version+"/"+repo, "/opt/odoo/"+repo)
+	if branch == nil {
+		return fmt.Errorf("unknown version %s", version)
 	}
-
-	return nil
-}
-
-func (i *Incus) IncusMount(instanceName, mount, source, target string) error {
-	cmd := "incus"
-	cmdArgs := []string{"config", "device", "add", instanceName, mount, "disk", "source=" + source, "path=" + target}
-	return exec.Command(cmd, cmdArgs...).Run()
-}
-
-func (i *Incus) IncusIdmap(instanceName string) error {
-	fmt.Println("Setting idmap for", instanceName)
-	currentUser, err := user.Current()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("could not get current user %v"), err)
-		return err
+	for _, repo := range branch.Repos {
+		devices[repo] = diskDevice(repoDir+"/"+version+"/"+repo, "/opt/odoo/"+repo)
 	}
-	// set idmap both to map the current user to 1001
-	cmdArgs := []string{"config", "set", instanceName, "raw.idmap", "both " + currentUser.Uid + " 1001"}
-	if err := exec.Command("incus", cmdArgs...).Run(); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("could not set idmap %v"), err)
-		return err
+	for _, addons := range projectCfg.Addons {
+		devices["extra-"+addons.Name] = diskDevice(addons.HostPath(cwd), addons.AddonsPath())
 	}
-	return nil
+
+	return i.AddInstanceDevices(project, devices)
 }
@@ -90,82 +90,104 @@ type IncusInstance struct {
 }
 
 type IncusInstanceStatus struct {
-	Type       string `json:"type"`
+	Type       string        `json:"type"`
+	Status     string        `json:"status"`
+	StatusCode int           `json:"status_code"`
+	Operation  string        `json:"operation"`
+	ErrorCode  int           `json:"error_code"`
+	Error      string        `json:"error"`
+	Metadata   InstanceState `json:"metadata"`
+}
+
+// InstanceState is the runtime state of an instance, its cpu, memory,
+// disk and network usage
+type InstanceState struct {
 	Status     string `json:"status"`
 	StatusCode int    `json:"status_code"`
-	Operation  string `json:"operation"`
-	ErrorCode  int    `json:"error_code"`
-	Error      string `json:"error"`
-	Metadata   struct {
-		Status     string `json:"status"`
-		StatusCode int    `json:"status_code"`
-		Disk       struct {
-			Root struct {
-				Usage int `json:"usage"`
-				Total int `json:"total"`
-			} `json:"root"`
-		} `json:"disk"`
-		Memory struct {
-			Usage         int   `json:"usage"`
-			UsagePeak     int   `json:"usage_peak"`
-			Total         int64 `json:"total"`
-			SwapUsage     int   `json:"swap_usage"`
-			SwapUsagePeak int   `json:"swap_usage_peak"`
-		} `json:"memory"`
-		Network struct {
-			Eth0 struct {
-				Addresses []struct {
-					Family  string `json:"family"`
-					Address string `json:"address"`
-					Netmask string `json:"netmask"`
-					Scope   string `json:"scope"`
-				} `json:"addresses"`
-				Counters struct {
-					BytesReceived          int `json:"bytes_received"`
-					BytesSent              int `json:"bytes_sent"`
-					PacketsReceived        int `json:"packets_received"`
-					PacketsSent            int `json:"packets_sent"`
-					ErrorsReceived         int `json:"errors_received"`
-					ErrorsSent             int `json:"errors_sent"`
-					PacketsDroppedOutbound int `json:"packets_dropped_outbound"`
-					PacketsDroppedInbound  int `json:"packets_dropped_inbound"`
-				} `json:"counters"`
-				Hwaddr   string `json:"hwaddr"`
-				HostName string `json:"host_name"`
-				Mtu      int    `json:"mtu"`
-				State    string `json:"state"`
-				Type     string `json:"type"`
-			} `json:"eth0"`
-			Lo struct {
-				Addresses []struct {
-					Family  string `json:"family"`
-					Address string `json:"address"`
-					Netmask string `json:"netmask"`
-					Scope   string `json:"scope"`
-				} `json:"addresses"`
-				Counters struct {
-					BytesReceived          int `json:"bytes_received"`
-					BytesSent              int `json:"bytes_sent"`
-					PacketsReceived        int `json:"packets_received"`
-					PacketsSent            int `json:"packets_sent"`
-					ErrorsReceived         int `json:"errors_received"`
-					ErrorsSent             int `json:"errors_sent"`
-					PacketsDroppedOutbound int `json:"packets_dropped_outbound"`
-					PacketsDroppedInbound  int `json:"packets_dropped_inbound"`
-				} `json:"counters"`
-				Hwaddr   string `json:"hwaddr"`
-				HostName string `json:"host_name"`
-				Mtu      int    `json:"mtu"`
-				State    string `json:"state"`
-				Type     string `json:"type"`
-			} `json:"lo"`
-		} `json:"network"`
-		Pid       int `json:"pid"`
-		Processes int `json:"processes"`
-		CPU       struct {
-			Usage int64 `json:"usage"`
-		} `json:"cpu"`
-	} `json:"metadata"`
+	Disk       struct {
+		Root struct {
+			Usage int `json:"usage"`
+			Total int `json:"total"`
+		} `json:"root"`
+	} `json:"disk"`
+	Memory struct {
+		Usage         int   `json:"usage"`
+		UsagePeak     int   `json:"usage_peak"`
+		Total         int64 `json:"total"`
+		SwapUsage     int   `json:"swap_usage"`
+		SwapUsagePeak int   `json:"swap_usage_peak"`
+	} `json:"memory"`
+	Network   map[string]InstanceNetwork `json:"network"`
+	Pid       int                        `json:"pid"`
+	Processes int                        `json:"processes"`
+	CPU       struct {
+		Usage int64 `json:"usage"`
+	} `json:"cpu"`
+}
+
+// InstanceNetwork is one network interface of a running instance
+type InstanceNetwork struct {
+	Addresses []NetworkAddress `json:"addresses"`
+	Counters  NetworkCounters  `json:"counters"`
+	Hwaddr    string           `json:"hwaddr"`
+	HostName  string           `json:"host_name"`
+	Mtu       int              `json:"mtu"`
+	State     string           `json:"state"`
+	Type      string           `json:"type"`
+}
+
+// NetworkAddress is an address assigned to an interface,
+// family is inet or inet6 and scope is global, link or local
+type NetworkAddress struct {
+	Family  string `json:"family"`
+	Address string `json:"address"`
+	Netmask string `json:"netmask"`
+	Scope   string `json:"scope"`
+}
+
+type NetworkCounters struct {
+	BytesReceived          int `json:"bytes_received"`
+	BytesSent              int `json:"bytes_sent"`
+	PacketsReceived        int `json:"packets_received"`
+	PacketsSent            int `json:"packets_sent"`
+	ErrorsReceived         int `json:"errors_received"`
+	ErrorsSent             int `json:"errors_sent"`
+	PacketsDroppedOutbound int `json:"packets_dropped_outbound"`
+	PacketsDroppedInbound  int `json:"packets_dropped_inbound"`
+}
+
+// IncusInstancesFull is the instance list fetched with recursion=2,
+// every entry carries its config and state
+type IncusInstancesFull struct {
+	Type       string         `json:"type"`
+	Status     string         `json:"status"`
+	StatusCode int            `json:"status_code"`
+	Operation  string         `json:"operation"`
+	ErrorCode  int            `json:"error_code"`
+	Error      string         `json:"error"`
+	Metadata   []InstanceFull `json:"metadata"`
+}
+
+// IncusInstanceFull is a single instance fetched with recursion=1
+type IncusInstanceFull struct {
+	Type       string       `json:"type"`
+	Status     string       `json:"status"`
+	StatusCode int          `json:"status_code"`
+	Operation  string       `json:"operation"`
+	ErrorCode  int          `json:"error_code"`
+	Error      string       `json:"error"`
+	Metadata   InstanceFull `json:"metadata"`
+}
+
+// InstanceFull is an instance with its state included
+type InstanceFull struct {
+	Name           string            `json:"name"`
+	Status         string            `json:"status"`
+	Type           string            `json:"type"`
+	Profiles       []string          `json:"profiles"`
+	Config         map[string]string `json:"config"`
+	ExpandedConfig map[string]string `json:"expanded_config"`
+	State          *InstanceState    `json:"state"`
 }
 
 type IncusStateResponse struct {
@@ -300,3 +322,38 @@ type IncusConsole struct {
 		Location  string `json:"location"`
 	} `json:"metadata"`
 }
+
+type IncusSnapshots struct {
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Operation  string `json:"operation"`
+	ErrorCode  int    `json:"error_code"`
+	Error      string `json:"error"`
+	Metadata   []struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Stateful  bool      `json:"stateful"`
+		Size      int64     `json:"size"`
+	} `json:"metadata"`
+}
+
+type IncusImages struct {
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Operation  string `json:"operation"`
+	ErrorCode  int    `json:"error_code"`
+	Error      string `json:"error"`
+	Metadata   []struct {
+		Fingerprint string `json:"fingerprint"`
+		Aliases     []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"aliases"`
+		Properties map[string]string `json:"properties"`
+		Size       int64             `json:"size"`
+		CreatedAt  time.Time         `json:"created_at"`
+	} `json:"metadata"`
+}
@@ -0,0 +1,146 @@
+package incus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+const testInstances = `{"type":"sync","status":"Success","status_code":200,"metadata":[
+{"name":"db","status":"Running","type":"container","config":{},"expanded_config":{},
+ "state":{"network":{"eth0":{"addresses":[{"family":"inet6","address":"fe80::2","scope":"link"},{"family":"inet6","address":"fd42::2","scope":"global"},{"family":"inet","address":"10.0.0.2","scope":"global"}]}}}},
+{"name":"odoo-17-0","status":"Stopped","type":"container","config":{"user.oda.managed":"true"},"expanded_config":{"user.oda.managed":"true"},"state":null},
+{"name":"p1","status":"Running","type":"container","config":{},"expanded_config":{"user.oda.managed":"true"},
+ "state":{"network":{"eth0":{"addresses":[{"family":"inet","address":"10.0.0.3","scope":"global"}]}}}}
+]}`
+
+func TestGetInstances(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/1.0/instances" || r.URL.Query().Get("recursion") != "2" || r.URL.Query().Get("project") != "oda" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(testInstances))
+	}))
+	defer srv.Close()
+
+	odaConf := config.NewOdaConfig()
+	odaConf.Incus.Type = "http"
+	odaConf.Incus.URL = srv.URL + "/1.0"
+	odaConf.Incus.Project = "oda"
+	inc := NewIncus(odaConf)
+
+	tests := []struct {
+		name   string
+		filter InstanceFilter
+		want   []Instance
+	}{
+		{"all", InstanceFilter{}, []Instance{
+			{Name: "db", State: "Running", IP4: "10.0.0.2", IP6: "fd42::2", Type: "container"},
+			{Name: "odoo-17-0", State: "Stopped", Type: "container", Managed: true},
+			{Name: "p1", State: "Running", IP4: "10.0.0.3", Type: "container", Managed: true},
+		}},
+		{"prefix", InstanceFilter{Prefix: "odoo-"}, []Instance{
+			{Name: "odoo-17-0", State: "Stopped", Type: "container", Managed: true},
+		}},
+		{"managed", InstanceFilter{Managed: true}, []Instance{
+			{Name: "odoo-17-0", State: "Stopped", Type: "container", Managed: true},
+			{Name: "p1", State: "Running", IP4: "10.0.0.3", Type: "container", Managed: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			got, err := inc.GetInstances(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if requests != 1 {
+				t.Errorf("listing took %d requests, want 1", requests)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for n := range got {
+				got[n].Interfaces = nil
+				if !reflect.DeepEqual(got[n], tt.want[n]) {
+					t.Errorf("instance %d got %+v, want %+v", n, got[n], tt.want[n])
+				}
+			}
+		})
+	}
+}
+
+func TestNewInstanceAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		ip4, ip6 string
+		ifaces   []string
+	}{
+		{
+			name: "ipv6 listed first",
+			network: `{"eth0":{"addresses":[
+				{"family":"inet6","address":"fd42::5","scope":"global"},
+				{"family":"inet","address":"10.0.0.5","scope":"global"}]}}`,
+			ip4: "10.0.0.5", ip6: "fd42::5", ifaces: []string{"eth0"},
+		},
+		{
+			name: "link local only",
+			network: `{"eth0":{"addresses":[
+				{"family":"inet6","address":"fe80::5","scope":"link"},
+				{"family":"inet","address":"169.254.0.5","scope":"global"}]}}`,
+			ifaces: []string{"eth0"},
+		},
+		{
+			name: "eth0 before other interfaces",
+			network: `{"lo":{"type":"loopback","addresses":[{"family":"inet","address":"127.0.0.1","scope":"local"}]},
+				"eth1":{"addresses":[{"family":"inet","address":"192.168.1.5","scope":"global"}]},
+				"eth0":{"addresses":[{"family":"inet","address":"10.0.0.5","scope":"global"}]}}`,
+			ip4: "10.0.0.5", ifaces: []string{"eth0", "eth1"},
+		},
+		{
+			name: "address on a second interface",
+			network: `{"eth0":{"addresses":[]},
+				"enp5s0":{"addresses":[{"family":"inet","address":"10.0.0.6","scope":"global"}]}}`,
+			ip4: "10.0.0.6", ifaces: []string{"eth0", "enp5s0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state InstanceState
+			if err := json.Unmarshal([]byte(`{"network":`+tt.network+`}`), &state); err != nil {
+				t.Fatal(err)
+			}
+			got := NewInstance(InstanceFull{Name: "p1", State: &state})
+			if got.IP4 != tt.ip4 || got.IP6 != tt.ip6 {
+				t.Errorf("got %q %q, want %q %q", got.IP4, got.IP6, tt.ip4, tt.ip6)
+			}
+			names := []string{}
+			for _, iface := range got.Interfaces {
+				names = append(names, iface.Name)
+			}
+			if !reflect.DeepEqual(names, tt.ifaces) {
+				t.Errorf("interfaces %q, want %q", names, tt.ifaces)
+			}
+		})
+	}
+}
+
+func TestParsePasswdID(t *testing.T) {
+	entry := "postgres:x:105:111:PostgreSQL administrator,,,:/var/lib/postgresql:/bin/bash\n"
+	if uid, err := parsePasswdID(entry, 2); err != nil || uid != 105 {
+		t.Errorf("uid %d, %v", uid, err)
+	}
+	if gid, err := parsePasswdID(entry, 3); err != nil || gid != 111 {
+		t.Errorf("gid %d, %v", gid, err)
+	}
+	if _, err := parsePasswdID("", 3); err == nil {
+		t.Error("parsed an empty entry")
+	}
+}
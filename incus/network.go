@@ -0,0 +1,56 @@
+package incus
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// NetworkInterface is a network interface of an instance with its addresses
+type NetworkInterface struct {
+	Name      string
+	Hwaddr    string
+	State     string
+	Addresses []NetworkAddress
+}
+
+// Interfaces lists the non loopback interfaces of the instance state,
+// eth0 first and the rest by name so the order does not change between calls
+func (s *InstanceState) Interfaces() []NetworkInterface {
+	interfaces := []NetworkInterface{}
+	for name, network := range s.Network {
+		if name == "lo" || network.Type == "loopback" {
+			continue
+		}
+		interfaces = append(interfaces, NetworkInterface{
+			Name:      name,
+			Hwaddr:    network.Hwaddr,
+			State:     network.State,
+			Addresses: network.Addresses,
+		})
+	}
+	sort.Slice(interfaces, func(i, j int) bool {
+		if (interfaces[i].Name == "eth0") != (interfaces[j].Name == "eth0") {
+			return interfaces[i].Name == "eth0"
+		}
+		return interfaces[i].Name < interfaces[j].Name
+	})
+	return interfaces
+}
+
+// primaryAddress picks the first global address of family from the interfaces
+// in order, link local and loopback addresses are never picked
+func primaryAddress(interfaces []NetworkInterface, family string) string {
+	for _, iface := range interfaces {
+		for _, addr := range iface.Addresses {
+			if addr.Family != family || addr.Scope != "global" {
+				continue
+			}
+			ip, err := netip.ParseAddr(addr.Address)
+			if err != nil || ip.IsLinkLocalUnicast() || ip.IsLoopback() {
+				continue
+			}
+			return addr.Address
+		}
+	}
+	return ""
+}
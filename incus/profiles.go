@@ -0,0 +1,172 @@
+package incus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/ui"
+)
+
+// ProfileName is the profile holding the settings shared by all oda containers
+const ProfileName = "oda"
+
+// ProfileNameVM is the profile shared by oda virtual machines, raw.idmap
+// does not apply to them
+const ProfileNameVM = "oda-vm"
+
+// odooUID is the uid of the odoo user in the container base images
+const odooUID = "1001"
+
+// ProfileFor is the oda profile of the instance type
+func ProfileFor(instanceType string) string {
+	if instanceType == config.InstanceTypeVM {
+		return ProfileNameVM
+	}
+	return ProfileName
+}
+
+// Profile returns the config and devices of the oda profile
+// of the instance type built from oda.yaml
+func (i *Incus) Profile(instanceType string) (map[string]string, map[string]map[string]string, error) {
+	profileConfig := map[string]string{
+		"limits.cpu":    fmt.Sprintf("%d", i.OdaConf.Incus.LimitCPU),
+		"limits.memory": i.OdaConf.Incus.LimitMemory,
+		ManagedKey:      "true",
+	}
+	if instanceType != config.InstanceTypeVM {
+		currentUser, err := user.Current()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get current user %w", err)
+		}
+		// map the current user to odoo so the mounted project files stay writable,
+		// virtual machines get the odoo user created with the current uid instead
+		profileConfig["raw.idmap"] = "both " + currentUser.Uid + " " + odooUID
+	}
+	profileDevices := map[string]map[string]string{
+		"backups": diskDevice(filepath.Join(i.OdaConf.Dirs.Project, "backups"), "/opt/odoo/backups"),
+	}
+	return profileConfig, profileDevices, nil
+}
+
+// SyncProfile creates the oda container and virtual machine profiles
+// or replaces their settings with the ones currently in oda.yaml
+func (i *Incus) SyncProfile() error {
+	for _, instanceType := range []string{config.InstanceTypeContainer, config.InstanceTypeVM} {
+		if err := i.syncProfile(instanceType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Incus) syncProfile(instanceType string) error {
+	profileName := ProfileFor(instanceType)
+	profileConfig, profileDevices, err := i.Profile(instanceType)
+	if err != nil {
+		return err
+	}
+	data := map[string]any{
+		"description": "oda shared " + instanceType + " settings",
+		"config":      profileConfig,
+		"devices":     profileDevices,
+	}
+
+	_, err = i.Incusapi("GET", "", "profiles", profileName)
+	switch {
+	case IsNotFound(err):
+		data["name"] = profileName
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshalling json %w", err)
+		}
+		if _, err := i.Incusapi("POST", string(dataBytes), "profiles"); err != nil {
+			return fmt.Errorf("could not create profile %s %w", profileName, err)
+		}
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("profile", profileName, "created"))
+	case err != nil:
+		return fmt.Errorf("could not get profile %s %w", profileName, err)
+	default:
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshalling json %w", err)
+		}
+		if _, err := i.Incusapi("PUT", string(dataBytes), "profiles", profileName); err != nil {
+			return fmt.Errorf("could not update profile %s %w", profileName, err)
+		}
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("profile", profileName, "updated"))
+	}
+	return nil
+}
+
+// AddInstanceDevices adds devices to the instance, replacing any device
+// of the same name and leaving the others untouched
+func (i *Incus) AddInstanceDevices(instanceName string, devices map[string]map[string]string) error {
+	data := map[string]any{
+		"devices": devices,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("PATCH", string(dataBytes), "instances", instanceName); err != nil {
+		return fmt.Errorf("could not add devices to %s %w", instanceName, err)
+	}
+	return nil
+}
+
+// RemoveInstanceDevices removes the named devices from the instance,
+// devices it does not have are ignored
+func (i *Incus) RemoveInstanceDevices(instanceName string, names ...string) error {
+	respBytes, err := i.Incusapi("GET", "", "instances", instanceName)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Metadata map[string]any `json:"metadata"`
+	}
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return fmt.Errorf("error unmarshalling instance %s %w", instanceName, err)
+	}
+	devices, _ := resp.Metadata["devices"].(map[string]any)
+	removed := false
+	for _, name := range names {
+		if _, ok := devices[name]; ok {
+			delete(devices, name)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	// PATCH merges devices, dropping one needs the whole instance config
+	dataBytes, err := json.Marshal(resp.Metadata)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("PUT", string(dataBytes), "instances", instanceName); err != nil {
+		return fmt.Errorf("could not remove devices from %s %w", instanceName, err)
+	}
+	return nil
+}
+
+// ProxyDevice forwards connections on the host listen address
+// to the connect address inside the instance, both as tcp:host:port
+func ProxyDevice(listen, connect string) map[string]string {
+	return map[string]string{
+		"type":    "proxy",
+		"listen":  listen,
+		"connect": connect,
+	}
+}
+
+func diskDevice(source, path string) map[string]string {
+	return map[string]string{
+		"type":   "disk",
+		"source": source,
+		"path":   path,
+	}
+}
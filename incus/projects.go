@@ -0,0 +1,48 @@
+package incus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ppreeper/oda/ui"
+)
+
+// EnsureProject creates the configured Incus project if it does not exist,
+// profiles, images, networks and storage volumes stay shared with the
+// default project so the oda profile and published images apply to it
+func (i *Incus) EnsureProject() error {
+	project := i.OdaConf.Incus.Project
+	if project == "" {
+		return nil
+	}
+
+	_, err := i.Incusapi("GET", "", "projects", project)
+	if err == nil {
+		return nil
+	}
+	if !IsNotFound(err) {
+		return fmt.Errorf("could not get project %s %w", project, err)
+	}
+
+	data := map[string]any{
+		"name":        project,
+		"description": "oda instances",
+		"config": map[string]string{
+			"features.images":          "false",
+			"features.profiles":        "false",
+			"features.networks":        "false",
+			"features.storage.volumes": "false",
+			"limits.instances":         "100",
+		},
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("POST", string(dataBytes), "projects"); err != nil {
+		return fmt.Errorf("could not create project %s %w", project, err)
+	}
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("incus project", project, "created"))
+	return nil
+}
@@ -0,0 +1,81 @@
+package incus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ppreeper/oda/ui"
+)
+
+type Snapshot struct {
+	Name      string
+	CreatedAt time.Time
+	Size      int64
+}
+
+// GetSnapshots lists the snapshots of the instance, oldest first
+func (i *Incus) GetSnapshots(instanceName string) ([]Snapshot, error) {
+	respBytes, err := i.IncusapiQuery("GET", "", url.Values{"recursion": {"1"}},
+		"instances", instanceName, "snapshots")
+	if err != nil {
+		return []Snapshot{}, err
+	}
+	var incusSnapshots IncusSnapshots
+	if err := json.Unmarshal(respBytes, &incusSnapshots); err != nil {
+		return []Snapshot{}, fmt.Errorf("error unmarshalling snapshots of %s %w", instanceName, err)
+	}
+	snapshots := []Snapshot{}
+	for _, v := range incusSnapshots.Metadata {
+		snapshots = append(snapshots, Snapshot{
+			Name:      v.Name,
+			CreatedAt: v.CreatedAt,
+			Size:      v.Size,
+		})
+	}
+	return snapshots, nil
+}
+
+// CreateSnapshot takes a stateless snapshot of the instance
+func (i *Incus) CreateSnapshot(instanceName, snapshotName string) error {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating snapshot", snapshotName, "of", instanceName))
+	data := map[string]any{
+		"name":     snapshotName,
+		"stateful": false,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("POST", string(dataBytes), "instances", instanceName, "snapshots"); err != nil {
+		return fmt.Errorf("could not snapshot %s %w", instanceName, err)
+	}
+	return nil
+}
+
+// RestoreSnapshot rolls the instance back to the snapshot
+func (i *Incus) RestoreSnapshot(instanceName, snapshotName string) error {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Restoring", instanceName, "to snapshot", snapshotName))
+	data := map[string]any{
+		"restore": snapshotName,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("PUT", string(dataBytes), "instances", instanceName); err != nil {
+		return fmt.Errorf("could not restore %s to %s %w", instanceName, snapshotName, err)
+	}
+	return nil
+}
+
+// DeleteSnapshot removes the snapshot from the instance
+func (i *Incus) DeleteSnapshot(instanceName, snapshotName string) error {
+	fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("deleting snapshot:", instanceName+"/"+snapshotName))
+	if _, err := i.Incusapi("DELETE", "", "instances", instanceName, "snapshots", snapshotName); err != nil {
+		return fmt.Errorf("could not delete snapshot %s of %s %w", snapshotName, instanceName, err)
+	}
+	return nil
+}
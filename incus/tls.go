@@ -0,0 +1,169 @@
+package incus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// tlsConfig builds the TLS config for a remote Incus server from oda.yaml,
+// the server is verified against the pinned fingerprint if one is set,
+// otherwise against server_ca or the system roots
+func (i *Incus) tlsConfig() (*tls.Config, error) {
+	incusConf := i.OdaConf.Incus
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if incusConf.ClientCert != "" || incusConf.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(incusConf.ClientCert, incusConf.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch {
+	case incusConf.ServerFingerprint != "":
+		pinned := normalizeFingerprint(incusConf.ServerFingerprint)
+		// the chain is not verified, the pinned certificate is the trust anchor
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			if got := CertFingerprint(rawCerts[0]); got != pinned {
+				return fmt.Errorf("server certificate fingerprint %s does not match %s", got, pinned)
+			}
+			return nil
+		}
+	case incusConf.ServerCA != "":
+		caPEM, err := os.ReadFile(incusConf.ServerCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read server ca %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", incusConf.ServerCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// CertFingerprint is the sha256 fingerprint of a DER encoded certificate
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// ServerFingerprint connects to the server without verifying it
+// and returns the fingerprint of the certificate it presents
+func ServerFingerprint(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server url %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "8443")
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", fmt.Errorf("could not connect to %s %w", host, err)
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("%s sent no certificate", host)
+	}
+	return CertFingerprint(certs[0].Raw), nil
+}
+
+// GenerateClientCert writes a new self-signed client certificate and key
+func GenerateClientCert(certFile, keyFile, commonName string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not generate key %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("could not generate serial %w", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"oda"}},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("could not create certificate %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("could not marshal key %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return fmt.Errorf("could not write key %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return fmt.Errorf("could not write certificate %w", err)
+	}
+	return nil
+}
+
+// IsTrusted reports whether the server accepts the client certificate
+func (i *Incus) IsTrusted() (bool, error) {
+	respBytes, err := i.Incusapi("GET", "")
+	if err != nil {
+		return false, err
+	}
+	var resp struct {
+		Metadata struct {
+			Auth string `json:"auth"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return false, fmt.Errorf("error unmarshalling server info %w", err)
+	}
+	return resp.Metadata.Auth == "trusted", nil
+}
+
+// TrustAdd adds the client certificate to the server trust store
+// using a token from "incus config trust add" on the server
+func (i *Incus) TrustAdd(token string) error {
+	data := map[string]any{
+		"type":        "client",
+		"trust_token": token,
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling json %w", err)
+	}
+	if _, err := i.Incusapi("POST", string(dataBytes), "certificates"); err != nil {
+		return fmt.Errorf("could not add client certificate %w", err)
+	}
+	return nil
+}
@@ -2,13 +2,10 @@ package internal
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/ppreeper/oda/config"
-	"github.com/ppreeper/oda/incus"
 	"github.com/ppreeper/oda/lib"
-	"github.com/ppreeper/oda/ui"
 )
 
 func moduleList(modules ...string) string {
@@ -30,10 +27,10 @@ func (o *ODA) InstanceAppInstallUpgrade(install bool, modules ...string) error {
 	}
 	_, project := lib.GetProject()
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExecVerbose(project, "odas", iu, moduleList(modules...)); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error installing/upgrading modules %v"), err)
+		return fmt.Errorf("error installing/upgrading modules %w", err)
 	}
 
 	return nil
@@ -45,10 +42,10 @@ func (o *ODA) Scaffold(module string) error {
 	}
 	_, project := lib.GetProject()
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExecVerbose(project, "odas", "scaffold", module); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error scaffolding module %v"), err)
+		return fmt.Errorf("error scaffolding module %w", err)
 	}
 
 	return nil
@@ -3,7 +3,6 @@ package internal
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -20,17 +19,19 @@ func (o *ODA) Backup() error {
 	}
 	_, project := lib.GetProject()
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	uid, err := inc.IncusGetUid(project, "odoo")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "could not get odoo uid", err)
+		return nil
 	}
 
-	if err := exec.Command("incus", "exec", project, "--user", uid, "-t",
-		"--env", "HOME=/home/odoo", "--cwd", "/opt/odoo", "--",
-		"odas", "backup",
-	).Run(); err != nil {
+	if err := inc.Exec(project, incus.ExecOptions{
+		User: uid,
+		Cwd:  "/opt/odoo",
+		Env:  map[string]string{"HOME": "/home/odoo"},
+	}, "odas", "backup"); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error backing up project %v"), err)
 		return nil
 	}
@@ -109,10 +109,64 @@ func restoreAddonsTar(addonsFile string) error {
 func restoreDBTar(backupFile string, moveDB bool) error {
 	cwd, project := lib.GetProject()
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 	odooConf, _ := config.LoadOdooConfig(cwd)
 	source := filepath.Join(odaConf.Dirs.Project, "backups", backupFile)
 
+	dbname := odooConf.DbName
+	dbuser := odooConf.DbUser
+	dbpassword := odooConf.DbPassword
+
+	tarpgCmd := exec.Command("tar", "Oaxf", source, "./dump.sql")
+	dump, err := tarpgCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not read database dump %w", err)
+	}
+	if err := tarpgCmd.Start(); err != nil {
+		return fmt.Errorf("could not extract database dump %w", err)
+	}
+	dbhostTarget, err := restoreDatabase(inc, odaConf, odooConf, project, dump)
+	if err != nil {
+		tarpgCmd.Process.Kill()
+		tarpgCmd.Wait()
+		return err
+	}
+	if err := tarpgCmd.Wait(); err != nil {
+		return fmt.Errorf("could not extract database dump %w", err)
+	}
+
+	// restore data filestore
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restore postgresql database"))
+	data := filepath.Join(cwd, "data")
+	if err := RemoveContents(data); err != nil {
+		return fmt.Errorf("data files removal failed %w", err)
+	}
+	filestore := filepath.Join(data, "filestore", dbname)
+	if err := os.MkdirAll(filestore, 0o755); err != nil {
+		return fmt.Errorf("filestore directory creation failed %w", err)
+	}
+	tarCmd := exec.Command("tar",
+		"axf", source, "-C", filestore, "--strip-components=2", "./filestore",
+	)
+	if err := tarCmd.Run(); err != nil {
+		return fmt.Errorf("filestore restore failed %w", err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restored filestore "+dbname))
+
+	// if not moveDB then reset DBUUID and remove MCode
+	if !moveDB {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("neutralize the database"))
+		if err := dbReset(dbhostTarget, dbname, dbuser, dbpassword); err != nil {
+			return fmt.Errorf("db reset failed %w", err)
+		}
+	}
+	// fmt.Println("reset database " + dbname)
+	return nil
+}
+
+// restoreDatabase drops and recreates the project database and loads
+// the sql dump into it, it returns the host psql connected to
+func restoreDatabase(inc incus.Backend, odaConf *config.OdaConf, odooConf *config.OdooConfig, project string, dump io.Reader) (string, error) {
 	dbname := odooConf.DbName
 	dbhost := odooConf.DbHost
 	dbuser := odooConf.DbUser
@@ -125,84 +179,62 @@ func restoreDBTar(backupFile string, moveDB bool) error {
 	}
 	uid, err := inc.IncusGetUid(dbserver, "postgres")
 	if err != nil {
-		return fmt.Errorf("could not get postgres uid %w", err)
+		return "", fmt.Errorf("could not get postgres uid %w", err)
 	}
 
 	// drop target database
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("drop target database"))
-	if err := exec.Command("incus", "exec", dbserver, "--user", uid, "-t", "--",
+	if err := inc.Exec(dbserver, incus.ExecOptions{User: uid},
 		"dropdb", "--if-exists", "-U", "postgres", "-f", dbname,
-	).Run(); err != nil {
-		return fmt.Errorf("could not drop postgresql database %s error: %w", dbname, err)
+	); err != nil {
+		return "", fmt.Errorf("could not drop postgresql database %s error: %w", dbname, err)
 	}
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("dropped database "+dbname))
 
 	// create new postgresql database
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("create new postgresql database"))
-	if err := exec.Command("incus", "exec", dbserver, "--user", uid, "-t", "--",
+	if err := inc.Exec(dbserver, incus.ExecOptions{User: uid},
 		"createdb", "-U", "postgres",
 		"--encoding", "unicode",
 		"--lc-collate", "C",
 		"-T", dbtemplate,
 		"-O", dbuser, dbname,
-	).Run(); err != nil {
-		return fmt.Errorf("could not create postgresql database %s error: %w", dbname, err)
+	); err != nil {
+		return "", fmt.Errorf("could not create postgresql database %s error: %w", dbname, err)
 	}
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("created database "+dbname))
 
 	// restore postgresql database
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restore postgresql database"))
-	tarpgCmd := exec.Command("tar", "Oaxf", source, "./dump.sql")
-	dbhostTarget := dbhost + "." + odaConf.System.Domain
-	if dbhost == "localhost" {
-		dbInstance, _ := inc.GetInstance(project)
-		fmt.Println(dbInstance)
-		dbhostTarget = dbInstance.IP4
+	dbhostTarget, err := dbHostTarget(inc, odaConf, odooConf, project)
+	if err != nil {
+		return "", err
+	}
+	if err := inc.Exec(dbserver, incus.ExecOptions{
+		User:  uid,
+		Env:   map[string]string{"PGPASSWORD": dbpassword},
+		Stdin: dump,
+	}, "psql", "-h", dbhostTarget, "-U", dbuser, "--dbname", dbname, "-q"); err != nil {
+		return "", fmt.Errorf("could not restore postgresql database %s error: %w", dbname, err)
 	}
-
-	pgCmd := exec.Command("incus", "exec", dbserver, "--user", uid,
-		"--env", "PGPASSWORD="+dbpassword, "--",
-		"psql", "-h", dbhostTarget, "-U", dbuser, "--dbname", dbname, "-q")
-	pgCmd.Env = append(pgCmd.Env, "PGPASSWORD="+dbpassword)
-
-	r, w := io.Pipe()
-	tarpgCmd.Stdout = w
-	pgCmd.Stdin = r
-
-	tarpgCmd.Start()
-	pgCmd.Start()
-	tarpgCmd.Wait()
-	w.Close()
-	pgCmd.Wait()
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restored database "+dbname))
+	return dbhostTarget, nil
+}
 
-	// restore data filestore
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restore postgresql database"))
-	data := filepath.Join(cwd, "data")
-	if err := RemoveContents(data); err != nil {
-		return fmt.Errorf("data files removal failed %w", err)
+// dbHostTarget is the host to reach the project database on from the
+// database server, the instance address when odoo.conf uses localhost
+func dbHostTarget(inc incus.Backend, odaConf *config.OdaConf, odooConf *config.OdooConfig, project string) (string, error) {
+	if odooConf.DbHost != "localhost" {
+		return odooConf.DbHost + "." + odaConf.System.Domain, nil
 	}
-	filestore := filepath.Join(data, "filestore", dbname)
-	if err := os.MkdirAll(filestore, 0o755); err != nil {
-		return fmt.Errorf("filestore directory creation failed %w", err)
-	}
-	tarCmd := exec.Command("tar",
-		"axf", source, "-C", filestore, "--strip-components=2", "./filestore",
-	)
-	if err := tarCmd.Run(); err != nil {
-		return fmt.Errorf("filestore restore failed %w", err)
+	dbInstance, err := inc.GetInstance(project)
+	if err != nil {
+		return "", fmt.Errorf("could not get instance %s %w", project, err)
 	}
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restored filestore "+dbname))
-
-	// if not moveDB then reset DBUUID and remove MCode
-	if !moveDB {
-		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("neutralize the database"))
-		if err := dbReset(dbhostTarget, dbname, dbuser, dbpassword); err != nil {
-			return fmt.Errorf("db reset failed %w", err)
-		}
+	if dbInstance.IP4 == "" {
+		return "", fmt.Errorf("instance %s has no ipv4 address", project)
 	}
-	// fmt.Println("reset database " + dbname)
-	return nil
+	return dbInstance.IP4, nil
 }
 
 // func dbClone(dbhost, sourceDB, destDB, dbuser, dbpassword string) error {
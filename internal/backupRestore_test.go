@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBackup creates a backup archive laid out like the ones odas writes
+func writeBackup(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	fo, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fo.Close()
+	gz := gzip.NewWriter(fo)
+	tw := tar.NewWriter(gz)
+	for _, dir := range []string{"./", "./filestore/", "./filestore/ab/"} {
+		if err := tw.WriteHeader(&tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for fileName, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: fileName, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreDBTar(t *testing.T) {
+	p := setupProject(t)
+	p.backend.AddInstance("p1", "Stopped")
+	p.backend.AddInstance("db", "Running")
+	dump := "CREATE TABLE res_partner (id int);\n"
+	writeBackup(t, filepath.Join(p.odaConf.Dirs.Project, "backups", "p1_backup.tar.gz"), map[string]string{
+		"./dump.sql":                dump,
+		"./filestore/ab/abcdef0123": "attachment",
+	})
+	writeFile(t, filepath.Join(p.dir, "data", "stale"), "x")
+
+	if err := restoreDBTar("p1_backup.tar.gz", true); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalled(t, p.backend, "Exec",
+		"Exec db dropdb --if-exists -U postgres -f p1_local",
+		"Exec db createdb -U postgres --encoding unicode --lc-collate C -T template0 -O odoo p1_local",
+		"Exec db psql -h db.local -U odoo --dbname p1_local -q",
+	)
+	restored := false
+	for _, call := range p.backend.Calls {
+		if call.Method == "Exec" && len(call.Args) > 1 && call.Args[1] == "psql" {
+			restored = true
+			if call.Stdin != dump {
+				t.Errorf("psql received %q, want %q", call.Stdin, dump)
+			}
+		}
+	}
+	if !restored {
+		t.Fatal("dump was not fed to psql")
+	}
+
+	if _, err := os.Stat(filepath.Join(p.dir, "data", "stale")); !os.IsNotExist(err) {
+		t.Error("old data files not removed")
+	}
+	attachment, err := os.ReadFile(filepath.Join(p.dir, "data", "filestore", "p1_local", "ab", "abcdef0123"))
+	if err != nil {
+		t.Fatalf("filestore not restored %v", err)
+	}
+	if string(attachment) != "attachment" {
+		t.Errorf("attachment content %q", attachment)
+	}
+}
+
+func TestRestoreDBTarDropFails(t *testing.T) {
+	p := setupProject(t)
+	p.backend.AddInstance("db", "Stopped")
+
+	if err := restoreDBTar("missing.tar.gz", true); err == nil {
+		t.Fatal("expected error with the database instance stopped")
+	}
+	assertNotCalled(t, p.backend, "PushFile")
+	for _, call := range p.backend.CallsTo("Exec") {
+		if call != "Exec db dropdb --if-exists -U postgres -f p1_local" {
+			t.Errorf("unexpected exec after failed drop %q", call)
+		}
+	}
+}
@@ -2,14 +2,26 @@ package internal
 
 import (
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/ui"
 )
 
-func (o *ODA) BaseCreate() error {
+func (o *ODA) BaseCreate(instanceType string) error {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	instanceType, err = odaConf.InstanceType(&config.OdaProject{InstanceType: instanceType})
+	if err != nil {
+		return err
+	}
 	odooInstances := getBaseImages()
 
 	vers := []string{}
@@ -21,6 +33,9 @@ func (o *ODA) BaseCreate() error {
 	versMatch := []string{}
 	for _, repo := range vers {
 		repoVersion := "odoo-" + repo + "-0"
+		if instanceType == config.InstanceTypeVM {
+			repoVersion += config.VMSuffix
+		}
 		for _, odooInstance := range odooInstances {
 			if repoVersion == odooInstance {
 				versMatch = append(versMatch, repo)
@@ -52,7 +67,7 @@ func (o *ODA) BaseCreate() error {
 				Value(&version),
 
 			huh.NewConfirm().
-				Title("Create Odoo Base Image?").
+				Title("Create Odoo Base Image ("+instanceType+")?").
 				Value(&create),
 		),
 	)
@@ -60,7 +75,7 @@ func (o *ODA) BaseCreate() error {
 		return fmt.Errorf("create base form error %w", err)
 	}
 	if create {
-		if err := o.BaseCreateScript(version); err != nil {
+		if err := o.BaseCreateScript(version, instanceType); err != nil {
 			return fmt.Errorf("create base %s error %w", version, err)
 		}
 	}
@@ -104,11 +119,15 @@ func (o *ODA) BaseUpdate() error {
 	}
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
-	inc.SetInstanceState(version, "start")
+	if err := inc.SetInstanceState(version, "start"); err != nil {
+		return fmt.Errorf("starting base %s failed %w", version, err)
+	}
 	roleUpdate(version)
-	inc.SetInstanceState(version, "stop")
+	if err := inc.SetInstanceState(version, "stop"); err != nil {
+		return fmt.Errorf("stopping base %s failed %w", version, err)
+	}
 
 	return nil
 }
@@ -147,25 +166,183 @@ func (o *ODA) BaseDestroy() error {
 	}
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if destroy {
-		inc.SetInstanceState(version, "stop")
-		inc.DeleteInstance(version)
+		if err := inc.SetInstanceState(version, "stop"); err != nil {
+			return fmt.Errorf("stopping base %s failed %w", version, err)
+		}
+		if err := inc.DeleteInstance(version); err != nil {
+			return fmt.Errorf("destroy base %s failed %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// BasePublish
+// publish a built base instance as an image under its oda/ alias
+func (o *ODA) BasePublish() error {
+	odooInstances := getBaseImages()
+
+	if len(odooInstances) == 0 {
+		return fmt.Errorf("no base images found")
+	}
+
+	versionOptions := []huh.Option[string]{}
+	for _, version := range odooInstances {
+		versionOptions = append(versionOptions, huh.NewOption(version, version))
+	}
+
+	var (
+		version string
+		publish bool
+	)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Odoo Base Version").
+				Options(versionOptions...).
+				Value(&version),
+
+			huh.NewConfirm().
+				Title("Publish Odoo base image?").
+				Value(&publish),
+		),
+	)
+	if err := form.Run(); err != nil {
+		return fmt.Errorf("publish base form error %w", err)
+	}
+	if !publish {
+		return nil
+	}
+
+	branch, instanceType := branchForInstance(version)
+	if branch == nil {
+		return fmt.Errorf("no branch uses base %s", version)
+	}
+
+	odaConf, _ := config.LoadOdaConfig()
+	inc := newBackend(odaConf)
+
+	if err := inc.SetInstanceState(version, "stop"); err != nil {
+		return fmt.Errorf("stopping base %s failed %w", version, err)
+	}
+
+	alias := branch.ImageAlias(instanceType)
+	osName, osRelease, _ := strings.Cut(branch.Image, "/")
+	buildDate := time.Now().UTC().Format(time.RFC3339)
+	fingerprint, err := inc.PublishImage(version, map[string]string{
+		"description":    alias + " " + buildDate,
+		"os":             osName,
+		"release":        osRelease,
+		"oda.base":       version,
+		"oda.version":    branch.Version,
+		"oda.type":       instanceType,
+		"oda.build-date": buildDate,
+	})
+	if err != nil {
+		return fmt.Errorf("publish base %s failed %w", version, err)
+	}
+	if err := inc.SetImageAlias(alias, fingerprint, "oda base "+version); err != nil {
+		return fmt.Errorf("publish base %s failed %w", version, err)
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("base", version, "published as", alias))
+	return nil
+}
+
+// BaseImages
+// list the published base images, optionally pruning all but the
+// newest keep images of each base, aliased images are never pruned
+func (o *ODA) BaseImages(prune bool, keep int) error {
+	odaConf, _ := config.LoadOdaConfig()
+	inc := newBackend(odaConf)
+
+	images, err := inc.GetImages()
+	if err != nil {
+		return fmt.Errorf("could not list images %w", err)
+	}
+
+	odaImages := []incus.Image{}
+	for _, image := range images {
+		if image.Properties["oda.base"] != "" {
+			odaImages = append(odaImages, image)
+		}
+	}
+	sort.SliceStable(odaImages, func(a, b int) bool {
+		if odaImages[a].Properties["oda.base"] != odaImages[b].Properties["oda.base"] {
+			return odaImages[a].Properties["oda.base"] < odaImages[b].Properties["oda.base"]
+		}
+		return odaImages[a].CreatedAt.After(odaImages[b].CreatedAt)
+	})
+
+	rows := [][]string{}
+	stale := []incus.Image{}
+	seen := map[string]int{}
+	for _, image := range odaImages {
+		base := image.Properties["oda.base"]
+		seen[base]++
+		if seen[base] > keep && len(image.Aliases) == 0 {
+			stale = append(stale, image)
+		}
+		rows = append(rows, []string{
+			strings.Join(image.Aliases, ","),
+			image.ShortFingerprint(),
+			base,
+			image.Properties["oda.build-date"],
+			formatBytes(image.Size),
+		})
 	}
+	t := ui.NewTable().
+		Headers("ALIAS", "FINGERPRINT", "BASE", "BUILD DATE", "SIZE").
+		Rows(rows...)
+
+	fmt.Fprintln(os.Stderr, t)
 
+	if !prune {
+		return nil
+	}
+	if len(stale) == 0 {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("no images to prune"))
+		return nil
+	}
+	confim := areYouSure(fmt.Sprintf("prune %d old base images", len(stale)))
+	if !confim {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("pruning base images canceled"))
+		return nil
+	}
+	for _, image := range stale {
+		if err := inc.DeleteImage(image.Fingerprint); err != nil {
+			return fmt.Errorf("prune base images failed %w", err)
+		}
+	}
 	return nil
 }
 
+// branchForInstance returns the first branch built on the base instance
+// and the instance type the base was built as
+func branchForInstance(instanceName string) (*config.Branch, string) {
+	for _, branch := range config.GetBranches() {
+		for _, instanceType := range []string{config.InstanceTypeContainer, config.InstanceTypeVM} {
+			if branch.BaseInstanceName(instanceType) == instanceName {
+				return branch, instanceType
+			}
+		}
+	}
+	return nil, ""
+}
+
 func getBaseImages() []string {
 	versions := GetCurrentOdooRepos()
 	var odooVersions []string
 	for _, version := range versions {
-		odooVersions = append(odooVersions, "odoo-"+strings.ReplaceAll(version, ".", "-"))
+		baseName := "odoo-" + strings.ReplaceAll(version, ".", "-")
+		odooVersions = append(odooVersions, baseName, baseName+config.VMSuffix)
 	}
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
-	instances, err := inc.GetInstances()
+	inc := newBackend(odaConf)
+	instances, err := inc.GetInstances(incus.InstanceFilter{Prefix: "odoo-"})
 	if err != nil {
 		fmt.Println("getBaseImages error", err)
 	}
@@ -1,16 +1,18 @@
 package internal
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"html/template"
 	"os"
-	"os/exec"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
-	"github.com/ppreeper/oda/lib"
 	"github.com/ppreeper/oda/ui"
 )
 
@@ -22,7 +24,7 @@ func aptInstall(instanceName string, pkgs ...string) error {
 	pkg := []string{"apt-get", "install", "-y", "--no-install-recommends"}
 	pkg = append(pkg, pkgs...)
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, pkg...); err != nil {
 		return fmt.Errorf("apt-get install failed %w", err)
@@ -39,7 +41,7 @@ func npmInstall(instanceName string, pkgs ...string) error {
 	pkg = append(pkg, pkgs...)
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, pkg...); err != nil {
 		return fmt.Errorf("npm install failed %w", err)
@@ -47,12 +49,28 @@ func npmInstall(instanceName string, pkgs ...string) error {
 	return nil
 }
 
+// pushTemplate renders an embedded template straight into a file in the instance
+func pushTemplate(inc incus.Backend, instanceName string, embedFS embed.FS, tmpl, dest string, opts incus.FileOptions) error {
+	t, err := template.ParseFS(embedFS, "templates/"+tmpl)
+	if err != nil {
+		return fmt.Errorf("parse %s failed %w", tmpl, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]string{}); err != nil {
+		return fmt.Errorf("execute %s failed %w", tmpl, err)
+	}
+	if err := inc.PushFile(instanceName, dest, &buf, opts); err != nil {
+		return fmt.Errorf("push %s failed %w", tmpl, err)
+	}
+	return nil
+}
+
 func roleCaddy(instanceName string) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("install caddy to", instanceName))
 	url := "https://caddyserver.com/api/download?os=linux&arch=amd64&p=github.com%2Fcaddy-dns%2Fcloudflare"
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, "wget", "-qO", "/usr/local/bin/caddy", url); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -72,27 +90,15 @@ func roleCaddy(instanceName string) error {
 
 func roleCaddyService(instanceName string, embedFS embed.FS) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add caddy.service systemd file to", instanceName))
-	fo, err := os.Create("/tmp/caddy.service")
-	if err != nil {
-		return fmt.Errorf("create caddy.service failed %w", err)
-	}
-	defer fo.Close()
 
-	data := map[string]string{}
-	t, err := template.ParseFS(embedFS, "templates/caddy.service")
-	lib.CheckErr(err)
-	err = t.Execute(fo, data)
-	lib.CheckErr(err)
+	odaConf, _ := config.LoadOdaConfig()
+	inc := newBackend(odaConf)
 
-	if err := exec.Command("incus", "file", "push", "/tmp/caddy.service", instanceName+"/etc/systemd/system/caddy.service").Run(); err != nil {
-		return fmt.Errorf("push caddy.service failed %w", err)
+	if err := pushTemplate(inc, instanceName, embedFS, "caddy.service",
+		"/etc/systemd/system/caddy.service", incus.FileOptions{Mode: 0o644}); err != nil {
+		return err
 	}
 
-	os.Remove("/tmp/caddy.service")
-
-	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
-
 	if err := inc.IncusExec(instanceName, "systemctl", "daemon-reload"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return fmt.Errorf("systemctl daemon-reload failed %w", err)
@@ -123,7 +129,7 @@ func rolePostgresqlRepo(instanceName string) error {
 	}
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, "/usr/share/postgresql-common/pgdg/apt.postgresql.org.sh", "-y"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -157,93 +163,67 @@ func rolePostgresqlServer(instanceName string, dbVersion string) error {
 	return nil
 }
 
-func rolePostgresqlConf(instanceName string, embedFS embed.FS) error {
+func rolePostgresqlConf(instanceName, dbVersion string, embedFS embed.FS) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add postgresql.conf", instanceName))
 
 	odaConf, _ := config.LoadOdaConfig()
-	dbVersion := fmt.Sprintf("%d", odaConf.Database.Version)
+	inc := newBackend(odaConf)
 
-	localFile := "/tmp/" + instanceName + "-postgresql.conf"
-
-	fo, err := os.Create(localFile)
+	uid, err := inc.IncusGetUid(instanceName, "postgres")
 	if err != nil {
-		return fmt.Errorf("failed to create postgresql.conf: %w", err)
+		return fmt.Errorf("failed to get postgres uid: %w", err)
+	}
+	gid, err := inc.IncusGetGid(instanceName, "postgres")
+	if err != nil {
+		return fmt.Errorf("failed to get postgres gid: %w", err)
 	}
-	defer fo.Close()
-
-	data := map[string]string{}
-	t, err := template.ParseFS(embedFS, "templates/postgresql.conf")
-	lib.CheckErr(err)
-	err = t.Execute(fo, data)
-	lib.CheckErr(err)
 
-	if err := exec.Command("incus", "file", "push", localFile, instanceName+"/etc/postgresql/"+dbVersion+"/main/conf.d/postgresql.conf").Run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if err := pushTemplate(inc, instanceName, embedFS, "postgresql.conf",
+		"/etc/postgresql/"+dbVersion+"/main/conf.d/postgresql.conf",
+		incus.FileOptions{UID: uid, GID: gid, Mode: 0o644}); err != nil {
 		return fmt.Errorf("failed to push postgresql.conf: %w", err)
 	}
 
-	os.Remove(localFile)
-
 	return nil
 }
 
-func rolePghbaConf(instanceName string, embedFS embed.FS) error {
+func rolePghbaConf(instanceName, dbVersion string, embedFS embed.FS) error {
 	odaConf, err := config.LoadOdaConfig()
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
 
-	dbVersion := fmt.Sprintf("%d", odaConf.Database.Version)
+	inc := newBackend(odaConf)
 
-	localFile := "/tmp/" + instanceName + "-pg_hba.conf"
-
-	fo, err := os.Create(localFile)
+	uid, err := inc.IncusGetUid(instanceName, "postgres")
 	if err != nil {
-		return fmt.Errorf("failed to create pg_hba.conf: %w", err)
+		return fmt.Errorf("failed to get postgres uid: %w", err)
+	}
+	gid, err := inc.IncusGetGid(instanceName, "postgres")
+	if err != nil {
+		return fmt.Errorf("failed to get postgres gid: %w", err)
 	}
-	defer fo.Close()
-
-	data := map[string]string{}
-	t, err := template.ParseFS(embedFS, "templates/pg_hba.conf")
-	lib.CheckErr(err)
-	err = t.Execute(fo, data)
-	lib.CheckErr(err)
 
-	if err := exec.Command("incus", "file", "push", localFile, instanceName+"/etc/postgresql/"+dbVersion+"/main/pg_hba.conf").Run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if err := pushTemplate(inc, instanceName, embedFS, "pg_hba.conf",
+		"/etc/postgresql/"+dbVersion+"/main/pg_hba.conf",
+		incus.FileOptions{UID: uid, GID: gid, Mode: 0o640}); err != nil {
 		return fmt.Errorf("failed to push pg_hba.conf: %w", err)
 	}
 
-	os.Remove(localFile)
-
 	return nil
 }
 
 func rolePreeperRepo(instanceName string, embedFS embed.FS) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Add preeper.org repo:", instanceName))
 
-	fo, err := os.Create("/tmp/preeper.list")
-	if err != nil {
-		return fmt.Errorf("create preeper.list failed %w", err)
-	}
-	defer fo.Close()
-
-	data := map[string]string{}
-	t, err := template.ParseFS(embedFS, "templates/preeper.list")
-	if err != nil {
-		return fmt.Errorf("parse preeper.list failed %w", err)
-	}
-	err = t.Execute(fo, data)
-	if err != nil {
-		return fmt.Errorf("execute preeper.list failed %w", err)
-	}
+	odaConf, _ := config.LoadOdaConfig()
+	inc := newBackend(odaConf)
 
-	if err := exec.Command("incus", "file", "push", "/tmp/preeper.list", instanceName+"/etc/apt/sources.list.d/preeper.list").Run(); err != nil {
-		return fmt.Errorf("push preeper.list failed %w", err)
+	if err := pushTemplate(inc, instanceName, embedFS, "preeper.list",
+		"/etc/apt/sources.list.d/preeper.list", incus.FileOptions{Mode: 0o644}); err != nil {
+		return err
 	}
 
-	os.Remove("/tmp//preeper.list")
-
 	if err := roleUpdate(instanceName); err != nil {
 		return fmt.Errorf("roleUpdate %s failed %w", instanceName, err)
 	}
@@ -259,7 +239,7 @@ func roleWkhtmltopdf(instanceName string) error {
 	url := "https://github.com/wkhtmltopdf/packaging/releases/download/0.12.6.1-3/wkhtmltox_0.12.6.1-3.jammy_amd64.deb"
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, "wget", "-qO", "wkhtmltox.deb", url); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
@@ -280,27 +260,15 @@ func roleWkhtmltopdf(instanceName string) error {
 
 func roleOdooService(instanceName string, embedFS embed.FS) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add odoo.service systemd file to", instanceName))
-	fo, err := os.Create("/tmp/odoo.service")
-	if err != nil {
-		return fmt.Errorf("create odoo.service failed %w", err)
-	}
-	defer fo.Close()
 
-	data := map[string]string{}
-	t, err := template.ParseFS(embedFS, "templates/odoo.service")
-	lib.CheckErr(err)
-	err = t.Execute(fo, data)
-	lib.CheckErr(err)
+	odaConf, _ := config.LoadOdaConfig()
+	inc := newBackend(odaConf)
 
-	if err := exec.Command("incus", "file", "push", "/tmp/odoo.service", instanceName+"/etc/systemd/system/odoo.service").Run(); err != nil {
-		return fmt.Errorf("push odoo.service failed %w", err)
+	if err := pushTemplate(inc, instanceName, embedFS, "odoo.service",
+		"/etc/systemd/system/odoo.service", incus.FileOptions{Mode: 0o644}); err != nil {
+		return err
 	}
 
-	os.Remove("/tmp/odoo.service")
-
-	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
-
 	if err := inc.IncusExec(instanceName, "systemctl", "daemon-reload"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return fmt.Errorf("systemctl daemon-reload failed %w", err)
@@ -324,7 +292,7 @@ func roleGeoIP2DB(instanceName string) error {
 	}
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	for _, geo := range geolite {
 		fmt.Fprintln(os.Stderr, ui.OddRowStyle.Render("downloading", geo[0]))
@@ -341,7 +309,7 @@ func rolePaperSize(instanceName string) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("papersize:", instanceName))
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, "/usr/sbin/paperconfig", "-p", "letter"); err != nil {
 		return fmt.Errorf("papersize %s failed %w", instanceName, err)
@@ -350,20 +318,32 @@ func rolePaperSize(instanceName string) error {
 	return nil
 }
 
-func roleOdooUser(instanceName string) error {
+func roleOdooUser(instanceName, instanceType string) error {
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add odoo user to", instanceName))
 	odaConf, err := config.LoadOdaConfig()
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
+
+	uid, gid, err := odooIDs(instanceType)
+	if err != nil {
+		return err
+	}
+	// -o allows the host ids to clash with a user already in the image
+	groupadd := []string{"groupadd", "-f", "-g", strconv.Itoa(gid), "odoo"}
+	useradd := []string{"useradd", "-ms", "/bin/bash", "-g", strconv.Itoa(gid), "-u", strconv.Itoa(uid), "odoo"}
+	if instanceType == config.InstanceTypeVM {
+		groupadd = []string{"groupadd", "-o", "-g", strconv.Itoa(gid), "odoo"}
+		useradd = []string{"useradd", "-o", "-ms", "/bin/bash", "-g", strconv.Itoa(gid), "-u", strconv.Itoa(uid), "odoo"}
+	}
 
-	if err := inc.IncusExec(instanceName, "groupadd", "-f", "-g", "1001", "odoo"); err != nil {
+	if err := inc.IncusExec(instanceName, groupadd...); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
 		return fmt.Errorf("groupadd odoo failed %w", err)
 	}
 
-	if err := inc.IncusExec(instanceName, "useradd", "-ms", "/bin/bash", "-g", "1001", "-u", "1001", "odoo"); err != nil {
+	if err := inc.IncusExec(instanceName, useradd...); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
 		return fmt.Errorf("useradd odoo failed %w", err)
 	}
@@ -373,26 +353,15 @@ func roleOdooUser(instanceName string) error {
 		return fmt.Errorf("usermod odoo failed %w", err)
 	}
 
-	f, err := os.Create("/tmp/odoo.sudo")
-	if err != nil {
-		return fmt.Errorf("create odoo.sudo failed %w", err)
-	}
-	f.WriteString("odoo ALL=(ALL) NOPASSWD:ALL")
-	f.Close()
-
-	if err := exec.Command("incus", "file", "push", "/tmp/odoo.sudo", instanceName+"/etc/sudoers.d/odoo").Run(); err != nil {
+	if err := inc.PushFile(instanceName, "/etc/sudoers.d/odoo",
+		strings.NewReader("odoo ALL=(ALL) NOPASSWD:ALL\n"),
+		incus.FileOptions{Mode: 0o440}); err != nil {
 		return fmt.Errorf("push odoo.sudo failed %w", err)
 	}
 
-	if err := inc.IncusExec(instanceName, "chown", "root:root", "/etc/sudoers.d/odoo"); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
-		return fmt.Errorf("chown odoo failed %w", err)
-	}
-
-	os.Remove("/tmp/odoo.sudo")
-
 	// SSH key
-	if err := inc.IncusExec(instanceName, "mkdir", "/home/odoo/.ssh"); err != nil {
+	if err := inc.MkdirAll(instanceName, "/home/odoo/.ssh",
+		incus.FileOptions{UID: uid, GID: gid, Mode: 0o700}); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
 		return fmt.Errorf("mkdir /home/odoo/.ssh failed %w", err)
 	}
@@ -400,20 +369,15 @@ func roleOdooUser(instanceName string) error {
 	sshKey := odaConf.System.SSHKey
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("SSHKey:", sshKey))
 	homedir, _ := os.UserHomeDir()
-	sshKeyFile := filepath.Join(homedir, ".ssh", sshKey+".pub")
-
-	if err := exec.Command("incus", "file", "push", sshKeyFile, instanceName+"/home/odoo/.ssh/authorized_keys").Run(); err != nil {
-		return fmt.Errorf("push authorized_keys failed %w", err)
-	}
-
-	if err := inc.IncusExec(instanceName, "chmod", "0600", "/home/odoo/.ssh/authorized_keys"); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
-		return fmt.Errorf("chmod authorized_keys failed %w", err)
+	sshKeyFile, err := os.Open(filepath.Join(homedir, ".ssh", sshKey+".pub"))
+	if err != nil {
+		return fmt.Errorf("open ssh key failed %w", err)
 	}
+	defer sshKeyFile.Close()
 
-	if err := inc.IncusExec(instanceName, "chown", "-R", "odoo:odoo", "/home/odoo/.ssh"); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
-		return fmt.Errorf("chown odoo failed %w", err)
+	if err := inc.PushFile(instanceName, "/home/odoo/.ssh/authorized_keys", sshKeyFile,
+		incus.FileOptions{UID: uid, GID: gid, Mode: 0o600}); err != nil {
+		return fmt.Errorf("push authorized_keys failed %w", err)
 	}
 
 	return nil
@@ -428,7 +392,7 @@ func roleOdooDirs(instanceName string, dirs []string) error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	for _, dir := range dirList {
 		if err := inc.IncusExec(instanceName, "mkdir", "-p", "/opt/odoo/"+dir); err != nil {
@@ -452,7 +416,7 @@ func roleUpdate(instanceName string) error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	if err := inc.IncusExec(instanceName, "update"); err != nil {
 		return fmt.Errorf("roleUpdate: update failed %w", err)
@@ -469,26 +433,15 @@ func roleUpdateScript(instanceName string) error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
-	f, err := os.Create("/tmp/update.sh")
-	if err != nil {
-		return fmt.Errorf("create update.sh failed %w", err)
-	}
-	f.WriteString("#!/bin/bash" + "\n")
-	f.WriteString("sudo bash -c \"apt update -y && apt full-upgrade -y && apt autoremove -y && apt autoclean -y\"" + "\n")
-	f.Close()
+	updateScript := "#!/bin/bash" + "\n" +
+		"sudo bash -c \"apt update -y && apt full-upgrade -y && apt autoremove -y && apt autoclean -y\"" + "\n"
 
-	if err := exec.Command("incus", "file", "push", "/tmp/update.sh", instanceName+"/usr/local/bin/update").Run(); err != nil {
+	if err := inc.PushFile(instanceName, "/usr/local/bin/update", strings.NewReader(updateScript),
+		incus.FileOptions{Mode: 0o755}); err != nil {
 		return fmt.Errorf("push update.sh failed %w", err)
 	}
-
-	os.Remove("/tmp/update.sh")
-
-	if err := inc.IncusExec(instanceName, "chmod", "+x", "/usr/local/bin/update"); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(err.Error()))
-		return fmt.Errorf("chmod update failed %w", err)
-	}
 	return nil
 }
 
@@ -504,3 +457,25 @@ func roleUpdateScript(instanceName string) error {
 // 	}
 // 	return nil
 // }
+
+// odooIDs are the uid and gid of the odoo user, containers map the host
+// user onto 1001 with raw.idmap, virtual machines see the mounted project
+// files with the host ids so odoo gets the ids of the current user
+func odooIDs(instanceType string) (int, int, error) {
+	if instanceType != config.InstanceTypeVM {
+		return 1001, 1001, nil
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not get current user %w", err)
+	}
+	uid, err := strconv.Atoi(currentUser.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid %s %w", currentUser.Uid, err)
+	}
+	gid, err := strconv.Atoi(currentUser.Gid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid %s %w", currentUser.Gid, err)
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/ui"
+	"gopkg.in/yaml.v3"
+)
+
+// BranchList
+// list the odoo branches and the file each one is defined in
+func (o *ODA) BranchList() error {
+	branches, err := config.LoadBranches()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, branchTable(branches))
+	return nil
+}
+
+func branchTable(branches []*config.Branch) *table.Table {
+	rows := [][]string{}
+	for _, branch := range branches {
+		rows = append(rows, []string{
+			branch.Name, branch.Version, branch.Image, branch.InstanceName,
+			strings.Join(branch.Repos, ", "), branch.Source,
+		})
+	}
+	return ui.NewTable().
+		Headers("NAME", "VERSION", "IMAGE", "BASE", "REPOS", "SOURCE").
+		Rows(rows...)
+}
+
+// BranchShow
+// print the definition of a branch, by version or name, as branches.yaml
+// so it can be copied into the user file and changed
+func (o *ODA) BranchShow(version string) error {
+	branches, err := config.LoadBranches()
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		if branch.Version != version && branch.Name != version {
+			continue
+		}
+		out, err := yaml.Marshal(map[string][]*config.Branch{"branches": {branch}})
+		if err != nil {
+			return fmt.Errorf("could not marshal branch %w", err)
+		}
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("branch", branch.Name, "from", branch.Source))
+		fmt.Print(string(out))
+		return nil
+	}
+	return fmt.Errorf("unknown version %s", version)
+}
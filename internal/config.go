@@ -4,12 +4,21 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
 	"slices"
+	"strings"
 
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss/table"
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/lib"
+	"github.com/ppreeper/oda/secret"
+	"github.com/ppreeper/oda/ui"
 	"github.com/ppreeper/str"
 	"gopkg.in/yaml.v3"
 )
@@ -27,27 +36,22 @@ func (o *ODA) ConfigPyright() error {
 		return err
 	}
 
-	version := projectConf.Version
-	dirRepo := odaConf.Dirs.Repo
-
-	odoo := filepath.Join(dirRepo, version, "odoo")
-	enterprise := filepath.Join(dirRepo, version, "enterprise")
-	designThemes := filepath.Join(dirRepo, version, "design-themes")
-	industry := filepath.Join(dirRepo, version, "industry")
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get current working directory: %w", err)
+	}
+	return writePyrightConfig(odaConf, projectConf, cwd)
+}
 
+// writePyrightConfig writes pyrightconfig.json of the project in dir
+func writePyrightConfig(odaConf *config.OdaConf, projectConf *config.OdaProject, dir string) error {
 	cfg := map[string]any{}
 	cfg["venvPath"] = "."
 	cfg["venv"] = ".direnv"
 	cfg["executionEnvironments"] = []map[string]any{
 		{
-			"root": ".",
-			"extraPaths": []string{
-				odoo,
-				enterprise,
-				designThemes,
-				industry,
-				"addons",
-			},
+			"root":       ".",
+			"extraPaths": projectSourcePaths(odaConf, projectConf, dir),
 		},
 	}
 
@@ -56,12 +60,7 @@ func (o *ODA) ConfigPyright() error {
 		return fmt.Errorf("could not marshal pyright configuration: %w", err)
 	}
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("could not get current working directory: %w", err)
-	}
-
-	pyrightconfig, err := os.Create(filepath.Join(cwd, "pyrightconfig.json"))
+	pyrightconfig, err := os.Create(filepath.Join(dir, "pyrightconfig.json"))
 	if err != nil {
 		return fmt.Errorf("could not create pyrightconfig.json: %w", err)
 	}
@@ -88,20 +87,18 @@ func (o *ODA) ConfigVSCode() error {
 	if err != nil {
 		return fmt.Errorf("could not get current working directory: %w", err)
 	}
+	return writeVSCodeConfig(odaConf, projectConf, cwd)
+}
 
-	version := projectConf.Version
-	dirRepo := odaConf.Dirs.Repo
-
-	odoo := filepath.Join(dirRepo, version, "odoo")
-	enterprise := filepath.Join(dirRepo, version, "enterprise")
-	designThemes := filepath.Join(dirRepo, version, "design-themes")
-	industry := filepath.Join(dirRepo, version, "industry")
+// writeVSCodeConfig writes the .vscode launch and settings of the project in dir
+func writeVSCodeConfig(odaConf *config.OdaConf, projectConf *config.OdaProject, dir string) error {
+	odoo := filepath.Join(odaConf.Dirs.Repo, projectConf.Version, "odoo")
 
 	if _, err := os.Stat(odoo); os.IsNotExist(err) {
 		return fmt.Errorf("odoo version does not exist")
 	}
-	if _, err := os.Stat(filepath.Join(cwd, ".vscode")); os.IsNotExist(err) {
-		os.MkdirAll(filepath.Join(cwd, ".vscode"), 0o755)
+	if _, err := os.Stat(filepath.Join(dir, ".vscode")); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Join(dir, ".vscode"), 0o755)
 	}
 
 	// launch.json
@@ -128,7 +125,7 @@ func (o *ODA) ConfigVSCode() error {
 		return fmt.Errorf("could not marshal launch configuration: %w", err)
 	}
 
-	launch, err := os.Create(filepath.Join(cwd, ".vscode", "launch.json"))
+	launch, err := os.Create(filepath.Join(dir, ".vscode", "launch.json"))
 	if err != nil {
 		return fmt.Errorf("could not create launch.json: %w", err)
 	}
@@ -138,20 +135,14 @@ func (o *ODA) ConfigVSCode() error {
 	// settings.json
 	settingsCfg := map[string]any{}
 	settingsCfg["python.terminal.executeInFileDir"] = true
-	settingsCfg["python.analysis.extraPaths"] = []string{
-		odoo,
-		enterprise,
-		designThemes,
-		industry,
-		"addons",
-	}
+	settingsCfg["python.analysis.extraPaths"] = projectSourcePaths(odaConf, projectConf, dir)
 
 	settingsJSON, err := json.MarshalIndent(settingsCfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("could not marshal settings configuration: %w", err)
 	}
 
-	settings, err := os.Create(filepath.Join(cwd, ".vscode", "settings.json"))
+	settings, err := os.Create(filepath.Join(dir, ".vscode", "settings.json"))
 	if err != nil {
 		return fmt.Errorf("could not create settings.json: %w", err)
 	}
@@ -161,6 +152,26 @@ func (o *ODA) ConfigVSCode() error {
 	return nil
 }
 
+// projectSourcePaths are the addons sources of the project on the host for
+// editor analysis, the branch repositories of its edition, the project
+// addons and the extra addons repositories
+func projectSourcePaths(odaConf *config.OdaConf, projectConf *config.OdaProject, cwd string) []string {
+	dirRepo := filepath.Join(odaConf.Dirs.Repo, projectConf.Version)
+	paths := []string{filepath.Join(dirRepo, "odoo")}
+	if projectConf.IsEnterprise() {
+		paths = append(paths, filepath.Join(dirRepo, "enterprise"))
+	}
+	paths = append(paths,
+		filepath.Join(dirRepo, "design-themes"),
+		filepath.Join(dirRepo, "industry"),
+		"addons",
+	)
+	for _, addons := range projectConf.Addons {
+		paths = append(paths, addons.HostPath(cwd))
+	}
+	return paths
+}
+
 func (o *ODA) HostsUpdate(domain string) error {
 	sudouser, _ := os.LookupEnv("SUDO_USER")
 	if sudouser == "" {
@@ -176,7 +187,7 @@ func (o *ODA) HostsUpdate(domain string) error {
 	if domain == "" {
 		domain = odaConf.System.Domain
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	hosts, err := os.Open("/etc/hosts")
 	if err != nil {
@@ -200,7 +211,7 @@ func (o *ODA) HostsUpdate(domain string) error {
 
 	projects := GetCurrentOdooProjectsUser(sudouser)
 
-	instances, err := inc.GetInstances()
+	instances, err := inc.GetInstances(incus.InstanceFilter{})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "instances list failed %w", err)
 		return nil
@@ -212,18 +223,24 @@ func (o *ODA) HostsUpdate(domain string) error {
 		for _, project := range projects {
 			if instance.Name == project {
 				projectLines = append(projectLines,
-					str.RightLen(instance.IP4, " ", 16)+" "+instance.Name+"."+domain)
+					hostsLines(instance, instance.Name+"."+domain, odaConf.System.IPv6)...)
 			}
 		}
 	}
 
-	instance, err := inc.GetInstance(odaConf.Database.Host)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "instance %s not found %v\n", odaConf.Database.Host, err)
-		return nil
+	for i, db := range odaConf.DatabaseServers() {
+		instance, err := inc.GetInstance(db.Host)
+		if err != nil && i == 0 {
+			fmt.Fprintf(os.Stderr, "instance %s not found %v\n", db.Host, err)
+			return nil
+		}
+		if err != nil {
+			// a server in oda.yaml that was not created yet
+			continue
+		}
+		projectLines = append(projectLines,
+			hostsLines(instance, db.Host+"."+odaConf.System.Domain, odaConf.System.IPv6)...)
 	}
-	projectLines = append(projectLines,
-		str.RightLen(instance.IP4, " ", 16)+" "+odaConf.Database.Host+"."+odaConf.System.Domain)
 
 	newHostlines := []string{}
 	if begin == -1 && end == -1 {
@@ -251,6 +268,22 @@ func (o *ODA) HostsUpdate(domain string) error {
 	return nil
 }
 
+// hostsLines are the /etc/hosts entries of an instance, the AAAA entry is
+// only written with ipv6 set and an instance without addresses gets none
+func hostsLines(instance incus.Instance, hostname string, ipv6 bool) []string {
+	lines := []string{}
+	if instance.IP4 != "" {
+		lines = append(lines, str.RightLen(instance.IP4, " ", 16)+" "+hostname)
+	}
+	if ipv6 && instance.IP6 != "" {
+		lines = append(lines, str.RightLen(instance.IP6, " ", 40)+" "+hostname)
+	}
+	if len(lines) == 0 {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render(instance.Name, "has no address, skipped"))
+	}
+	return lines
+}
+
 func (o *ODA) ConfigInit() error {
 	HOME, err := os.UserHomeDir()
 	if err != nil {
@@ -276,15 +309,275 @@ func (o *ODA) ConfigInit() error {
 	}
 	fmt.Println(string(yamlOdaConfOut))
 
-	CFGDIR, err := os.UserConfigDir()
+	odaFile, err := config.OdaConfigFile()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
-	odaFile := filepath.Join(CFGDIR, "oda", "oda.yaml")
 	if _, err := os.Stat(odaFile); os.IsNotExist(err) {
-		os.MkdirAll(filepath.Join(CFGDIR, "oda"), 0o750)
+		os.MkdirAll(filepath.Dir(odaFile), 0o750)
 		os.WriteFile(odaFile, yamlOdaConfOut, 0o640)
 	}
 
+	// incus project holding the oda instances
+	odaConf, err = config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	if odaConf.Incus.Project != "" {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating incus project", odaConf.Incus.Project))
+		inc := newBackend(odaConf)
+		if err := inc.EnsureProject(); err != nil {
+			fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("could not create incus project, rerun oda config init once incus is available", err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// ConfigShow
+// print the effective config and where each setting came from,
+// the ODA_* environment, oda.yaml or neither
+func (o *ODA) ConfigShow() error {
+	odaConf, sources, err := config.LoadOdaConfigSources()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	odaFile, _ := config.OdaConfigFile()
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("config file", odaFile))
+	if name := odaConf.ActiveContext(); name != "" {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("context", name))
+	}
+	fmt.Fprintln(os.Stderr, configTable(odaConf.Settings(), sources))
+	return nil
+}
+
+func configTable(settings []config.Setting, sources map[string]string) *table.Table {
+	rows := [][]string{}
+	for _, setting := range settings {
+		source, ok := sources[setting.Key]
+		if !ok {
+			source = "unset"
+		}
+		value := setting.Value
+		if strings.HasSuffix(setting.Key, "password") && value != "" && !strings.HasPrefix(value, secret.Scheme) {
+			value = "********"
+		}
+		rows = append(rows, []string{setting.Key, value, source})
+	}
+	return ui.NewTable().
+		Headers("SETTING", "VALUE", "SOURCE").
+		Rows(rows...)
+}
+
+// odooManagedKeys are odoo.conf options oda rewrites from .oda.yaml
+var odooManagedKeys = map[string]string{
+	"addons_path": "oda create rewrites it from the addons in .oda.yaml",
+	"db_name":     "the database name comes from database in .oda.yaml",
+	"db_host":     "oda db use switches the project to another database server",
+}
+
+// ConfigOdooGet
+// print an option of the project odoo.conf, every option without a key
+func (o *ODA) ConfigOdooGet(key string) error {
+	if !IsProject() {
+		return nil
+	}
+	cwd, _ := lib.GetProject()
+	conf, err := config.LoadOdooConfFile(filepath.Join(cwd, "conf", "odoo.conf"))
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		for _, k := range conf.Keys() {
+			value, _ := conf.Get(k)
+			fmt.Println(k, "=", value)
+		}
+		return nil
+	}
+	value, ok := conf.Get(key)
+	if !ok {
+		return fmt.Errorf("%s is not set in odoo.conf", key)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// ConfigOdooSet
+// set an option of the project odoo.conf, keeping the rest of the file
+func (o *ODA) ConfigOdooSet(key, value string) error {
+	return configOdooChange(key, func(conf *config.OdooConfFile) bool {
+		if current, ok := conf.Get(key); ok && current == value {
+			return false
+		}
+		conf.Set(key, value)
+		return true
+	})
+}
+
+// ConfigOdooUnset
+// remove an option from the project odoo.conf so odoo uses its default
+func (o *ODA) ConfigOdooUnset(key string) error {
+	return configOdooChange(key, func(conf *config.OdooConfFile) bool {
+		return conf.Unset(key)
+	})
+}
+
+// configOdooChange applies change to the project odoo.conf and offers to
+// restart a running instance, odoo only reads its config on start
+func configOdooChange(key string, change func(conf *config.OdooConfFile) bool) error {
+	if !IsProject() {
+		return nil
+	}
+	cwd, project := lib.GetProject()
+	conf, err := config.LoadOdooConfFile(filepath.Join(cwd, "conf", "odoo.conf"))
+	if err != nil {
+		return err
+	}
+	if !change(conf) {
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("odoo.conf", key, "unchanged"))
+		return nil
+	}
+	if err := conf.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("odoo.conf", key, "updated"))
+	if hint, ok := odooManagedKeys[key]; ok {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render(key, "is managed by oda,", hint))
+	}
+
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+	instance, err := inc.GetInstance(project)
+	if err != nil || !strings.EqualFold(instance.State, "running") {
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("the change applies when", project, "starts"))
+		return nil
+	}
+	if !confirm("Restart " + project + " to apply the change?") {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("the change applies when", project, "restarts"))
+		return nil
+	}
+	if err := inc.SetInstanceState(project, "restart"); err != nil {
+		return fmt.Errorf("restarting %s failed %w", project, err)
+	}
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(project, "restarted"))
+	return nil
+}
+
+// ConfigProfileSync
+// reapply the oda profile from oda.yaml
+func (o *ODA) ConfigProfileSync() error {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("syncing profiles", incus.ProfileName, "and", incus.ProfileNameVM))
+	if err := inc.SyncProfile(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("idmap changes apply to running instances after a restart"))
+	return nil
+}
+
+// ConfigRemoteAdd
+// trust a remote incus server and switch oda.yaml to it
+// the server certificate fingerprint is pinned after confirmation
+// and a client certificate is generated when there is none yet
+func (o *ODA) ConfigRemoteAdd(remoteURL, token string) error {
+	// the file alone, environment overrides must not be saved into it
+	odaConf, err := config.LoadOdaConfigFile()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+
+	if !strings.Contains(remoteURL, "://") {
+		remoteURL = "https://" + remoteURL
+	}
+	u, err := url.Parse(remoteURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid remote url %s", remoteURL)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("remote url must use https")
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "8443")
+	}
+	u.Path = ""
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("connecting to", u.String()))
+	fingerprint, err := incus.ServerFingerprint(u.String())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("server certificate fingerprint:", fingerprint))
+	if !areYouSure("trust this server certificate") {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("adding remote canceled"))
+		return nil
+	}
+
+	cfgDir, err := os.UserConfigDir()
+	if err != nil {
+		return fmt.Errorf("could not get user config dir %w", err)
+	}
+	certFile := filepath.Join(cfgDir, "oda", "client.crt")
+	keyFile := filepath.Join(cfgDir, "oda", "client.key")
+	if _, err := os.Stat(certFile); os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("generating client certificate", certFile))
+		hostname, _ := os.Hostname()
+		currentUser, _ := user.Current()
+		commonName := "oda"
+		if currentUser != nil {
+			commonName = currentUser.Username + "@" + hostname
+		}
+		if err := os.MkdirAll(filepath.Dir(certFile), 0o750); err != nil {
+			return fmt.Errorf("could not create config dir %w", err)
+		}
+		if err := incus.GenerateClientCert(certFile, keyFile, commonName); err != nil {
+			return err
+		}
+	}
+
+	odaConf.Incus.Type = "https"
+	odaConf.Incus.URL = u.JoinPath("1.0").String()
+	odaConf.Incus.ClientCert = certFile
+	odaConf.Incus.ClientKey = keyFile
+	odaConf.Incus.ServerCA = ""
+	odaConf.Incus.ServerFingerprint = fingerprint
+	inc := incus.NewIncus(odaConf)
+
+	trusted, err := inc.IsTrusted()
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		if token == "" {
+			if err := huh.NewInput().
+				Title("Trust token (incus config trust add on the server)").
+				EchoMode(huh.EchoModePassword).
+				Value(&token).
+				Run(); err != nil {
+				return fmt.Errorf("trust token form error %w", err)
+			}
+		}
+		if err := inc.TrustAdd(strings.TrimSpace(token)); err != nil {
+			return err
+		}
+		if trusted, err = inc.IsTrusted(); err != nil {
+			return err
+		}
+		if !trusted {
+			return fmt.Errorf("server %s did not accept the client certificate", u.Host)
+		}
+	}
+
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("remote", u.Host, "added"))
 	return nil
 }
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ppreeper/oda/incus"
+)
+
+func TestHostsLines(t *testing.T) {
+	dual := incus.Instance{Name: "p1", IP4: "10.0.0.2", IP6: "fd42::2"}
+	tests := []struct {
+		name     string
+		instance incus.Instance
+		ipv6     bool
+		want     []string
+	}{
+		{"ipv4 only", dual, false, []string{"10.0.0.2         p1.local"}},
+		{"with ipv6", dual, true, []string{
+			"10.0.0.2         p1.local",
+			"fd42::2                                  p1.local",
+		}},
+		{"no ipv6 address", incus.Instance{Name: "p1", IP4: "10.0.0.2"}, true, []string{"10.0.0.2         p1.local"}},
+		{"no address", incus.Instance{Name: "p1"}, true, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostsLines(tt.instance, "p1.local", tt.ipv6); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigOdooSetUnset(t *testing.T) {
+	p := setupProject(t)
+	oda := &ODA{}
+	conf := filepath.Join(p.dir, "conf", "odoo.conf")
+	writeFile(t, conf, testOdooConf+"# added by hand\nlimit_time_real = 1200\n")
+
+	asked := 0
+	origConfirm := confirm
+	confirm = func(string) bool { asked++; return true }
+	t.Cleanup(func() { confirm = origConfirm })
+
+	// a stopped instance picks the change up when it starts
+	p.backend.AddInstance("p1", "Stopped")
+	if err := oda.ConfigOdooSet("workers", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 0 {
+		t.Error("restart offered for a stopped instance")
+	}
+
+	p.backend.Instances["p1"].State = "Running"
+	if err := oda.ConfigOdooSet("workers", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 0 {
+		t.Error("restart offered for an unchanged option")
+	}
+	if err := oda.ConfigOdooUnset("limit_time_real"); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 {
+		t.Errorf("restart offered %d times, want 1", asked)
+	}
+	assertCalled(t, p.backend, "SetInstanceState", "SetInstanceState p1 restart")
+
+	content, err := os.ReadFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testOdooConf + "# added by hand\nworkers = 4\n"; string(content) != want {
+		t.Errorf("odoo.conf\n%s\nwant\n%s", content, want)
+	}
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/ui"
+)
+
+// ContextList
+// list the contexts in oda.yaml, the active one is marked
+func (o *ODA) ContextList() error {
+	odaConf, err := config.LoadOdaConfigFile()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	fmt.Fprintln(os.Stderr, contextTable(odaConf))
+	return nil
+}
+
+func contextTable(odaConf *config.OdaConf) *table.Table {
+	active := odaConf.ActiveContext()
+	current := func(name string) string {
+		if name == active {
+			return "*"
+		}
+		return ""
+	}
+	rows := [][]string{{current(""), config.DefaultContext, "base settings"}}
+	for _, name := range odaConf.ContextNames() {
+		ctx := odaConf.Contexts[name]
+		settings := []string{}
+		for _, key := range ctx.Keys() {
+			section, setting, _ := strings.Cut(key, ".")
+			value := fmt.Sprint(ctx[section][setting])
+			if strings.HasSuffix(key, "password") {
+				value = "********"
+			}
+			settings = append(settings, key+"="+value)
+		}
+		rows = append(rows, []string{current(name), name, strings.Join(settings, " ")})
+	}
+	return ui.NewTable().
+		Headers("CURRENT", "NAME", "SETTINGS").
+		Rows(rows...)
+}
+
+// ContextUse
+// make name the current context, default goes back to the base settings
+func (o *ODA) ContextUse(name string) error {
+	odaConf, err := config.LoadOdaConfigFile()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	switch _, ok := odaConf.Contexts[name]; {
+	case name == config.DefaultContext:
+		odaConf.CurrentContext = ""
+	case ok:
+		odaConf.CurrentContext = name
+	default:
+		return fmt.Errorf("context %s not found", name)
+	}
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("switched to context", name))
+	return nil
+}
+
+// ContextAdd
+// add a context changing the given key=value settings
+func (o *ODA) ContextAdd(name string, settings []string, use bool) error {
+	odaConf, err := config.LoadOdaConfigFile()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	if name == config.DefaultContext || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid context name %q", name)
+	}
+	if _, ok := odaConf.Contexts[name]; ok {
+		return fmt.Errorf("context %s already exists", name)
+	}
+
+	ctx := config.OdaContext{}
+	for _, setting := range settings {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return fmt.Errorf("invalid setting %s, use key=value", setting)
+		}
+		if err := ctx.Set(strings.TrimSpace(key), value); err != nil {
+			return err
+		}
+	}
+	if odaConf.Contexts == nil {
+		odaConf.Contexts = map[string]config.OdaContext{}
+	}
+	odaConf.Contexts[name] = ctx
+	if use {
+		odaConf.CurrentContext = name
+	}
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("context", name, "added"))
+	if use {
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("switched to context", name))
+	}
+	return nil
+}
+
+// ContextRemove
+// remove a context, removing the current one goes back to the base settings
+func (o *ODA) ContextRemove(name string) error {
+	odaConf, err := config.LoadOdaConfigFile()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	if _, ok := odaConf.Contexts[name]; !ok {
+		return fmt.Errorf("context %s not found", name)
+	}
+	delete(odaConf.Contexts, name)
+	current := odaConf.CurrentContext == name
+	if current {
+		odaConf.CurrentContext = ""
+	}
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("context", name, "removed"))
+	if current {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("switched to context", config.DefaultContext))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+func TestContextAddUseRemove(t *testing.T) {
+	setupProject(t)
+	oda := &ODA{}
+
+	if err := oda.ContextAdd("build", []string{"database.host=pg", "incus.limit_cpu=8"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := oda.ContextAdd("build", nil, false); err == nil {
+		t.Error("added build twice")
+	}
+	if err := oda.ContextAdd(config.DefaultContext, nil, false); err == nil {
+		t.Error("added the default context")
+	}
+	if err := oda.ContextAdd("ci", []string{"database.port=five"}, false); err == nil {
+		t.Error("added an invalid setting")
+	}
+
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odaConf.Database.Host != "db" {
+		t.Errorf("host %s before use, want db", odaConf.Database.Host)
+	}
+
+	if err := oda.ContextUse("missing"); err == nil {
+		t.Error("used a missing context")
+	}
+	if err := oda.ContextUse("build"); err != nil {
+		t.Fatal(err)
+	}
+	if odaConf, _ = config.LoadOdaConfig(); odaConf.Database.Host != "pg" || odaConf.Incus.LimitCPU != 8 {
+		t.Errorf("build config %+v", odaConf)
+	}
+	if table := contextTable(odaConf).String(); !strings.Contains(table, "database.host=pg incus.limit_cpu=8") {
+		t.Errorf("context table\n%s", table)
+	}
+
+	if err := oda.ContextRemove("build"); err != nil {
+		t.Fatal(err)
+	}
+	odaConf, err = config.LoadOdaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odaConf.CurrentContext != "" || odaConf.Database.Host != "db" || len(odaConf.Contexts) != 0 {
+		t.Errorf("config after remove %+v", odaConf)
+	}
+}
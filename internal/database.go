@@ -4,9 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
+	"github.com/charmbracelet/lipgloss/table"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/ppreeper/oda/config"
@@ -52,64 +53,173 @@ func (db *Database) GetURI() {
 		db.Username, db.Password, db.Hostname, port, db.Database)
 }
 
-func (o *ODA) DBFullReset() error {
-	odaConf, _ := config.LoadOdaConfig()
-	dbHost := odaConf.Database.Host
+// dbServer loads oda.yaml and the database server called name, the
+// default server when name is empty
+func dbServer(name string) (*config.OdaConf, config.OdaDatabase, error) {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return nil, config.OdaDatabase{}, fmt.Errorf("load oda config failed %w", err)
+	}
+	db, err := odaConf.DatabaseServer(name)
+	if err != nil {
+		return nil, config.OdaDatabase{}, err
+	}
+	return odaConf, db, nil
+}
 
-	confim := ui.AreYouSure("reset the " + dbHost + " database server")
-	if !confim {
-		fmt.Fprintln(os.Stderr, "reset of the database server")
-		return nil
+// DBList
+// list the database servers and the projects using them
+func (o *ODA) DBList() error {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
 	}
+	inc := newBackend(odaConf)
+	fmt.Fprintln(os.Stderr, dbTable(odaConf, inc))
+	return nil
+}
 
-	if err := o.DBCreateScript(fmt.Sprintf("%d", odaConf.Database.Version)); err != nil {
-		fmt.Fprintln(os.Stderr, "error creating database script 1", err)
-		return nil
+func dbTable(odaConf *config.OdaConf, inc incus.Backend) *table.Table {
+	projects := map[string][]string{}
+	for _, project := range GetCurrentOdooProjects() {
+		projectConfig, err := config.LoadProjectConfigFrom(filepath.Join(odaConf.Dirs.Project, project))
+		if err != nil {
+			continue
+		}
+		db, err := odaConf.ProjectDatabase(projectConfig)
+		if err != nil {
+			continue
+		}
+		projects[db.Name] = append(projects[db.Name], project)
 	}
 
-	return nil
+	rows := [][]string{}
+	for _, db := range odaConf.DatabaseServers() {
+		state := "not created"
+		if instance, err := inc.GetInstance(db.Host); err == nil {
+			state = strings.ToLower(instance.State)
+		}
+		rows = append(rows, []string{
+			db.Name, db.Host, fmt.Sprintf("%d", db.Version), db.Image, state,
+			strings.Join(projects[db.Name], " "),
+		})
+	}
+	return ui.NewTable().
+		Headers("NAME", "HOST", "VERSION", "IMAGE", "STATE", "PROJECTS").
+		Rows(rows...)
 }
 
-func (o *ODA) DBLogs() error {
-	odaConf, _ := config.LoadOdaConfig()
-	dbHost := odaConf.Database.Host
-
-	podCmd := exec.Command("incus",
-		"exec", dbHost, "-t", "--",
-		"journalctl", "-f",
-	)
-	podCmd.Stdin = os.Stdin
-	podCmd.Stdout = os.Stdout
-	podCmd.Stderr = os.Stderr
-	if err := podCmd.Run(); err != nil {
+// DBCreate
+// create the instance of a database server that does not exist yet
+func (o *ODA) DBCreate(name string) error {
+	odaConf, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	inc := newBackend(odaConf)
+	if _, err := inc.GetInstance(db.Host); err == nil {
+		return fmt.Errorf("database server %s already exists, use oda db fullreset %s", db.Name, db.Name)
+	} else if !incus.IsNotFound(err) {
+		return fmt.Errorf("could not check instance %s %w", db.Host, err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating database server", db.Name, "postgresql", fmt.Sprintf("%d", db.Version)))
+	return o.DBCreateScript(db)
+}
+
+// DBUse
+// move the project to another database server, the database itself is
+// not copied, restore a backup after
+func (o *ODA) DBUse(name string) error {
+	if !IsProject() {
 		return nil
 	}
+	odaConf, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	cwd, project := lib.GetProject()
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return fmt.Errorf("load project config failed %w", err)
+	}
+	projectConfig.DBServer = db.Name
+	if def, _ := odaConf.DatabaseServer(""); db.Name == def.Name {
+		// the default server is left out so the project follows oda.yaml
+		projectConfig.DBServer = ""
+	}
+	if err := projectConfig.WriteConfig(filepath.Join(cwd, ".oda.yaml")); err != nil {
+		return err
+	}
+	if err := config.SetOdooConfValues(filepath.Join(cwd, "conf", "odoo.conf"), db.OdooConf()); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render(project, "uses database server", db.Name))
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("restart", project, "and restore a backup to move the database"))
 	return nil
 }
 
-func (o *ODA) DBEXEC() error {
-	odaConf, _ := config.LoadOdaConfig()
-
-	dbHost := odaConf.Database.Host
+func (o *ODA) DBFullReset(name string) error {
+	_, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	dbHost := db.Host
 
-	incusCmd := exec.Command("incus", "exec", dbHost, "-t", "--", "/bin/bash")
-	incusCmd.Stdin = os.Stdin
-	incusCmd.Stdout = os.Stdout
-	incusCmd.Stderr = os.Stderr
-	if err := incusCmd.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error executing %v"), err)
+	confim := areYouSure("reset the " + dbHost + " database server")
+	if !confim {
+		fmt.Fprintln(os.Stderr, "reset of the database server")
 		return nil
 	}
+
+	if err := o.DBCreateScript(db); err != nil {
+		return fmt.Errorf("reset database server %s failed %w", db.Name, err)
+	}
 	return nil
 }
 
-func (o *ODA) DBPSQL() error {
-	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+func (o *ODA) DBLogs(name string) error {
+	odaConf, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	inc := newBackend(odaConf)
+	dbHost := db.Host
+
+	return inc.Exec(dbHost, incus.ExecOptions{
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "journalctl", "-f")
+}
+
+func (o *ODA) DBEXEC(name string) error {
+	odaConf, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	inc := newBackend(odaConf)
+
+	dbHost := db.Host
 
-	dbHost := odaConf.Database.Host
+	return inc.Exec(dbHost, incus.ExecOptions{
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "/bin/bash")
+}
+
+func (o *ODA) DBPSQL(name string) error {
+	odaConf, db, err := dbServer(name)
+	if err != nil {
+		return err
+	}
+	inc := newBackend(odaConf)
+
+	dbHost := db.Host
 	dbuser := "postgres"
-	dbpassword := odaConf.Database.Password
+	dbpassword := db.Password
 	dbName := "postgres"
 
 	uid, err := inc.IncusGetUid(dbHost, dbuser)
@@ -118,63 +228,80 @@ func (o *ODA) DBPSQL() error {
 		return nil
 	}
 
-	incusCmd := exec.Command("incus", "exec", dbHost, "--user", uid,
-		"--env", "PGPASSWORD="+dbpassword, "-t", "--",
-		"psql", "-h", "127.0.0.1", "-U", dbuser, dbName,
-	)
-	incusCmd.Stdin = os.Stdin
-	incusCmd.Stdout = os.Stdout
-	incusCmd.Stderr = os.Stderr
-	if err := incusCmd.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, "error instance psql %w", err)
-	}
-	return nil
+	return inc.Exec(dbHost, incus.ExecOptions{
+		User:        uid,
+		Env:         map[string]string{"PGPASSWORD": dbpassword},
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "psql", "-h", "127.0.0.1", "-U", dbuser, dbName)
 }
 
-func (o *ODA) DBStart() error {
-	odaConf, err := config.LoadOdaConfig()
+func (o *ODA) DBStart(name string) error {
+	odaConf, db, err := dbServer(name)
 	if err != nil {
-		return fmt.Errorf("load oda config failed %w", err)
+		return err
 	}
-	inc := incus.NewIncus(odaConf)
-	dbHost := odaConf.Database.Host
+	inc := newBackend(odaConf)
+	dbHost := db.Host
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Starting", dbHost))
-	inc.SetInstanceState(dbHost, "start")
-	instanceStatus := inc.GetInstanceState(dbHost)
+	if err := inc.SetInstanceState(dbHost, "start"); err != nil {
+		return fmt.Errorf("starting %s failed %w", dbHost, err)
+	}
+	instanceStatus, err := inc.GetInstanceState(dbHost)
+	if err != nil {
+		return fmt.Errorf("getting %s state failed %w", dbHost, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(dbHost, instanceStatus.Metadata.Status))
 	return nil
 }
 
-func (o *ODA) DBStop() error {
-	odaConf, err := config.LoadOdaConfig()
+func (o *ODA) DBStop(name string) error {
+	odaConf, db, err := dbServer(name)
 	if err != nil {
-		return fmt.Errorf("load oda config failed %w", err)
+		return err
 	}
-	inc := incus.NewIncus(odaConf)
-	dbHost := odaConf.Database.Host
+	inc := newBackend(odaConf)
+	dbHost := db.Host
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Stopping", dbHost))
-	inc.SetInstanceState(dbHost, "stop")
-	instanceStatus := inc.GetInstanceState(dbHost)
+	if err := inc.SetInstanceState(dbHost, "stop"); err != nil {
+		return fmt.Errorf("stopping %s failed %w", dbHost, err)
+	}
+	instanceStatus, err := inc.GetInstanceState(dbHost)
+	if err != nil {
+		return fmt.Errorf("getting %s state failed %w", dbHost, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(dbHost, instanceStatus.Metadata.Status))
 	return nil
 }
 
-func (o *ODA) DBRestart() error {
-	odaConf, err := config.LoadOdaConfig()
+func (o *ODA) DBRestart(name string) error {
+	odaConf, db, err := dbServer(name)
 	if err != nil {
-		return fmt.Errorf("load oda config failed %w", err)
+		return err
 	}
-	inc := incus.NewIncus(odaConf)
-	dbHost := odaConf.Database.Host
+	inc := newBackend(odaConf)
+	dbHost := db.Host
 	// Stop
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Stopping", dbHost))
-	inc.SetInstanceState(dbHost, "stop")
-	instanceStatus := inc.GetInstanceState(dbHost)
+	if err := inc.SetInstanceState(dbHost, "stop"); err != nil {
+		return fmt.Errorf("stopping %s failed %w", dbHost, err)
+	}
+	instanceStatus, err := inc.GetInstanceState(dbHost)
+	if err != nil {
+		return fmt.Errorf("getting %s state failed %w", dbHost, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(dbHost, instanceStatus.Metadata.Status))
 	// Start
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Starting", dbHost))
-	inc.SetInstanceState(dbHost, "start")
-	instanceStatus = inc.GetInstanceState(dbHost)
+	if err := inc.SetInstanceState(dbHost, "start"); err != nil {
+		return fmt.Errorf("starting %s failed %w", dbHost, err)
+	}
+	instanceStatus, err = inc.GetInstanceState(dbHost)
+	if err != nil {
+		return fmt.Errorf("getting %s state failed %w", dbHost, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(dbHost, instanceStatus.Metadata.Status))
 	return nil
 }
@@ -185,7 +312,7 @@ func (o *ODA) Query() error {
 	}
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 	cwd, project := lib.GetProject()
 	odooConf, _ := config.LoadOdooConfig(cwd)
 	instance, err := inc.GetInstance(project)
@@ -194,14 +321,26 @@ func (o *ODA) Query() error {
 		return nil
 	}
 
+	if instance.IP4 == "" {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("instance", project, "has no ipv4 address"))
+		return nil
+	}
+
 	dbname := odooConf.DbName
 
+	// the password may be a secret:// reference to keep it out of the history
+	password, err := config.ResolveSecret(o.Q.Password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error reading password", err.Error()))
+		return nil
+	}
+
 	oc := odoojrpc.NewOdoo().
 		WithHostname(instance.IP4).
 		WithPort(8069).
 		WithDatabase(dbname).
 		WithUsername(o.Q.Username).
-		WithPassword(o.Q.Password).
+		WithPassword(password).
 		WithSchema("http")
 
 	err = oc.Login()
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+// addDatabaseServer adds the pg12 server to the oda.yaml of the test,
+// only the default server db has an instance
+func addDatabaseServer(t *testing.T, p *testProject) {
+	t.Helper()
+	p.backend.AddInstance("db", "Running")
+	p.odaConf.Databases = []config.OdaDatabase{{Name: "pg12", Version: 12, Image: "debian/11", Password: "pg12pass"}}
+	if err := config.SaveOdaConfig(p.odaConf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBUse(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+	oda := &ODA{}
+
+	if err := oda.DBUse("pg9"); err == nil {
+		t.Error("used a missing server")
+	}
+	if err := oda.DBUse("pg12"); err != nil {
+		t.Fatal(err)
+	}
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectConfig.DBServer != "pg12" {
+		t.Errorf("db_server %q", projectConfig.DBServer)
+	}
+	odooConf := filepath.Join(p.dir, "conf", "odoo.conf")
+	if host := config.ReadConfValue(odooConf, "db_host", ""); host != "pg12" {
+		t.Errorf("db_host %q", host)
+	}
+	if password := config.ReadConfValue(odooConf, "db_password", ""); password != "pg12pass" {
+		t.Errorf("db_password %q", password)
+	}
+
+	// back to the default server, which is left out of .oda.yaml
+	if err := oda.DBUse("db"); err != nil {
+		t.Fatal(err)
+	}
+	if projectConfig, _ = config.LoadProjectConfig(); projectConfig.DBServer != "" {
+		t.Errorf("db_server %q for the default server", projectConfig.DBServer)
+	}
+	if host := config.ReadConfValue(odooConf, "db_host", ""); host != "db" {
+		t.Errorf("db_host %q", host)
+	}
+}
+
+func TestDBCreateExisting(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+
+	if err := (&ODA{}).DBCreate(""); err == nil || !strings.Contains(err.Error(), "oda db fullreset db") {
+		t.Errorf("create existing db: %v", err)
+	}
+	if err := (&ODA{}).DBCreate("pg9"); err == nil {
+		t.Error("created a missing server")
+	}
+	assertNotCalled(t, p.backend, "CreateInstance")
+}
+
+func TestDBTable(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+	writeFile(t, filepath.Join(p.dir, ".oda.yaml"), "version: \"17.0\"\ndb_server: pg12\n")
+
+	odaConf, _ := config.LoadOdaConfig()
+	out := dbTable(odaConf, p.backend).String()
+	for _, want := range []string{"running", "not created", "debian/11", "p1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("db table has no %q\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "p1") && !strings.Contains(line, "pg12") {
+			t.Errorf("p1 listed under another server\n%s", line)
+		}
+	}
+}
+
+func TestOdooCreateDatabaseServer(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+	writeFile(t, filepath.Join(p.dir, ".oda.yaml"), "version: \"17.0\"\ndb_server: pg12\n")
+	p.backend.Aliases["oda/odoo-17.0"] = "latest"
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+	if host := config.ReadConfValue(filepath.Join(p.dir, "conf", "odoo.conf"), "db_host", ""); host != "pg12" {
+		t.Errorf("db_host %q, want pg12", host)
+	}
+
+	results := statuses(checkDBInstances(p.odaConf, p.backend))
+	if results["db instance"] != CheckPass || results["db instance pg12"] != CheckFail {
+		t.Errorf("db instance checks %v", results)
+	}
+}
+
+func TestDBFullResetFails(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+	p.backend.Errors["EnsureProject"] = errors.New("forbidden")
+
+	if err := (&ODA{}).DBFullReset("pg12"); err == nil || !strings.Contains(err.Error(), "reset database server pg12 failed") {
+		t.Errorf("failed reset returned %v", err)
+	}
+}
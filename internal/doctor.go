@@ -0,0 +1,376 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/ui"
+)
+
+// doctor check outcomes
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// CheckResult is the outcome of one oda doctor check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// lookPath and subidFiles are swapped in tests
+var (
+	lookPath   = exec.LookPath
+	subidFiles = []string{"/etc/subuid", "/etc/subgid"}
+)
+
+func pass(name, message string) CheckResult {
+	return CheckResult{Name: name, Status: CheckPass, Message: message}
+}
+
+func warn(name, message, hint string) CheckResult {
+	return CheckResult{Name: name, Status: CheckWarn, Message: message, Hint: hint}
+}
+
+func fail(name, message, hint string) CheckResult {
+	return CheckResult{Name: name, Status: CheckFail, Message: message, Hint: hint}
+}
+
+// Doctor
+// check the tools, incus connection, instances, directories and host
+// settings oda depends on, failures make the command exit non-zero
+func (o *ODA) Doctor(jsonOut bool) error {
+	var results []CheckResult
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		results = append(results, fail("oda.yaml", err.Error(), "run oda config init"))
+	} else {
+		results = append(results, pass("oda.yaml", "loaded"))
+		results = append(results, doctorChecks(odaConf, newBackend(odaConf))...)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == CheckFail {
+			failed++
+		}
+	}
+
+	if jsonOut {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling checks %w", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		fmt.Fprintln(os.Stderr, doctorTable(results))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// doctorChecks runs every check that needs a loaded oda.yaml
+func doctorChecks(odaConf *config.OdaConf, inc incus.Backend) []CheckResult {
+	var results []CheckResult
+	results = append(results, checkTools()...)
+	results = append(results, checkBranches())
+	results = append(results, checkDirs(odaConf)...)
+	results = append(results, checkSSH(odaConf)...)
+	results = append(results, checkSubids(odaConf)...)
+	incusResult := checkIncus(odaConf, inc)
+	results = append(results, incusResult)
+	if incusResult.Status == CheckFail {
+		return results
+	}
+	results = append(results, checkDBInstances(odaConf, inc)...)
+	results = append(results, checkProjects(odaConf, inc)...)
+	return results
+}
+
+// checkTools looks for the programs oda runs on the host
+func checkTools() []CheckResult {
+	tools := []struct {
+		name     string
+		required bool
+		use      string
+	}{
+		{"git", true, "cloning and updating the odoo repositories"},
+		{"tar", true, "restoring backups"},
+		{"sshconfig", false, "updating ~/.ssh/config on oda start"},
+		{"incus", false, "managing instances by hand, oda itself uses the incus api"},
+	}
+	var results []CheckResult
+	for _, tool := range tools {
+		name := "tool " + tool.name
+		path, err := lookPath(tool.name)
+		switch {
+		case err == nil:
+			results = append(results, pass(name, path))
+		case tool.required:
+			results = append(results, fail(name, tool.name+" not found in PATH", "install "+tool.name+", it is needed for "+tool.use))
+		default:
+			results = append(results, warn(name, tool.name+" not found in PATH", "install "+tool.name+" for "+tool.use))
+		}
+	}
+	return results
+}
+
+// checkBranches checks the branch definitions load
+func checkBranches() CheckResult {
+	branches, err := config.LoadBranches()
+	if err != nil {
+		return fail("branches", err.Error(), "fix the branches.yaml in the oda config dir, oda branch show prints a branch to start from")
+	}
+	return pass("branches", fmt.Sprintf("%d branches", len(branches)))
+}
+
+// checkDirs checks the project and repository directories and the
+// repositories cloned in them
+func checkDirs(odaConf *config.OdaConf) []CheckResult {
+	var results []CheckResult
+	for _, dir := range []struct{ name, path string }{
+		{"project dir", odaConf.Dirs.Project},
+		{"repo dir", odaConf.Dirs.Repo},
+	} {
+		if info, err := os.Stat(dir.path); err != nil || !info.IsDir() {
+			results = append(results, fail(dir.name, dir.path+" does not exist", "run oda config init"))
+		} else {
+			results = append(results, pass(dir.name, dir.path))
+		}
+	}
+
+	latest := config.GetBranchLatest()
+	var missing []string
+	for _, repo := range latest.Repos {
+		if _, err := os.Stat(filepath.Join(odaConf.Dirs.Repo, repo, ".git")); err != nil {
+			missing = append(missing, repo)
+		}
+	}
+	if len(missing) > 0 {
+		results = append(results, warn("base repos", "not cloned: "+strings.Join(missing, ", "), "run oda repo base clone"))
+	} else {
+		results = append(results, pass("base repos", strings.Join(latest.Repos, ", ")))
+	}
+	return results
+}
+
+// checkSSH checks the ssh config list oda start updates and the key
+// base images authorize
+func checkSSH(odaConf *config.OdaConf) []CheckResult {
+	var results []CheckResult
+	home, _ := os.UserHomeDir()
+
+	csv := filepath.Join(home, ".ssh", "sshconfig.csv")
+	hint := "create it with the header line priority;host;hostname;user;identityfile;port"
+	if content, err := os.ReadFile(csv); err != nil {
+		results = append(results, warn("sshconfig.csv", csv+" does not exist", hint))
+	} else if !strings.HasPrefix(string(content), "priority;") {
+		results = append(results, warn("sshconfig.csv", csv+" has no header line", hint))
+	} else {
+		results = append(results, pass("sshconfig.csv", csv))
+	}
+
+	key := filepath.Join(home, ".ssh", odaConf.System.SSHKey+".pub")
+	if _, err := os.Stat(key); err != nil {
+		results = append(results, warn("ssh key", key+" does not exist",
+			"run ssh-keygen or set system.ssh_key in oda.yaml, base create needs it"))
+	} else {
+		results = append(results, pass("ssh key", key))
+	}
+	return results
+}
+
+// checkSubids checks root may map the current user into containers, the
+// raw.idmap of the oda profile depends on it
+func checkSubids(odaConf *config.OdaConf) []CheckResult {
+	instanceType, _ := odaConf.InstanceType(nil)
+	if odaConf.Incus.Type != "unix" || instanceType == config.InstanceTypeVM {
+		return nil
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return []CheckResult{fail("subuid/subgid", err.Error(), "")}
+	}
+	ids := map[string]string{subidFiles[0]: currentUser.Uid, subidFiles[1]: currentUser.Gid}
+	var results []CheckResult
+	for _, file := range subidFiles {
+		id, _ := strconv.Atoi(ids[file])
+		name := filepath.Base(file)
+		if subidAllowed(file, "root", id) {
+			results = append(results, pass(name, fmt.Sprintf("root may map %d", id)))
+			continue
+		}
+		results = append(results, fail(name, fmt.Sprintf("root may not map %d", id),
+			fmt.Sprintf("echo root:%d:1 | sudo tee -a %s (see set_subuid_subgid.sh) and restart incus", id, file)))
+	}
+	return results
+}
+
+// subidAllowed looks for a range of owner in a subuid or subgid file that holds id
+func subidAllowed(file, owner string, id int) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 || fields[0] != owner {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 == nil && err2 == nil && id >= start && id < start+count {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIncus checks the incus api answers and the oda project exists
+func checkIncus(odaConf *config.OdaConf, inc incus.Backend) CheckResult {
+	hint := "check incus is running and the user is in the incus-admin group"
+	switch odaConf.Incus.Type {
+	case "unix":
+		if _, err := os.Stat(odaConf.Incus.Socket); err != nil {
+			return fail("incus", odaConf.Incus.Socket+" does not exist", "install and start incus, or set incus.socket in oda.yaml")
+		}
+	case "https":
+		hint = "check incus.url and the client certificate, oda config remote add sets them up"
+		for _, file := range []string{odaConf.Incus.ClientCert, odaConf.Incus.ClientKey} {
+			if _, err := os.Stat(file); err != nil {
+				return fail("incus", "client certificate "+file+" does not exist", hint)
+			}
+		}
+	}
+	if _, err := inc.GetInstances(incus.InstanceFilter{}); incus.IsNotFound(err) && odaConf.Incus.Project != "" {
+		return fail("incus", "incus project "+odaConf.Incus.Project+" does not exist", "run oda config init")
+	} else if err != nil {
+		return fail("incus", err.Error(), hint)
+	}
+	target := odaConf.Incus.Socket
+	if odaConf.Incus.Type == "https" {
+		target = odaConf.Incus.URL
+	}
+	return pass("incus", target)
+}
+
+// checkDBInstances checks the instance of each database server is running
+func checkDBInstances(odaConf *config.OdaConf, inc incus.Backend) []CheckResult {
+	var results []CheckResult
+	for i, db := range odaConf.DatabaseServers() {
+		name, create, start := "db instance", "run oda db fullreset", "run oda db start"
+		if i > 0 {
+			name += " " + db.Name
+			create, start = "run oda db create "+db.Name, start+" "+db.Name
+		}
+		instance, err := inc.GetInstance(db.Host)
+		switch {
+		case incus.IsNotFound(err):
+			results = append(results, fail(name, db.Host+" does not exist", create))
+		case err != nil:
+			results = append(results, fail(name, err.Error(), ""))
+		case !strings.EqualFold(instance.State, "running"):
+			results = append(results, warn(name, db.Host+" is "+strings.ToLower(instance.State), start))
+		default:
+			results = append(results, pass(name, db.Host+" is running"))
+		}
+	}
+	return results
+}
+
+// checkProjects checks each project config, the branch repositories it
+// mounts and the image its instance is created from
+func checkProjects(odaConf *config.OdaConf, inc incus.Backend) []CheckResult {
+	var results []CheckResult
+	for _, project := range GetCurrentOdooProjects() {
+		name := "project " + project
+		dir := filepath.Join(odaConf.Dirs.Project, project)
+		if _, err := os.Stat(filepath.Join(dir, ".oda.yaml")); err != nil {
+			// not a project, a leftover directory
+			continue
+		}
+		projectConfig, err := config.LoadProjectConfigFrom(dir)
+		if err != nil {
+			results = append(results, fail(name, err.Error(), "fix "+filepath.Join(dir, ".oda.yaml")))
+			continue
+		}
+		if _, err := odaConf.ProjectDatabase(projectConfig); err != nil {
+			results = append(results, fail(name, err.Error(), "add it to databases in oda.yaml or run oda db use"))
+			continue
+		}
+		branch := config.GetVersion(projectConfig.Version)
+
+		var missing []string
+		for _, repo := range branch.Repos {
+			if _, err := os.Stat(filepath.Join(odaConf.Dirs.Repo, projectConfig.Version, repo)); err != nil {
+				missing = append(missing, repo)
+			}
+		}
+		if len(missing) > 0 {
+			results = append(results, fail(name, projectConfig.Version+" repos not cloned: "+strings.Join(missing, ", "),
+				"run oda repo branch clone and pick "+projectConfig.Version))
+			continue
+		}
+
+		if _, err := inc.GetInstance(project); err == nil {
+			results = append(results, pass(name, projectConfig.Version))
+			continue
+		}
+		instanceType, err := odaConf.InstanceType(projectConfig)
+		if err != nil {
+			results = append(results, fail(name, err.Error(), ""))
+			continue
+		}
+		image := projectConfig.Image
+		if image == "" {
+			image = branch.ImageAlias(instanceType)
+		}
+		if found, err := imageExists(inc, image); err != nil {
+			results = append(results, fail(name, err.Error(), ""))
+		} else if !found {
+			results = append(results, warn(name, "no instance and no image "+image, "run oda base create and oda base publish"))
+		} else {
+			results = append(results, pass(name, projectConfig.Version+", no instance yet"))
+		}
+	}
+	return results
+}
+
+func doctorTable(results []CheckResult) *table.Table {
+	rows := [][]string{}
+	for _, r := range results {
+		rows = append(rows, []string{r.Name, r.Status, r.Message, r.Hint})
+	}
+	return ui.NewTable().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			switch {
+			case row != table.HeaderRow && col == 1 && rows[row][1] == CheckFail:
+				return ui.ErrorStyle
+			case row != table.HeaderRow && col == 1 && rows[row][1] == CheckWarn:
+				return ui.WarningStyle
+			default:
+				return ui.TableStyle(row, col)
+			}
+		}).
+		Headers("CHECK", "STATUS", "DETAIL", "FIX").
+		Rows(rows...)
+}
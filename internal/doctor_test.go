@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+// setupDoctor is a healthy environment around the test project
+func setupDoctor(t *testing.T) (*testProject, *config.OdaConf) {
+	t.Helper()
+	p := setupProject(t)
+
+	origLookPath, origSubids := lookPath, subidFiles
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	t.Cleanup(func() { lookPath, subidFiles = origLookPath, origSubids })
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subidFiles = []string{filepath.Join(p.root, "subuid"), filepath.Join(p.root, "subgid")}
+	writeFile(t, subidFiles[0], "root:100000:65536\nroot:"+u.Uid+":1\n")
+	writeFile(t, subidFiles[1], "root:"+u.Gid+":1\n")
+
+	for _, repo := range config.GetBranchLatest().Repos {
+		if err := os.MkdirAll(filepath.Join(p.odaConf.Dirs.Repo, repo, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, repo := range config.GetVersion("17.0").Repos {
+		if err := os.MkdirAll(filepath.Join(p.odaConf.Dirs.Repo, "17.0", repo), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(p.root, "home", ".ssh", p.odaConf.System.SSHKey+".pub"), "ssh-ed25519 AAAA")
+
+	odaConf := *p.odaConf
+	odaConf.Incus.Socket = filepath.Join(p.root, "unix.socket")
+	writeFile(t, odaConf.Incus.Socket, "")
+	p.backend.AddInstance("db", "Running")
+	p.backend.AddInstance("p1", "Running")
+	return p, &odaConf
+}
+
+// statuses maps check names to their status
+func statuses(results []CheckResult) map[string]string {
+	got := map[string]string{}
+	for _, r := range results {
+		got[r.Name] = r.Status
+	}
+	return got
+}
+
+func TestDoctorChecksPass(t *testing.T) {
+	p, odaConf := setupDoctor(t)
+
+	for _, r := range doctorChecks(odaConf, p.backend) {
+		if r.Status != CheckPass {
+			t.Errorf("%s %s: %s", r.Name, r.Status, r.Message)
+		}
+	}
+}
+
+func TestDoctorChecksFailures(t *testing.T) {
+	p, odaConf := setupDoctor(t)
+	lookPath = func(file string) (string, error) {
+		if file == "git" || file == "sshconfig" {
+			return "", exec.ErrNotFound
+		}
+		return "/usr/bin/" + file, nil
+	}
+	writeFile(t, subidFiles[0], "root:100000:65536\n")
+	os.Remove(filepath.Join(p.root, "home", ".ssh", "sshconfig.csv"))
+	os.RemoveAll(filepath.Join(p.odaConf.Dirs.Repo, "17.0", "enterprise"))
+	p.backend.Instances["db"].State = "Stopped"
+
+	got := statuses(doctorChecks(odaConf, p.backend))
+	for name, want := range map[string]string{
+		"tool git":       CheckFail,
+		"tool sshconfig": CheckWarn,
+		"tool tar":       CheckPass,
+		"subuid":         CheckFail,
+		"subgid":         CheckPass,
+		"sshconfig.csv":  CheckWarn,
+		"db instance":    CheckWarn,
+		"project p1":     CheckFail,
+	} {
+		if got[name] != want {
+			t.Errorf("%s = %q, want %q", name, got[name], want)
+		}
+	}
+}
+
+func TestDoctorIncusUnreachable(t *testing.T) {
+	p, odaConf := setupDoctor(t)
+	p.backend.Errors["GetInstances"] = fmt.Errorf("connection refused")
+
+	results := doctorChecks(odaConf, p.backend)
+	got := statuses(results)
+	if got["incus"] != CheckFail {
+		t.Errorf("incus = %q, want fail", got["incus"])
+	}
+	if _, ok := got["db instance"]; ok {
+		t.Error("instance checks ran without incus")
+	}
+
+	os.Remove(odaConf.Incus.Socket)
+	for _, r := range doctorChecks(odaConf, p.backend) {
+		if r.Name == "incus" && !strings.Contains(r.Message, "unix.socket does not exist") {
+			t.Errorf("incus message %q", r.Message)
+		}
+	}
+}
+
+func TestDoctorProjectImage(t *testing.T) {
+	p, odaConf := setupDoctor(t)
+	delete(p.backend.Instances, "p1")
+
+	if got := statuses(doctorChecks(odaConf, p.backend))["project p1"]; got != CheckWarn {
+		t.Errorf("project without instance or image = %q, want warn", got)
+	}
+	p.backend.Aliases["oda/odoo-17.0"] = "fingerprint"
+	if got := statuses(doctorChecks(odaConf, p.backend))["project p1"]; got != CheckPass {
+		t.Errorf("project with image = %q, want pass", got)
+	}
+}
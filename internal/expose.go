@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/lib"
+	"github.com/ppreeper/oda/ui"
+)
+
+// ports odoo listens on inside the instance
+const (
+	odooHTTPPort        = 8069
+	odooLongpollingPort = 8072
+)
+
+// proxy devices added by oda expose
+const (
+	exposeHTTPDevice        = "oda-http"
+	exposeLongpollingDevice = "oda-longpolling"
+)
+
+// OdooExpose
+// forward host ports to odoo in the project instance with proxy devices,
+// the ports are allocated from the expose range unless port is given
+// and kept in .oda.yaml so the project keeps them
+func (o *ODA) OdooExpose(port int) error {
+	if !IsProject() {
+		return nil
+	}
+	cwd, project := lib.GetProject()
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return fmt.Errorf("load project config failed %w", err)
+	}
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+
+	instance, err := inc.GetInstance(project)
+	if err != nil {
+		return fmt.Errorf("could not get instance %s %w", project, err)
+	}
+	// proxy devices of virtual machines need nat mode and a static address
+	if instance.Type == config.InstanceTypeVM {
+		return fmt.Errorf("expose is only supported for containers, %s is a virtual machine", project)
+	}
+
+	expose := projectConfig.Expose
+	if expose == nil || (port != 0 && port != expose.HTTPPort) {
+		expose, err = allocateExposePorts(odaConf, project, port)
+		if err != nil {
+			return err
+		}
+	}
+
+	listen := odaConf.System.ExposeListenAddress()
+	if err := inc.AddInstanceDevices(project, map[string]map[string]string{
+		exposeHTTPDevice: incus.ProxyDevice(
+			proxyAddress(listen, expose.HTTPPort), proxyAddress("127.0.0.1", odooHTTPPort)),
+		exposeLongpollingDevice: incus.ProxyDevice(
+			proxyAddress(listen, expose.LongpollingPort), proxyAddress("127.0.0.1", odooLongpollingPort)),
+	}); err != nil {
+		return fmt.Errorf("expose %s failed %w", project, err)
+	}
+
+	projectConfig.Expose = expose
+	if err := projectConfig.WriteConfig(filepath.Join(cwd, ".oda.yaml")); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render(project, "exposed at", exposeURL(odaConf, expose.HTTPPort)))
+	return nil
+}
+
+// OdooUnexpose
+// remove the proxy devices and release the ports
+func (o *ODA) OdooUnexpose() error {
+	if !IsProject() {
+		return nil
+	}
+	cwd, project := lib.GetProject()
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return fmt.Errorf("load project config failed %w", err)
+	}
+	if projectConfig.Expose == nil {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render(project, "is not exposed"))
+		return nil
+	}
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+
+	if err := inc.RemoveInstanceDevices(project, exposeHTTPDevice, exposeLongpollingDevice); err != nil && !incus.IsNotFound(err) {
+		return fmt.Errorf("unexpose %s failed %w", project, err)
+	}
+
+	projectConfig.Expose = nil
+	if err := projectConfig.WriteConfig(filepath.Join(cwd, ".oda.yaml")); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render(project, "unexposed"))
+	return nil
+}
+
+// allocateExposePorts picks the http and longpolling host ports, a requested
+// port is used as is, the others are the first free ones in the range
+func allocateExposePorts(odaConf *config.OdaConf, project string, port int) (*config.OdaExpose, error) {
+	first, last, err := odaConf.System.ExposePortRange()
+	if err != nil {
+		return nil, err
+	}
+	used := usedExposePorts(odaConf, project)
+	free := func(p int) bool {
+		return !used[p] && hostPortFree(odaConf, p)
+	}
+
+	httpPort := port
+	if httpPort != 0 {
+		if httpPort < 1 || httpPort > 65535 {
+			return nil, fmt.Errorf("invalid port %d", httpPort)
+		}
+		if !free(httpPort) {
+			return nil, fmt.Errorf("port %d is already in use", httpPort)
+		}
+	} else if httpPort = findFreePort(first, last, first, free); httpPort == 0 {
+		return nil, fmt.Errorf("no free port in %d-%d", first, last)
+	}
+	used[httpPort] = true
+
+	longpollingPort := findFreePort(first, last, httpPort+1, free)
+	if longpollingPort == 0 {
+		return nil, fmt.Errorf("no free port in %d-%d", first, last)
+	}
+	return &config.OdaExpose{HTTPPort: httpPort, LongpollingPort: longpollingPort}, nil
+}
+
+// findFreePort scans the range from start, wrapping around to first
+func findFreePort(first, last, start int, free func(int) bool) int {
+	if start < first || start > last {
+		start = first
+	}
+	for p := start; p <= last; p++ {
+		if free(p) {
+			return p
+		}
+	}
+	for p := first; p < start; p++ {
+		if free(p) {
+			return p
+		}
+	}
+	return 0
+}
+
+// usedExposePorts are the ports recorded by the other projects
+func usedExposePorts(odaConf *config.OdaConf, project string) map[int]bool {
+	used := map[int]bool{}
+	for _, name := range GetCurrentOdooProjects() {
+		if name == project {
+			continue
+		}
+		projectConfig, err := config.LoadProjectConfigFrom(filepath.Join(odaConf.Dirs.Project, name))
+		if err != nil || projectConfig.Expose == nil {
+			continue
+		}
+		used[projectConfig.Expose.HTTPPort] = true
+		used[projectConfig.Expose.LongpollingPort] = true
+	}
+	return used
+}
+
+// hostPortFree checks nothing else listens on the port, only possible
+// when Incus runs on this host
+func hostPortFree(odaConf *config.OdaConf, port int) bool {
+	if odaConf.Incus.Type != "unix" {
+		return true
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(odaConf.System.ExposeListenAddress(), strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+func proxyAddress(host string, port int) string {
+	return "tcp:" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// exposeURL is where an exposed port is reached from this machine
+func exposeURL(odaConf *config.OdaConf, port int) string {
+	host := odaConf.System.ExposeListenAddress()
+	switch host {
+	case "0.0.0.0", "::":
+		host = "localhost"
+		if odaConf.Incus.Type == "https" {
+			if u, err := url.Parse(odaConf.Incus.URL); err == nil {
+				host = u.Hostname()
+			}
+		}
+	case "127.0.0.1", "::1":
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// projectURL is the exposed url of the project, empty when it is not exposed
+func projectURL(odaConf *config.OdaConf, project string) string {
+	projectConfig, err := config.LoadProjectConfigFrom(filepath.Join(odaConf.Dirs.Project, project))
+	if err != nil || projectConfig.Expose == nil {
+		return ""
+	}
+	return exposeURL(odaConf, projectConfig.Expose.HTTPPort)
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+// setupExpose gives the project a port range and a second project p2
+// that already holds the first two ports of it
+func setupExpose(t *testing.T) *testProject {
+	t.Helper()
+	p := setupProject(t)
+	p.odaConf.System.ExposePorts = "47100-47199"
+	if err := config.SaveOdaConfig(p.odaConf); err != nil {
+		t.Fatal(err)
+	}
+	p2 := filepath.Join(p.odaConf.Dirs.Project, "p2")
+	if err := os.MkdirAll(p2, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(p2, ".oda.yaml"), "version: \"17.0\"\nexpose:\n  http_port: 47100\n  longpolling_port: 47101\n")
+	p.backend.AddInstance("p1", "Running")
+	return p
+}
+
+func TestOdooExpose(t *testing.T) {
+	p := setupExpose(t)
+
+	if err := (&ODA{}).OdooExpose(0); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := p.backend.Instances["p1"].Devices
+	if got := devices[exposeHTTPDevice]; got["type"] != "proxy" ||
+		got["listen"] != "tcp:127.0.0.1:47102" || got["connect"] != "tcp:127.0.0.1:8069" {
+		t.Errorf("http proxy device %v", got)
+	}
+	if got := devices[exposeLongpollingDevice]; got["listen"] != "tcp:127.0.0.1:47103" ||
+		got["connect"] != "tcp:127.0.0.1:8072" {
+		t.Errorf("longpolling proxy device %v", got)
+	}
+
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectConfig.Expose == nil || *projectConfig.Expose != (config.OdaExpose{HTTPPort: 47102, LongpollingPort: 47103}) {
+		t.Errorf("recorded ports %+v", projectConfig.Expose)
+	}
+	if projectConfig.Version != "17.0" {
+		t.Errorf("version lost from .oda.yaml, got %q", projectConfig.Version)
+	}
+	if got := projectURL(p.odaConf, "p1"); got != "http://localhost:47102" {
+		t.Errorf("project url %q", got)
+	}
+
+	// exposing again keeps the recorded ports
+	if err := (&ODA{}).OdooExpose(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := devices[exposeHTTPDevice]["listen"]; got != "tcp:127.0.0.1:47102" {
+		t.Errorf("ports changed on expose again, listen %s", got)
+	}
+}
+
+func TestOdooExposePort(t *testing.T) {
+	p := setupExpose(t)
+
+	if err := (&ODA{}).OdooExpose(47150); err != nil {
+		t.Fatal(err)
+	}
+	devices := p.backend.Instances["p1"].Devices
+	if got := devices[exposeHTTPDevice]["listen"]; got != "tcp:127.0.0.1:47150" {
+		t.Errorf("http listen %s", got)
+	}
+	if got := devices[exposeLongpollingDevice]["listen"]; got != "tcp:127.0.0.1:47151" {
+		t.Errorf("longpolling listen %s", got)
+	}
+
+	if err := (&ODA{}).OdooExpose(47100); err == nil {
+		t.Error("expected error for a port held by p2")
+	}
+}
+
+func TestOdooExposeVirtualMachine(t *testing.T) {
+	p := setupExpose(t)
+	p.backend.Instances["p1"].Type = config.InstanceTypeVM
+
+	if err := (&ODA{}).OdooExpose(0); err == nil {
+		t.Fatal("expected error for a virtual machine")
+	}
+	assertNotCalled(t, p.backend, "AddInstanceDevices")
+}
+
+func TestOdooUnexpose(t *testing.T) {
+	p := setupExpose(t)
+	if err := (&ODA{}).OdooExpose(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&ODA{}).OdooUnexpose(); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := p.backend.Instances["p1"].Devices
+	if _, ok := devices[exposeHTTPDevice]; ok {
+		t.Error("http proxy device not removed")
+	}
+	if _, ok := devices[exposeLongpollingDevice]; ok {
+		t.Error("longpolling proxy device not removed")
+	}
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectConfig.Expose != nil {
+		t.Errorf("ports still recorded %+v", projectConfig.Expose)
+	}
+}
+
+func TestFindFreePort(t *testing.T) {
+	used := map[int]bool{10: true, 12: true, 13: true}
+	free := func(p int) bool { return !used[p] }
+	tests := []struct {
+		start, want int
+	}{
+		{10, 11},
+		{12, 14},
+		{20, 11},
+		{14, 14},
+	}
+	for _, tt := range tests {
+		if got := findFreePort(10, 14, tt.start, free); got != tt.want {
+			t.Errorf("start %d got %d, want %d", tt.start, got, tt.want)
+		}
+	}
+	if got := findFreePort(10, 10, 10, free); got != 0 {
+		t.Errorf("full range got %d", got)
+	}
+}
@@ -32,7 +32,17 @@ func RemoveContents(dir string) error {
 	return nil
 }
 
+// GetGitHubUsernameToken is the github login used to clone the enterprise
+// repositories, the secrets github/username and github/token are used
+// when they are set, then the https credentials in ~/.gitcreds
 func GetGitHubUsernameToken() (username, token string) {
+	if store, err := config.OpenSecretStore(); err == nil {
+		username, userErr := store.Get("github/username")
+		token, tokenErr := store.Get("github/token")
+		if userErr == nil && tokenErr == nil {
+			return username, token
+		}
+	}
 	homedir, err := os.UserHomeDir()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -164,6 +174,20 @@ func IsProject() bool {
 	return true
 }
 
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // existsIn searches list for value
 func existsIn[T comparable](sliceList []T, value T) bool {
 	for _, item := range sliceList {
@@ -1,146 +1,199 @@
 package internal
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"time"
 
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
 	"github.com/ppreeper/oda/ui"
 )
 
-// base odoo image
-func (o *ODA) BaseCreateScript(version string) error {
-	fmt.Println("BaseCreateScript")
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating base image for Odoo version", version))
+// base odoo image, built as a container or a virtual machine
+func (o *ODA) BaseCreateScript(version, instanceType string) error {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Creating", instanceType, "base image for Odoo version", version))
 	branchConfig := config.GetVersion(version)
-	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
-
-	// TODO: add cpu and memory limits
-	inc.CreateInstance(branchConfig.InstanceName, branchConfig.Image, odaConf.Incus.LimitCPU, odaConf.Incus.LimitMemory)
+	if branchConfig == nil {
+		return fmt.Errorf("unknown version %s", version)
+	}
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+	instanceName := branchConfig.BaseInstanceName(instanceType)
 
-	inc.WaitForInstance(branchConfig.InstanceName, "RUNNING")
+	if err := inc.EnsureProject(); err != nil {
+		return fmt.Errorf("create incus project failed %w", err)
+	}
+	if err := inc.SyncProfile(); err != nil {
+		return fmt.Errorf("sync profile failed %w", err)
+	}
+	if err := inc.CreateInstance(instanceName, branchConfig.Image, instanceType,
+		[]string{"default", incus.ProfileFor(instanceType)}, nil); err != nil {
+		return fmt.Errorf("create base instance %s failed %w", instanceName, err)
+	}
 
-	roleUpdateScript(branchConfig.InstanceName)
+	if err := roleUpdateScript(instanceName); err != nil {
+		return err
+	}
 
-	rolePreeperRepo(branchConfig.InstanceName, o.EmbedFS)
+	if err := rolePreeperRepo(instanceName, o.EmbedFS); err != nil {
+		return err
+	}
 
-	inc.IncusExecVerbose(branchConfig.InstanceName, "odas", "welcome")
+	if err := inc.IncusExecVerbose(instanceName, "odas", "welcome"); err != nil {
+		return fmt.Errorf("odas welcome failed %w", err)
+	}
 
 	// roleGupScript(config.InstanceName)
 
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add common system packages to", branchConfig.InstanceName))
-	if err := aptInstall(branchConfig.InstanceName, branchConfig.BaselinePackages...); err != nil {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add common system packages to", instanceName))
+	if err := aptInstall(instanceName, branchConfig.BaselinePackages...); err != nil {
 		return fmt.Errorf("apt-get install baseline failed %w", err)
 	}
 
-	rolePostgresqlRepo(branchConfig.InstanceName)
+	if err := rolePostgresqlRepo(instanceName); err != nil {
+		return err
+	}
 
-	rolePostgresqlClient(branchConfig.InstanceName, fmt.Sprintf("%d", odaConf.Database.Version))
+	// the newest client works with every database server
+	if err := rolePostgresqlClient(instanceName, fmt.Sprintf("%d", odaConf.NewestDatabaseVersion())); err != nil {
+		return err
+	}
 
-	roleWkhtmltopdf(branchConfig.InstanceName)
+	if err := roleWkhtmltopdf(instanceName); err != nil {
+		return err
+	}
 
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add odoo dependencies to", branchConfig.InstanceName))
-	if err := aptInstall(branchConfig.InstanceName, branchConfig.Odoobase...); err != nil {
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("add odoo dependencies to", instanceName))
+	if err := aptInstall(instanceName, branchConfig.Odoobase...); err != nil {
 		return fmt.Errorf("apt-get install baseline failed %w", err)
 	}
 
-	npmInstall(branchConfig.InstanceName, "rtlcss")
+	if err := npmInstall(instanceName, "rtlcss"); err != nil {
+		return err
+	}
 
-	roleGeoIP2DB(branchConfig.InstanceName)
+	if err := roleGeoIP2DB(instanceName); err != nil {
+		return err
+	}
 
-	rolePaperSize(branchConfig.InstanceName)
+	if err := rolePaperSize(instanceName); err != nil {
+		return err
+	}
 
-	roleOdooUser(branchConfig.InstanceName)
+	if err := roleOdooUser(instanceName, instanceType); err != nil {
+		return err
+	}
 
-	roleOdooDirs(branchConfig.InstanceName, branchConfig.Repos)
+	if err := roleOdooDirs(instanceName, branchConfig.Repos); err != nil {
+		return err
+	}
 
-	roleCaddy(branchConfig.InstanceName)
+	if err := roleCaddy(instanceName); err != nil {
+		return err
+	}
 
-	roleCaddyService(branchConfig.InstanceName, o.EmbedFS)
+	if err := roleCaddyService(instanceName, o.EmbedFS); err != nil {
+		return err
+	}
 
-	roleOdooService(branchConfig.InstanceName, o.EmbedFS)
+	if err := roleOdooService(instanceName, o.EmbedFS); err != nil {
+		return err
+	}
 
-	inc.SetInstanceState(branchConfig.InstanceName, "stop")
+	if err := inc.SetInstanceState(instanceName, "stop"); err != nil {
+		return fmt.Errorf("stop base instance %s failed %w", instanceName, err)
+	}
 
 	return nil
 }
 
-func (o *ODA) DBCreateScript(version string) error {
-	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
-	dbHost := odaConf.Database.Host
-	dbUsername := odaConf.Database.Username
-	dbPassword := odaConf.Database.Password
+// DBCreateScript
+// (re)create the instance of a database server
+func (o *ODA) DBCreateScript(db config.OdaDatabase) error {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+	dbHost := db.Host
+	dbVersion := fmt.Sprintf("%d", db.Version)
+	dbUsername := db.Username
+	dbPassword := db.Password
+
+	if err := inc.EnsureProject(); err != nil {
+		return fmt.Errorf("create incus project failed %w", err)
+	}
 
 	// Destroy Database Instance
-	inc.SetInstanceState(dbHost, "stop")
-	inc.DeleteInstance(dbHost)
-	time.Sleep(5 * time.Second) // debounce timer
+	if err := inc.SetInstanceState(dbHost, "stop"); err != nil && !incus.IsNotFound(err) {
+		return fmt.Errorf("stop database instance %s failed %w", dbHost, err)
+	}
+	if err := inc.DeleteInstance(dbHost); err != nil && !incus.IsNotFound(err) {
+		return fmt.Errorf("delete database instance %s failed %w", dbHost, err)
+	}
 
 	// Create Database Instance
-	inc.CreateInstance(dbHost, odaConf.Database.Image, 4, "4GiB")
-	inc.SetInstanceState(dbHost, "start")
-	time.Sleep(5 * time.Second) // debounce timer
+	if err := inc.CreateInstance(dbHost, db.Image, config.InstanceTypeContainer, []string{"default"}, map[string]string{
+		"limits.cpu":    "4",
+		"limits.memory": "4GiB",
+	}); err != nil {
+		return fmt.Errorf("create database instance %s failed %w", dbHost, err)
+	}
 
 	// Start Installation Process
-	roleUpdateScript(dbHost)
+	if err := roleUpdateScript(dbHost); err != nil {
+		return err
+	}
 
 	// PostgreSQL Config
-	rolePostgresqlRepo(dbHost)
-	rolePostgresqlServer(dbHost, fmt.Sprintf("%d", odaConf.Database.Version))
+	if err := rolePostgresqlRepo(dbHost); err != nil {
+		return err
+	}
+	if err := rolePostgresqlServer(dbHost, dbVersion); err != nil {
+		return err
+	}
 
 	// postgresql.conf
-	rolePostgresqlConf(dbHost, o.EmbedFS)
+	if err := rolePostgresqlConf(dbHost, dbVersion, o.EmbedFS); err != nil {
+		return err
+	}
 
 	// pg_hba.conf
-	rolePghbaConf(dbHost, o.EmbedFS)
+	if err := rolePghbaConf(dbHost, dbVersion, o.EmbedFS); err != nil {
+		return err
+	}
 
 	// Setup User Roles
 	uid, err := inc.IncusGetUid(dbHost, "postgres")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "failed to get postgres uid %w", err)
-		return nil
+		return fmt.Errorf("failed to get postgres uid %w", err)
 	}
 
 	// Alter postgres Role
-	err = exec.Command("incus", "exec", dbHost, "--user", uid, "-t", "--",
-		"psql", "-c", "ALTER ROLE postgres WITH ENCRYPTED PASSWORD '"+dbPassword+"';").Run()
-	if err != nil {
-		if errors.Is(err, exec.ErrWaitDelay) {
-			fmt.Fprintln(os.Stderr, "failed to alter postgres role %w", err)
-			return nil
-		}
+	if err := inc.Exec(dbHost, incus.ExecOptions{User: uid},
+		"psql", "-c", "ALTER ROLE postgres WITH ENCRYPTED PASSWORD '"+dbPassword+"';"); err != nil {
+		return fmt.Errorf("failed to alter postgres role %w", err)
 	}
 
 	// add pg_stat_statements to postgres database
-	err = exec.Command("incus", "exec", dbHost, "--user", uid, "-t", "--",
-		"psql", "-c", "CREATE EXTENSION IF NOT EXISTS pg_stat_statements;").Run()
-	if err != nil {
-		if errors.Is(err, exec.ErrWaitDelay) {
-			fmt.Fprintln(os.Stderr, "failed to create extension pg_stat_statements %w", err)
-			return nil
-		}
+	if err := inc.Exec(dbHost, incus.ExecOptions{User: uid},
+		"psql", "-c", "CREATE EXTENSION IF NOT EXISTS pg_stat_statements;"); err != nil {
+		return fmt.Errorf("failed to create extension pg_stat_statements %w", err)
 	}
 
 	// Create odoo Role
-	err = exec.Command("incus", "exec", dbHost, "--user", uid, "-t", "--",
-		"psql", "-c", "CREATE ROLE "+dbUsername+" WITH CREATEDB NOSUPERUSER ENCRYPTED PASSWORD '"+dbPassword+"' LOGIN;").Run()
-	if err != nil {
-		if errors.Is(err, exec.ErrWaitDelay) {
-			fmt.Fprintln(os.Stderr, "failed to create role %w", err)
-			return nil
-		}
+	if err := inc.Exec(dbHost, incus.ExecOptions{User: uid},
+		"psql", "-c", "CREATE ROLE "+dbUsername+" WITH CREATEDB NOSUPERUSER ENCRYPTED PASSWORD '"+dbPassword+"' LOGIN;"); err != nil {
+		return fmt.Errorf("failed to create role %w", err)
 	}
 
 	// Restart PostgreSQL
-	inc.SetInstanceState(dbHost, "stop")
-	time.Sleep(5 * time.Second) // debounce timer
-	inc.SetInstanceState(dbHost, "start")
+	if err := inc.SetInstanceState(dbHost, "restart"); err != nil {
+		return fmt.Errorf("restart database instance %s failed %w", dbHost, err)
+	}
 
 	return nil
 }
@@ -7,10 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
-	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/lipgloss/table"
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
 	"github.com/ppreeper/oda/lib"
@@ -28,10 +25,10 @@ func (o *ODA) OdooPS() error {
 		fmt.Fprintln(os.Stderr, "error loading oda config", err)
 		return nil
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	projects := GetCurrentOdooProjects()
-	instances, err := inc.GetInstances()
+	instances, err := inc.GetInstances(incus.InstanceFilter{})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "instances list failed %w", err)
 		return nil
@@ -42,24 +39,13 @@ func (o *ODA) OdooPS() error {
 	for _, instance := range instances {
 		for _, project := range projects {
 			if instance.Name == project {
-				rows = append(rows, []string{instance.Name, instance.State, instance.IP4})
+				rows = append(rows, []string{instance.Name, instance.State, instance.IP4, instance.IP6,
+					projectURL(odaConf, instance.Name)})
 			}
 		}
 	}
-	t := table.New().
-		Border(lipgloss.NormalBorder()).
-		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
-		StyleFunc(func(row, col int) lipgloss.Style {
-			switch {
-			case row == 0:
-				return ui.HeaderStyle
-			case row%2 == 0:
-				return ui.EvenRowStyle
-			default:
-				return ui.OddRowStyle
-			}
-		}).
-		Headers("NAME", "STATE", "IPV4").
+	t := ui.NewTable().
+		Headers("NAME", "STATE", "IPV4", "IPV6", "URL").
 		Rows(rows...)
 
 	fmt.Fprintln(os.Stderr, t)
@@ -93,7 +79,7 @@ func (o *ODA) OdooPS() error {
 }
 
 // OdooPSQL
-// calls into "incus exec <project> -t -- pgsql"
+// runs psql on the database instance
 func (o *ODA) OdooPSQL() error {
 	if !IsProject() {
 		return nil
@@ -104,7 +90,7 @@ func (o *ODA) OdooPSQL() error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	dbHost := odooConf.DbHost
 	dbuser := odooConf.DbUser
@@ -117,17 +103,14 @@ func (o *ODA) OdooPSQL() error {
 		return nil
 	}
 
-	incusCmd := exec.Command("incus", "exec", dbHost, "--user", uid,
-		"--env", "PGPASSWORD="+dbpassword, "-t", "--",
-		"psql", "-h", "127.0.0.1", "-U", dbuser, dbname,
-	)
-	incusCmd.Stdin = os.Stdin
-	incusCmd.Stdout = os.Stdout
-	incusCmd.Stderr = os.Stderr
-	if err := incusCmd.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, "error instance psql %w", err)
-	}
-	return nil
+	return inc.Exec(dbHost, incus.ExecOptions{
+		User:        uid,
+		Env:         map[string]string{"PGPASSWORD": dbpassword},
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "psql", "-h", "127.0.0.1", "-U", dbuser, dbname)
 }
 
 func (o *ODA) OdooCreate() error {
@@ -135,43 +118,133 @@ func (o *ODA) OdooCreate() error {
 		return nil
 	}
 	_, project := lib.GetProject()
-	projectConfig, _ := config.LoadProjectConfig()
+	created, err := createProjectInstance()
+	if err != nil || !created {
+		return err
+	}
 
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return fmt.Errorf("load project config failed %w", err)
+	}
+	if len(projectConfig.Modules) == 0 {
+		return nil
+	}
 	odaConf, err := config.LoadOdaConfig()
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("installing", strings.Join(projectConfig.Modules, ",")))
+	if err := inc.SetInstanceState(project, "start"); err != nil {
+		return fmt.Errorf("starting %s failed %w", project, err)
+	}
+	if err := inc.IncusExecVerbose(project, "odas", "install", moduleList(projectConfig.Modules...)); err != nil {
+		return fmt.Errorf("error installing modules %w", err)
+	}
+	return nil
+}
+
+// createProjectInstance creates the instance of the project in the current
+// directory as .oda.yaml describes it, created is false when nothing was done
+func createProjectInstance() (created bool, err error) {
+	cwd, project := lib.GetProject()
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return false, fmt.Errorf("load project config failed %w", err)
+	}
+
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return false, fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
 
 	version := projectConfig.Version
-	verParts := strings.Split(version, ".")
-	if len(verParts) < 1 {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("invalid version %s in .oda.yaml", version))
-		return nil
+	branch := config.GetVersion(version)
+	if branch == nil {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("invalid version", version, "in .oda.yaml"))
+		return false, nil
+	}
+	instanceType, err := odaConf.InstanceType(projectConfig)
+	if err != nil {
+		return false, err
+	}
+	image := projectConfig.Image
+	if image == "" {
+		image = branch.ImageAlias(instanceType)
 	}
-	baseVersion := "odoo-" + verParts[0] + "-0"
 
-	iStatus := inc.GetInstanceState(project)
-	if iStatus.StatusCode == 200 {
+	if _, err := inc.GetInstance(project); err == nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(project, "already exists"))
-		return nil
+		return false, nil
+	} else if !incus.IsNotFound(err) {
+		return false, fmt.Errorf("could not check instance %s %w", project, err)
+	}
+
+	found, err := imageExists(inc, image)
+	if err != nil {
+		return false, fmt.Errorf("could not check image %s %w", image, err)
+	}
+	if !found {
+		if projectConfig.Image != "" {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("no image", image, "found, check image in .oda.yaml"))
+		} else {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("no image", image, "found, run oda base publish first"))
+		}
+		return false, nil
 	}
 
-	inc.CopyInstance(baseVersion, project)
+	// odoo.conf follows the edition, addons and database server in .oda.yaml
+	db, err := odaConf.ProjectDatabase(projectConfig)
+	if err != nil {
+		return false, err
+	}
+	odooValues := db.OdooConf()
+	odooValues["addons_path"] = projectConfig.AddonsPath()
+	if err := config.SetOdooConfValues(filepath.Join(cwd, "conf", "odoo.conf"), odooValues); err != nil {
+		return false, err
+	}
 
-	time.Sleep(5 * time.Second)
+	if err := inc.EnsureProject(); err != nil {
+		return false, fmt.Errorf("create incus project failed %w", err)
+	}
+	if err := inc.SyncProfile(); err != nil {
+		return false, fmt.Errorf("sync profile failed %w", err)
+	}
 
-	if err := inc.IncusIdmap(project); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error idmap %v"), err)
-		return nil
+	if err := inc.CreateInstanceFromImage(project, image, instanceType, projectConfig.InstanceConfig()); err != nil {
+		return false, fmt.Errorf("instance create failed %w", err)
 	}
 
 	if err := inc.InstanceMounts(project); err != nil {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("InstanceMounts %v"), err)
-		return nil
+		return false, nil
 	}
 
-	return nil
+	return true, nil
+}
+
+// imageExists looks an image up by alias, or by fingerprint when image is one
+func imageExists(inc incus.Backend, image string) (bool, error) {
+	if incus.IsFingerprint(image) {
+		images, err := inc.GetImages()
+		if err != nil {
+			return false, err
+		}
+		for _, img := range images {
+			if strings.HasPrefix(img.Fingerprint, image) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if _, err := inc.GetImageAlias(image); incus.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // OdooDestroy
@@ -183,7 +256,7 @@ func (o *ODA) OdooDestroy() error {
 		return nil
 	}
 	_, project := lib.GetProject()
-	confim := ui.AreYouSure("destroy the " + project + " instance")
+	confim := areYouSure("destroy the " + project + " instance")
 	if !confim {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("destroying the "+project+" instance canceled"))
 		return nil
@@ -194,17 +267,21 @@ func (o *ODA) OdooDestroy() error {
 		fmt.Fprintln(os.Stderr, "error loading oda config", err)
 		return nil
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
-	inc.SetInstanceState(project, "stop")
-	inc.DeleteInstance(project)
+	if err := inc.SetInstanceState(project, "stop"); err != nil {
+		return fmt.Errorf("stopping %s failed %w", project, err)
+	}
+	if err := inc.DeleteInstance(project); err != nil {
+		return fmt.Errorf("destroying %s failed %w", project, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("instance", project, "destroyed"))
 	return nil
 }
 
 // OdooExec
 // execCmd.Flags().StringVarP(&username, "username", "u", "odoo", "username")
-// calls into "incus exec <project> -t -- /bin/bash"
+// runs an interactive /bin/bash on the project instance
 func (o *ODA) OdooExec(username string) error {
 	if !IsProject() {
 		return nil
@@ -215,9 +292,12 @@ func (o *ODA) OdooExec(username string) error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
-	iStatus := inc.GetInstanceState(project)
+	iStatus, err := inc.GetInstanceState(project)
+	if err != nil {
+		return fmt.Errorf("could not get %s state %w", project, err)
+	}
 	if iStatus.Metadata.Status != "Running" {
 		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render(project, "stopped, please start"))
 		return nil
@@ -229,18 +309,15 @@ func (o *ODA) OdooExec(username string) error {
 		return nil
 	}
 
-	incusCmd := exec.Command("incus", "exec", project, "--user", uid, "-t",
-		"--env", "HOME=/home/odoo", "--cwd", "/opt/odoo", "--",
-		"/bin/bash",
-	)
-	incusCmd.Stdin = os.Stdin
-	incusCmd.Stdout = os.Stdout
-	incusCmd.Stderr = os.Stderr
-	if err := incusCmd.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error executing %v"), err)
-		return nil
-	}
-	return nil
+	return inc.Exec(project, incus.ExecOptions{
+		User:        uid,
+		Cwd:         "/opt/odoo",
+		Env:         map[string]string{"HOME": "/home/odoo"},
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "/bin/bash")
 }
 
 // OdooStart
@@ -257,25 +334,29 @@ func (o *ODA) OdooStart() error {
 		fmt.Fprintln(os.Stderr, "error loading oda config", err)
 		return nil
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	instance, err := inc.GetInstance(project)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("could not get odoo instance"), err)
-		return nil
-	}
-	if instance == (incus.Instance{}) {
+	if incus.IsNotFound(err) {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("no odoo instance, please create one first"))
 		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("could not get odoo instance %w", err)
+	}
 
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Starting", project))
 	switch strings.ToUpper(instance.State) {
 	case "STOPPED":
-		inc.SetInstanceState(project, "start")
+		if err := inc.SetInstanceState(project, "start"); err != nil {
+			return fmt.Errorf("starting %s failed %w", project, err)
+		}
 	}
 
-	instanceStatus := inc.GetInstanceState(project)
+	instanceStatus, err := inc.GetInstanceState(project)
+	if err != nil {
+		return fmt.Errorf("could not get %s state %w", project, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(project, instanceStatus.Metadata.Status))
 
 	if err := inc.IncusExec(project, "sudo", "odas", "hosts", odaConf.System.Domain); err != nil {
@@ -313,11 +394,16 @@ func (o *ODA) OdooStop() error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Stopping", project))
-	inc.SetInstanceState(project, "stop")
-	instanceStatus := inc.GetInstanceState(project)
+	if err := inc.SetInstanceState(project, "stop"); err != nil {
+		return fmt.Errorf("stopping %s failed %w", project, err)
+	}
+	instanceStatus, err := inc.GetInstanceState(project)
+	if err != nil {
+		return fmt.Errorf("could not get %s state %w", project, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(project, instanceStatus.Metadata.Status))
 	return nil
 }
@@ -332,51 +418,57 @@ func (o *ODA) OdooRestart() error {
 	_, project := lib.GetProject()
 
 	odaConf, _ := config.LoadOdaConfig()
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	instance, err := inc.GetInstance(project)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("could not get odoo instance"), err)
-		return nil
-	}
-	if instance == (incus.Instance{}) {
+	if incus.IsNotFound(err) {
 		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("no odoo instance, please launch one first"))
 		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("could not get odoo instance %w", err)
+	}
 
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Restarting", project))
 	switch strings.ToUpper(instance.State) {
 	case "RUNNING":
-		inc.SetInstanceState(project, "restart")
+		if err := inc.SetInstanceState(project, "restart"); err != nil {
+			return fmt.Errorf("restarting %s failed %w", project, err)
+		}
 	case "STOPPED":
-		inc.SetInstanceState(project, "start")
+		if err := inc.SetInstanceState(project, "start"); err != nil {
+			return fmt.Errorf("starting %s failed %w", project, err)
+		}
 	}
 
-	instanceStatus := inc.GetInstanceState(project)
+	instanceStatus, err := inc.GetInstanceState(project)
+	if err != nil {
+		return fmt.Errorf("could not get %s state %w", project, err)
+	}
 	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(project, instanceStatus.Metadata.Status))
 	return nil
 }
 
 // OdooLogs
-// calls into "odas logs"
-// calls into "incus exec <project> -t -- journalctl -f"
+// follows the journal of the project instance
 func (o *ODA) OdooLogs() error {
 	if !IsProject() {
 		return nil
 	}
 	_, project := lib.GetProject()
-	podCmd := exec.Command("incus",
-		"exec", project, "-t", "--",
-		"journalctl", "-f",
-	)
-	podCmd.Stdin = os.Stdin
-	podCmd.Stdout = os.Stdout
-	podCmd.Stderr = os.Stderr
-	if err := podCmd.Run(); err != nil {
-		// fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("error getting logs %v"), err)
-		return nil
+
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
 	}
-	return nil
+	inc := newBackend(odaConf)
+
+	return inc.Exec(project, incus.ExecOptions{
+		Interactive: true,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	}, "journalctl", "-f")
 }
 
 func SSHConfigGenerate(project string) error {
@@ -386,15 +478,22 @@ func SSHConfigGenerate(project string) error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 	domain := odaConf.System.Domain
 	sshkey := odaConf.System.SSHKey
 	instance, err := inc.GetInstance(project)
 	if err != nil {
 		return fmt.Errorf("error getting instance %w", err)
 	}
+	address := instance.IP4
+	if odaConf.System.IPv6 && instance.IP6 != "" {
+		address = instance.IP6
+	}
+	if address == "" {
+		return fmt.Errorf("instance %s has no address", project)
+	}
 	// priority;host;hostname;user;identityfile;port
-	sshconfig := fmt.Sprintf("%d;%s.%s;%s;%s;%s;%d", 10, project, domain, instance.IP4, "odoo", sshkey, 22)
+	sshconfig := fmt.Sprintf("%d;%s.%s;%s;%s;%s;%d", 10, project, domain, address, "odoo", sshkey, 22)
 	sshconfigCSV := filepath.Join(HOME, ".ssh", "sshconfig.csv")
 	// READ config
 	hosts, err := os.Open(sshconfigCSV)
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+)
+
+func TestOdooCreate(t *testing.T) {
+	p := setupProject(t)
+	p.backend.Aliases["oda/odoo-17.0"] = "fingerprint"
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+
+	inst, ok := p.backend.Instances["p1"]
+	if !ok {
+		t.Fatal("instance p1 not created")
+	}
+	if inst.Source != "oda/odoo-17.0" {
+		t.Errorf("created from %q, want oda/odoo-17.0", inst.Source)
+	}
+	if inst.State != "Stopped" {
+		t.Errorf("state %q, want Stopped", inst.State)
+	}
+	assertCalled(t, p.backend, "EnsureProject", "EnsureProject")
+	assertCalled(t, p.backend, "SyncProfile", "SyncProfile")
+	assertCalled(t, p.backend, "InstanceMounts", "InstanceMounts p1")
+}
+
+func TestOdooCreateVirtualMachine(t *testing.T) {
+	p := setupProject(t)
+	writeFile(t, filepath.Join(p.dir, ".oda.yaml"), "version: \"17.0\"\ninstance_type: virtual-machine\n")
+	p.backend.Aliases["oda/odoo-17.0"] = "container"
+	p.backend.Aliases["oda/odoo-17.0-vm"] = "vm"
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+
+	inst, ok := p.backend.Instances["p1"]
+	if !ok {
+		t.Fatal("instance p1 not created")
+	}
+	if inst.Source != "oda/odoo-17.0-vm" || inst.Type != config.InstanceTypeVM {
+		t.Errorf("created %s from %q, want virtual-machine from oda/odoo-17.0-vm", inst.Type, inst.Source)
+	}
+	if !slices.Contains(inst.Profiles, incus.ProfileNameVM) {
+		t.Errorf("profiles %q, want %s", inst.Profiles, incus.ProfileNameVM)
+	}
+}
+
+func TestOdooCreateWithoutImage(t *testing.T) {
+	p := setupProject(t)
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.backend.Instances["p1"]; ok {
+		t.Error("instance created without a published image")
+	}
+	assertNotCalled(t, p.backend, "CreateInstanceFromImage")
+}
+
+func TestOdooCreateExisting(t *testing.T) {
+	p := setupProject(t)
+	p.backend.Aliases["oda/odoo-17.0"] = "fingerprint"
+	p.backend.AddInstance("p1", "Running")
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+	assertNotCalled(t, p.backend, "CreateInstanceFromImage")
+	assertNotCalled(t, p.backend, "InstanceMounts")
+}
+
+func TestOdooStart(t *testing.T) {
+	p := setupProject(t)
+	inst := p.backend.AddInstance("p1", "Stopped")
+
+	if err := (&ODA{}).OdooStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inst.State != "Running" {
+		t.Errorf("state %q, want Running", inst.State)
+	}
+	assertCalled(t, p.backend, "Exec",
+		"Exec p1 sudo odas hosts local",
+		"Exec p1 sudo odas caddy local",
+	)
+
+	sshconfig, err := os.ReadFile(filepath.Join(p.root, "home", ".ssh", "sshconfig.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "10;p1.local;" + inst.IP4 + ";odoo;id_rsa;22"
+	if !strings.Contains(string(sshconfig), want) {
+		t.Errorf("sshconfig.csv missing %q:\n%s", want, sshconfig)
+	}
+}
+
+func TestSSHConfigGenerateIPv6(t *testing.T) {
+	p := setupProject(t)
+	p.odaConf.System.IPv6 = true
+	if err := config.SaveOdaConfig(p.odaConf); err != nil {
+		t.Fatal(err)
+	}
+	inst := p.backend.AddInstance("p1", "Running")
+	inst.IP6 = "fd42::10"
+
+	if err := SSHConfigGenerate("p1"); err != nil {
+		t.Fatal(err)
+	}
+	sshconfig, err := os.ReadFile(filepath.Join(p.root, "home", ".ssh", "sshconfig.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "10;p1.local;fd42::10;odoo;id_rsa;22"; !strings.Contains(string(sshconfig), want) {
+		t.Errorf("sshconfig.csv missing %q:\n%s", want, sshconfig)
+	}
+}
+
+func TestSSHConfigGenerateNoAddress(t *testing.T) {
+	p := setupProject(t)
+	inst := p.backend.AddInstance("p1", "Running")
+	inst.IP4 = ""
+
+	if err := SSHConfigGenerate("p1"); err == nil {
+		t.Fatal("expected error for an instance without an address")
+	}
+}
+
+func TestOdooStartMissingInstance(t *testing.T) {
+	p := setupProject(t)
+
+	if err := (&ODA{}).OdooStart(); err != nil {
+		t.Fatal(err)
+	}
+	assertNotCalled(t, p.backend, "SetInstanceState")
+	assertNotCalled(t, p.backend, "Exec")
+}
+
+func TestOdooStartBackendError(t *testing.T) {
+	p := setupProject(t)
+	p.backend.AddInstance("p1", "Stopped")
+	p.backend.Errors["SetInstanceState"] = &incus.IncusError{Method: "PUT", Path: "/1.0/instances/p1/state", Code: 500, Message: "boom"}
+
+	err := (&ODA{}).OdooStart()
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("error %v, want backend error", err)
+	}
+	assertNotCalled(t, p.backend, "Exec")
+}
+
+func TestOdooCreateProjectSettings(t *testing.T) {
+	p := setupProject(t)
+	writeFile(t, filepath.Join(p.dir, ".oda.yaml"), `schema: 2
+version: "17.0"
+edition: enterprise
+image: oda/pinned
+limits:
+  cpu: "2"
+  memory: 2GiB
+addons:
+  - name: oca-web
+    path: ../oca-web
+modules:
+  - sale
+  - crm
+`)
+	p.backend.Aliases["oda/odoo-17.0"] = "latest"
+	p.backend.Aliases["oda/pinned"] = "pinned"
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+
+	inst, ok := p.backend.Instances["p1"]
+	if !ok {
+		t.Fatal("instance p1 not created")
+	}
+	if inst.Source != "oda/pinned" {
+		t.Errorf("created from %q, want oda/pinned", inst.Source)
+	}
+	if inst.Config["limits.cpu"] != "2" || inst.Config["limits.memory"] != "2GiB" {
+		t.Errorf("instance config %v", inst.Config)
+	}
+	want := "/opt/odoo/odoo/addons,/opt/odoo/enterprise,/opt/odoo/design-themes,/opt/odoo/industry,/opt/odoo/addons,/opt/odoo/extra/oca-web"
+	if got := config.ReadConfValue(filepath.Join(p.dir, "conf", "odoo.conf"), "addons_path", ""); got != want {
+		t.Errorf("addons_path %q, want %q", got, want)
+	}
+	assertCalled(t, p.backend, "SetInstanceState", "SetInstanceState p1 start")
+	assertCalled(t, p.backend, "Exec", "Exec p1 odas install sale,crm")
+}
+
+func TestOdooCreatePinnedImageMissing(t *testing.T) {
+	p := setupProject(t)
+	writeFile(t, filepath.Join(p.dir, ".oda.yaml"), "version: \"17.0\"\nimage: 0123456789abcdef\n")
+	p.backend.Aliases["oda/odoo-17.0"] = "latest"
+
+	if err := (&ODA{}).OdooCreate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.backend.Instances["p1"]; ok {
+		t.Error("instance created without the pinned image")
+	}
+	assertNotCalled(t, p.backend, "CreateInstanceFromImage")
+}
@@ -2,8 +2,23 @@ package internal
 
 import (
 	"embed"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/ui"
 )
 
+// newBackend connects to the container host, tests swap in a fake
+var newBackend = func(odaConf *config.OdaConf) incus.Backend {
+	return incus.NewIncus(odaConf)
+}
+
+// areYouSure asks for confirmation of destructive actions, tests answer it
+var areYouSure = ui.AreYouSure
+
+// confirm asks a yes or no question, tests answer it
+var confirm = ui.Confirm
+
 type QueryDef struct {
 	Model    string
 	Filter   string
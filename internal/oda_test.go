@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/incus/fake"
+)
+
+const testOdooConf = `[options]
+db_host = db
+db_port = 5432
+db_user = odoo
+db_password = odoo
+db_name = p1_local
+db_template = template0
+`
+
+// testProject is a project directory wired to a fake backend
+type testProject struct {
+	backend *fake.Backend
+	root    string
+	dir     string
+	odaConf *config.OdaConf
+}
+
+// setupProject creates oda.yaml and a project p1 under a temporary home,
+// changes into the project and routes all backend calls to a fake
+func setupProject(t *testing.T) *testProject {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+
+	odaConf := config.NewOdaConfig()
+	odaConf.Dirs.Project = filepath.Join(root, "projects")
+	odaConf.Dirs.Repo = filepath.Join(root, "repos")
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(odaConf.Dirs.Project, "p1")
+	for _, sub := range []string{"addons", "conf", "data", "../backups", "../../home/.ssh"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "conf", "odoo.conf"), testOdooConf)
+	writeFile(t, filepath.Join(dir, ".oda.yaml"), "version: \"17.0\"\n")
+	writeFile(t, filepath.Join(root, "home", ".ssh", "sshconfig.csv"), "priority;host;hostname;user;identityfile;port\n")
+
+	chdir(t, dir)
+
+	backend := fake.New()
+	origBackend, origConfirm := newBackend, areYouSure
+	newBackend = func(*config.OdaConf) incus.Backend { return backend }
+	areYouSure = func(string) bool { return true }
+	t.Cleanup(func() {
+		newBackend, areYouSure = origBackend, origConfirm
+	})
+
+	return &testProject{backend: backend, root: root, dir: dir, odaConf: odaConf}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertCalled fails unless every call in want was recorded for method
+func assertCalled(t *testing.T, b *fake.Backend, method string, want ...string) {
+	t.Helper()
+	got := b.CallsTo(method)
+	for _, call := range want {
+		if !slices.Contains(got, call) {
+			t.Errorf("missing call %q, got %q", call, got)
+		}
+	}
+}
+
+func assertNotCalled(t *testing.T, b *fake.Backend, method string) {
+	t.Helper()
+	if got := b.CallsTo(method); len(got) != 0 {
+		t.Errorf("unexpected %s calls %q", method, got)
+	}
+}
@@ -1,22 +1,158 @@
 package internal
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/charmbracelet/huh"
 	"github.com/ppreeper/oda/config"
 	"github.com/ppreeper/oda/incus"
 	"github.com/ppreeper/oda/lib"
 	"github.com/ppreeper/oda/ui"
+	"gopkg.in/yaml.v3"
 )
 
+// ProjectSpec is a project for oda project init, from the flags or an
+// entry of a spec file
+type ProjectSpec struct {
+	Name     string `yaml:"name"`
+	Edition  string `yaml:"edition"`
+	Version  string `yaml:"version"`
+	DBServer string `yaml:"db_server,omitempty"`
+	// Template is the project template the files are added from
+	Template string `yaml:"template,omitempty"`
+	// CreateInstance creates the project instance after the directory
+	CreateInstance bool `yaml:"create_instance,omitempty"`
+	// Restore is a backup file to restore, latest for the newest backup
+	// of the project
+	Restore string `yaml:"restore,omitempty"`
+}
+
+// restoreLatest restores the newest backup of the project
+const restoreLatest = "latest"
+
+// complete is true when the spec has every value the form asks for
+func (spec ProjectSpec) complete() bool {
+	return spec.Name != "" && spec.Edition != "" && spec.Version != ""
+}
+
 // ProjectInit
-// build project directory based on prompts
-func (o *ODA) ProjectInit() error {
+// build project directory based on prompts, the form only asks for the
+// values missing from spec and a complete spec creates the project
+// without prompts
+func (o *ODA) ProjectInit(spec ProjectSpec) error {
+	if !spec.complete() {
+		var create bool
+		if err := projectInitForm(&spec, &create); err != nil {
+			return err
+		}
+		if !create {
+			return nil
+		}
+	}
+	return o.projectCreate(spec, GetCurrentOdooProjects(), GetCurrentOdooRepos())
+}
+
+// ProjectInitFile
+// create the projects of a spec file, all are validated before the
+// first one is created
+func (o *ODA) ProjectInitFile(file string) error {
+	specs, err := loadProjectSpecs(file)
+	if err != nil {
+		return err
+	}
+	projects := GetCurrentOdooProjects()
+	versions := GetCurrentOdooRepos()
+	seen := slices.Clone(projects)
+	for _, spec := range specs {
+		if err := validateProjectSpec(spec, seen, versions); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		seen = append(seen, spec.Name)
+	}
+	for _, spec := range specs {
+		if err := o.projectCreate(spec, projects, versions); err != nil {
+			return err
+		}
+		projects = append(projects, spec.Name)
+	}
+	return nil
+}
+
+// loadProjectSpecs reads the projects of a spec file
+func loadProjectSpecs(file string) ([]ProjectSpec, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read project spec %w", err)
+	}
+	var specFile struct {
+		Projects []ProjectSpec `yaml:"projects"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&specFile); err != nil {
+		return nil, fmt.Errorf("could not parse %s %w", file, err)
+	}
+	if len(specFile.Projects) == 0 {
+		return nil, fmt.Errorf("%s has no projects", file)
+	}
+	return specFile.Projects, nil
+}
+
+// validateProjectName checks the name of a new project
+func validateProjectName(projects []string, name string) error {
+	// check if project already exists
+	if existsIn(projects, name) {
+		return fmt.Errorf("project %s already exists", name)
+	}
+	if name == "" {
+		return fmt.Errorf("project name is required")
+	}
+	return nil
+}
+
+// validateProjectSpec checks a spec allows the choices the form offers
+func validateProjectSpec(spec ProjectSpec, projects, versions []string) error {
+	if err := validateProjectName(projects, spec.Name); err != nil {
+		return err
+	}
+	switch spec.Edition {
+	case config.EditionCommunity, config.EditionEnterprise:
+	case "":
+		return fmt.Errorf("project %s has no edition", spec.Name)
+	default:
+		return fmt.Errorf("unknown edition %s, use %s or %s", spec.Edition, config.EditionCommunity, config.EditionEnterprise)
+	}
+	if spec.Version == "" {
+		return fmt.Errorf("project %s has no version", spec.Name)
+	}
+	if !existsIn(versions, spec.Version) {
+		return fmt.Errorf("version %s is not cloned, run oda repo branch clone", spec.Version)
+	}
+	if spec.Template != "" {
+		if _, err := config.GetProjectTemplate(spec.Template); err != nil {
+			return err
+		}
+	}
+	if spec.DBServer != "" {
+		odaConf, err := config.LoadOdaConfig()
+		if err != nil {
+			return fmt.Errorf("load oda config failed %w", err)
+		}
+		if _, err := odaConf.DatabaseServer(spec.DBServer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// projectInitForm asks for the values missing in spec
+func projectInitForm(spec *ProjectSpec, create *bool) error {
 	projects := GetCurrentOdooProjects()
 	versions := GetCurrentOdooRepos()
 
@@ -25,72 +161,181 @@ func (o *ODA) ProjectInit() error {
 		versionOptions = append(versionOptions, huh.NewOption(version, version))
 	}
 
-	var (
-		name    string
-		edition string
-		version string
-		create  bool
-	)
-
-	form := huh.NewForm(
-		huh.NewGroup(
-			huh.NewInput().
-				Title("Project Name").
-				Value(&name).
-				Validate(func(str string) error {
-					// check if project already exists
-					if existsIn(projects, str) {
-						return fmt.Errorf("project %s already exists", str)
-					}
-					if str == "" {
-						return fmt.Errorf("project name is required")
-					}
-					return nil
-				}),
-			huh.NewSelect[string]().
-				Title("Odoo Edition").
-				Options(
-					huh.NewOption("Community", "community"),
-					huh.NewOption("Enterprise", "enterprise").Selected(true),
-				).
-				Value(&edition),
-
-			huh.NewSelect[string]().
-				Title("Odoo Branch").
-				Options(versionOptions...).
-				Value(&version),
-
-			huh.NewConfirm().
-				Title("Create Project?").
-				Value(&create),
-		),
-	)
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	serverOptions := []huh.Option[string]{}
+	for i, db := range odaConf.DatabaseServers() {
+		option := huh.NewOption(fmt.Sprintf("%s (postgresql %d)", db.Name, db.Version), db.Name)
+		if i == 0 {
+			// the default server is not written to .oda.yaml
+			option = huh.NewOption(fmt.Sprintf("%s (postgresql %d, default)", db.Name, db.Version), "")
+		}
+		serverOptions = append(serverOptions, option)
+	}
+
+	templates, err := config.LoadProjectTemplates()
+	if err != nil {
+		return err
+	}
+	templateOptions := []huh.Option[string]{huh.NewOption("None", "")}
+	for _, tmpl := range templates {
+		label := tmpl.Name
+		if tmpl.Description != "" {
+			label += " - " + tmpl.Description
+		}
+		templateOptions = append(templateOptions, huh.NewOption(label, tmpl.Name))
+	}
+
+	// values given in spec are not asked for again
+	fields := []huh.Field{}
+	if spec.Name == "" {
+		fields = append(fields, huh.NewInput().
+			Title("Project Name").
+			Value(&spec.Name).
+			Validate(func(str string) error {
+				return validateProjectName(projects, str)
+			}))
+	}
+	if spec.Edition == "" {
+		spec.Edition = config.EditionEnterprise
+		fields = append(fields, huh.NewSelect[string]().
+			Title("Odoo Edition").
+			Options(
+				huh.NewOption("Community", config.EditionCommunity),
+				huh.NewOption("Enterprise", config.EditionEnterprise),
+			).
+			Value(&spec.Edition))
+	}
+	if spec.Version == "" {
+		fields = append(fields, huh.NewSelect[string]().
+			Title("Odoo Branch").
+			Options(versionOptions...).
+			Value(&spec.Version))
+	}
+	if spec.DBServer == "" {
+		fields = append(fields, huh.NewSelect[string]().
+			Title("Database Server").
+			Options(serverOptions...).
+			Value(&spec.DBServer))
+	}
+	if spec.Template == "" {
+		fields = append(fields, huh.NewSelect[string]().
+			Title("Project Template").
+			Options(templateOptions...).
+			Value(&spec.Template))
+	}
+	fields = append(fields, huh.NewConfirm().
+		Title("Create Project?").
+		Value(create))
+
+	form := huh.NewForm(huh.NewGroup(fields...))
 	if err := form.Run(); err != nil {
 		return fmt.Errorf("project init form error %w", err)
 	}
-	if !create {
-		return nil
-	}
+	return nil
+}
 
-	if err := projectSetup(name, edition, version, o.EmbedFS); err != nil {
+// projectCreate validates spec and creates the project, its instance and
+// restores a backup into it when the spec asks for them
+func (o *ODA) projectCreate(spec ProjectSpec, projects, versions []string) error {
+	if err := validateProjectSpec(spec, projects, versions); err != nil {
+		return err
+	}
+	if err := projectSetup(spec, o.EmbedFS); err != nil {
 		return fmt.Errorf("project setup failed %w", err)
 	}
+	if !spec.CreateInstance && spec.Restore == "" {
+		return nil
+	}
 
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	// instance and restore commands work on the project in the current directory
+	if err := os.Chdir(filepath.Join(odaConf.Dirs.Project, spec.Name)); err != nil {
+		return fmt.Errorf("cannot change to project directory %w", err)
+	}
+	if spec.CreateInstance {
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating instance", spec.Name))
+		created, err := createProjectInstance()
+		if err != nil {
+			return err
+		}
+		if !created {
+			return fmt.Errorf("instance %s not created", spec.Name)
+		}
+	}
+	if spec.Restore != "" {
+		backupFile, err := projectBackup(spec.Name, spec.Restore)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, ui.StepStyle.Render("restore from backup file "+backupFile))
+		if err := restoreDBTar(backupFile, false); err != nil {
+			return fmt.Errorf("restore db tar failed %w", err)
+		}
+	}
 	return nil
 }
 
+// projectBackup is the backup file to restore into project, restore is a
+// file in the backups directory or latest for the newest project backup
+func projectBackup(project, restore string) (string, error) {
+	if restore == restoreLatest {
+		backups, _ := GetOdooBackups("")
+		backups = slices.DeleteFunc(backups, func(backup string) bool {
+			return !isProjectBackup(backup, project)
+		})
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backup of %s found", project)
+		}
+		// backups start with their date
+		return backups[len(backups)-1], nil
+	}
+	backups, _ := GetOdooBackups("")
+	if !existsIn(backups, restore) {
+		return "", fmt.Errorf("backup %s not found", restore)
+	}
+	return restore, nil
+}
+
+// isProjectBackup reports whether backup, named <date>__<project>.<ext>
+// or <date>__<project>_export.<ext>, is a backup of project
+func isProjectBackup(backup, project string) bool {
+	_, name, ok := strings.Cut(backup, "__")
+	if !ok {
+		return false
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return name == project || name == project+"_export"
+}
+
 // projectSetup Project Config Setup
-func projectSetup(projectName, edition, version string, embedFS embed.FS) error {
+func projectSetup(spec ProjectSpec, embedFS embed.FS) (err error) {
 	odaConf, err := config.LoadOdaConfig()
 	if err != nil {
 		return err
 	}
+	projectName, version := spec.Name, spec.Version
 
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project directory"))
 	projectDir := filepath.Join(odaConf.Dirs.Project, projectName)
+	if _, err := os.Stat(projectDir); err == nil {
+		return fmt.Errorf("project %s already exists", projectName)
+	}
 	if err := os.MkdirAll(projectDir, 0o755); err != nil {
 		return fmt.Errorf("cannot create project directory %w", err)
 	}
+	// a failed setup, like a template that does not render, leaves no
+	// half-created project behind
+	defer func() {
+		if err != nil {
+			os.RemoveAll(projectDir)
+		}
+	}()
 
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project subdirectories"))
 	for _, pdir := range []string{"addons", "conf", "data"} {
@@ -100,10 +345,25 @@ func projectSetup(projectName, edition, version string, embedFS embed.FS) error
 		}
 	}
 
+	// .oda.yaml
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project .oda.yaml"))
+	projectCfg := &config.OdaProject{
+		Version:  version,
+		Edition:  spec.Edition,
+		Database: config.DefaultDBName(projectName, odaConf.System.Domain),
+		DBServer: spec.DBServer,
+	}
+	err = projectCfg.WriteConfig(filepath.Join(projectDir, ".oda.yaml"))
+	if err != nil {
+		return err
+	}
+
 	// odoo.conf
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project odoo.conf"))
 	odooConf := config.NewOdooConfig()
-	odooConf.Write(projectName, projectDir, edition, embedFS)
+	if err := odooConf.Write(projectName, projectDir, projectCfg, embedFS); err != nil {
+		return err
+	}
 
 	// .env (for vscode env injections)
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project .env file"))
@@ -112,18 +372,40 @@ func projectSetup(projectName, edition, version string, embedFS embed.FS) error
 		return fmt.Errorf("cannot create project .env file %w", err)
 	}
 
-	// .oda.yaml
-	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project .oda.yaml"))
-	projectCfg := &config.OdaProject{}
-	projectCfg.Version = version
-	err = projectCfg.WriteConfig(filepath.Join(projectDir, ".oda.yaml"))
-	if err != nil {
-		return err
+	if spec.Template != "" {
+		if err := applyProjectTemplate(odaConf, projectCfg, projectName, projectDir, spec.Template); err != nil {
+			return err
+		}
 	}
 	fmt.Fprintf(os.Stderr, ui.StepStyle.Render("project %s init complete")+"\n", projectName)
 	return nil
 }
 
+// applyProjectTemplate renders a project template into the project
+// directory and writes the editor settings when the template asks for them
+func applyProjectTemplate(odaConf *config.OdaConf, projectCfg *config.OdaProject, projectName, projectDir, name string) error {
+	tmpl, err := config.GetProjectTemplate(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("adding project template", tmpl.Name))
+	files, err := tmpl.Render(projectDir, config.NewProjectTemplateData(projectName, projectCfg))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render(file))
+	}
+	if !tmpl.EditorSettings {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating pyright and vscode settings"))
+	if err := writePyrightConfig(odaConf, projectCfg, projectDir); err != nil {
+		return err
+	}
+	return writeVSCodeConfig(odaConf, projectCfg, projectDir)
+}
+
 // ####################################
 // ProjectReset
 // reset project data directory and db
@@ -134,7 +416,7 @@ func (o *ODA) ProjectReset() error {
 	if !IsProject() {
 		return nil
 	}
-	confim := ui.AreYouSure("reset the project")
+	confim := areYouSure("reset the project")
 	if !confim {
 		return fmt.Errorf("reset the project canceled")
 	}
@@ -143,12 +425,14 @@ func (o *ODA) ProjectReset() error {
 	if err != nil {
 		return fmt.Errorf("load oda config failed %w", err)
 	}
-	inc := incus.NewIncus(odaConf)
+	inc := newBackend(odaConf)
 
 	// stop
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("stopping the instance"))
 	cwd, project := lib.GetProject()
-	inc.SetInstanceState(project, "stop")
+	if err := inc.SetInstanceState(project, "stop"); err != nil {
+		return fmt.Errorf("stopping %s failed %w", project, err)
+	}
 	// instanceStatus := GetInstanceState(project)
 	// fmt.Fprintln(os.Stderr, project, "instanceStatus.Metadata.Status", instanceStatus.Metadata.Status)
 
@@ -168,9 +452,9 @@ func (o *ODA) ProjectReset() error {
 	if err != nil {
 		return fmt.Errorf("could not get postgres user id: %w", err)
 	}
-	if err := exec.Command("incus", "exec", dbhost, "--user", uid, "-t", "--",
+	if err := inc.Exec(dbhost, incus.ExecOptions{User: uid},
 		"dropdb", "--if-exists", "-U", "postgres", "-f", dbname,
-	).Run(); err != nil {
+	); err != nil {
 		return fmt.Errorf("could not drop postgresql database %s error: %w", dbname, err)
 	}
 	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("project reset complete"))
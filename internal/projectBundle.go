@@ -0,0 +1,509 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/lib"
+	"github.com/ppreeper/oda/ui"
+	"gopkg.in/yaml.v3"
+)
+
+// bundleFormat is bumped when the layout of a project bundle changes
+const bundleFormat = 1
+
+// ProjectManifest describes the project a bundle was exported from
+type ProjectManifest struct {
+	Format       int               `yaml:"format"`
+	Project      string            `yaml:"project"`
+	Version      string            `yaml:"version"`
+	Edition      string            `yaml:"edition"`
+	InstanceType string            `yaml:"instance_type"`
+	Database     string            `yaml:"database"`
+	CreatedAt    time.Time         `yaml:"created_at"`
+	Repos        map[string]string `yaml:"repos,omitempty"`
+}
+
+// ProjectExport
+// write the project config, addons, database and filestore
+// to a single archive that oda project import can recreate it from,
+// the dump and filestore use the backup layout so oda restore reads it too
+func (o *ODA) ProjectExport(output string) error {
+	if !IsProject() {
+		return nil
+	}
+	cwd, project := lib.GetProject()
+	projectConfig, err := config.LoadProjectConfig()
+	if err != nil {
+		return fmt.Errorf("load project config failed %w", err)
+	}
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+	odooConf, err := config.LoadOdooConfig(cwd)
+	if err != nil {
+		return fmt.Errorf("load odoo config failed %w", err)
+	}
+	branch := config.GetVersion(projectConfig.Version)
+	if branch == nil {
+		return fmt.Errorf("invalid version %s in .oda.yaml", projectConfig.Version)
+	}
+	instanceType, err := odaConf.InstanceType(projectConfig)
+	if err != nil {
+		return err
+	}
+
+	manifest := ProjectManifest{
+		Format:       bundleFormat,
+		Project:      project,
+		Version:      projectConfig.Version,
+		Edition:      projectConfig.Edition,
+		InstanceType: instanceType,
+		Database:     odooConf.DbName,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+		Repos:        repoCommits(odaConf, branch),
+	}
+
+	if output == "" {
+		output = filepath.Join(odaConf.Dirs.Project, "backups",
+			time.Now().Format("2006_01_02_15_04_05")+"__"+project+"_export.tar.gz")
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("dump postgresql database"))
+	dump, err := os.CreateTemp("", "oda-export-*.sql")
+	if err != nil {
+		return fmt.Errorf("could not create dump file %w", err)
+	}
+	defer os.Remove(dump.Name())
+	defer dump.Close()
+	if err := dumpDatabase(inc, odaConf, odooConf, project, dump); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("write project bundle"))
+	if err := writeBundle(output, cwd, manifest, dump.Name()); err != nil {
+		os.Remove(output)
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("exported", project, "to", output))
+	return nil
+}
+
+// ProjectImport
+// recreate a project from a bundle written by oda project export,
+// the project directory, instance and database are created under name,
+// or the name of the exported project when name is empty
+func (o *ODA) ProjectImport(bundle, name string) (err error) {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+
+	backups := filepath.Join(odaConf.Dirs.Project, "backups")
+	if err := os.MkdirAll(backups, 0o755); err != nil {
+		return fmt.Errorf("cannot create backups directory %w", err)
+	}
+	// extract next to the projects so the parts can be moved into place
+	tmp, err := os.MkdirTemp(backups, ".import-")
+	if err != nil {
+		return fmt.Errorf("cannot create import directory %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("extract project bundle"))
+	if err := extractBundle(bundle, tmp); err != nil {
+		return err
+	}
+	manifest, err := readManifest(tmp)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = manifest.Project
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid project name %q", name)
+	}
+	projectDir := filepath.Join(odaConf.Dirs.Project, name)
+	if _, err := os.Stat(projectDir); err == nil {
+		return fmt.Errorf("project %s already exists", name)
+	}
+	branch := config.GetVersion(manifest.Version)
+	if branch == nil {
+		return fmt.Errorf("bundle uses unsupported version %s", manifest.Version)
+	}
+	for _, warning := range repoMismatches(manifest.Repos, repoCommits(odaConf, branch)) {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render(warning))
+	}
+
+	_, err = inc.GetInstance(name)
+	if err == nil {
+		return fmt.Errorf("instance %s already exists", name)
+	}
+	if !incus.IsNotFound(err) {
+		return fmt.Errorf("could not check instance %s %w", name, err)
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating project directory"))
+	// a failed import leaves nothing behind, so it can be run again
+	defer func() {
+		if err == nil {
+			return
+		}
+		os.RemoveAll(projectDir)
+		if _, gerr := inc.GetInstance(name); gerr != nil {
+			return
+		}
+		if serr := inc.SetInstanceState(name, "stop"); serr != nil {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("stopping", name, "failed", serr.Error()))
+		}
+		if derr := inc.DeleteInstance(name); derr != nil {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("deleting", name, "failed", derr.Error()))
+		}
+	}()
+	if err := importProjectDir(odaConf, tmp, projectDir, name); err != nil {
+		return err
+	}
+
+	// instance commands work on the project in the current directory
+	if err := os.Chdir(projectDir); err != nil {
+		return fmt.Errorf("cannot change to project directory %w", err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("creating instance", name))
+	// modules are in the imported database already
+	created, err := createProjectInstance()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("instance %s not created", name)
+	}
+
+	odooConf, err := config.LoadOdooConfig(projectDir)
+	if err != nil {
+		return fmt.Errorf("load odoo config failed %w", err)
+	}
+	dump, err := os.Open(filepath.Join(tmp, "dump.sql"))
+	if err != nil {
+		return fmt.Errorf("bundle has no database dump %w", err)
+	}
+	defer dump.Close()
+	if _, err := restoreDatabase(inc, odaConf, odooConf, name, dump); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, ui.StepStyle.Render("project %s imported")+"\n", name)
+	return nil
+}
+
+// importProjectDir moves the extracted bundle into a new project directory,
+// odoo.conf is pointed at this machine's database server
+func importProjectDir(odaConf *config.OdaConf, tmp, projectDir, name string) error {
+	if err := os.MkdirAll(filepath.Join(projectDir, "data", "filestore"), 0o755); err != nil {
+		return fmt.Errorf("cannot create project directory %w", err)
+	}
+	for _, pdir := range []string{"addons", "conf"} {
+		if err := os.Rename(filepath.Join(tmp, pdir), filepath.Join(projectDir, pdir)); err != nil {
+			return fmt.Errorf("bundle has no %s directory %w", pdir, err)
+		}
+	}
+
+	projectCfg, err := config.LoadProjectConfigFrom(tmp)
+	if err != nil {
+		return fmt.Errorf("bundle has no .oda.yaml %w", err)
+	}
+	db, err := odaConf.ProjectDatabase(projectCfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("database server", projectCfg.DBServer, "not found, using the default one"))
+		projectCfg.DBServer = ""
+		db, _ = odaConf.DatabaseServer("")
+	}
+
+	dbname := config.DefaultDBName(name, odaConf.System.Domain)
+	odooValues := db.OdooConf()
+	odooValues["db_name"] = dbname
+	if err := config.SetOdooConfValues(filepath.Join(projectDir, "conf", "odoo.conf"), odooValues); err != nil {
+		return err
+	}
+
+	filestore := filepath.Join(tmp, "filestore")
+	if _, err := os.Stat(filestore); err == nil {
+		if err := os.Rename(filestore, filepath.Join(projectDir, "data", "filestore", dbname)); err != nil {
+			return fmt.Errorf("filestore restore failed %w", err)
+		}
+	}
+
+	// ports belong to the machine the project was exported from
+	projectCfg.Expose = nil
+	projectCfg.Database = dbname
+	if err := projectCfg.WriteConfig(filepath.Join(projectDir, ".oda.yaml")); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".env"), []byte("ODOO_V="+projectCfg.Version), 0o644); err != nil {
+		return fmt.Errorf("cannot create project .env file %w", err)
+	}
+	return nil
+}
+
+// dumpDatabase writes a plain sql dump of the project database to w
+func dumpDatabase(inc incus.Backend, odaConf *config.OdaConf, odooConf *config.OdooConfig, project string, w io.Writer) error {
+	dbserver := odooConf.DbHost
+	if dbserver == "localhost" {
+		dbserver = project
+	}
+	uid, err := inc.IncusGetUid(dbserver, "postgres")
+	if err != nil {
+		return fmt.Errorf("could not get postgres uid %w", err)
+	}
+	dbhostTarget, err := dbHostTarget(inc, odaConf, odooConf, project)
+	if err != nil {
+		return err
+	}
+	if err := inc.Exec(dbserver, incus.ExecOptions{
+		User:   uid,
+		Env:    map[string]string{"PGPASSWORD": odooConf.DbPassword},
+		Stdout: w,
+	}, "pg_dump", "-h", dbhostTarget, "-U", odooConf.DbUser, "--no-owner", odooConf.DbName); err != nil {
+		return fmt.Errorf("could not dump postgresql database %s error: %w", odooConf.DbName, err)
+	}
+	return nil
+}
+
+// repoCommits is the checked out commit of each branch repository,
+// repositories that are not cloned are left out
+func repoCommits(odaConf *config.OdaConf, branch *config.Branch) map[string]string {
+	commits := map[string]string{}
+	for _, repo := range branch.Repos {
+		cmd := exec.Command("git", "rev-parse", "HEAD")
+		cmd.Dir = filepath.Join(odaConf.Dirs.Repo, branch.Version, repo)
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		commits[repo] = strings.TrimSpace(string(out))
+	}
+	return commits
+}
+
+// repoMismatches lists the repositories not checked out at the exported commit
+func repoMismatches(want, have map[string]string) []string {
+	var mismatches []string
+	for _, repo := range sortedKeys(want) {
+		switch commit, ok := have[repo]; {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("repository %s is not cloned, bundle used %s", repo, want[repo]))
+		case commit != want[repo]:
+			mismatches = append(mismatches, fmt.Sprintf("repository %s is at %s, bundle used %s", repo, commit, want[repo]))
+		}
+	}
+	return mismatches
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// writeBundle writes the gzipped tar archive of the project in cwd
+func writeBundle(output, cwd string, manifest ProjectManifest, dumpFile string) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return fmt.Errorf("cannot create bundle directory %w", err)
+	}
+	fo, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("cannot create bundle %w", err)
+	}
+	defer fo.Close()
+	gz := gzip.NewWriter(fo)
+	tw := tar.NewWriter(gz)
+
+	manifestOut, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("yaml marshalling error %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: manifest.CreatedAt}); err != nil {
+		return fmt.Errorf("cannot write bundle %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "./manifest.yaml", Mode: 0o644, Size: int64(len(manifestOut)), ModTime: manifest.CreatedAt}); err != nil {
+		return fmt.Errorf("cannot write bundle %w", err)
+	}
+	if _, err := tw.Write(manifestOut); err != nil {
+		return fmt.Errorf("cannot write bundle %w", err)
+	}
+
+	parts := []struct{ src, name string }{
+		{filepath.Join(cwd, ".oda.yaml"), "./.oda.yaml"},
+		{filepath.Join(cwd, "conf"), "./conf"},
+		{filepath.Join(cwd, "addons"), "./addons"},
+		{dumpFile, "./dump.sql"},
+		{filepath.Join(cwd, "data", "filestore", manifest.Database), "./filestore"},
+	}
+	for _, part := range parts {
+		if err := addBundleTree(tw, part.src, part.name); err != nil {
+			return fmt.Errorf("cannot add %s to bundle %w", part.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("cannot write bundle %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("cannot write bundle %w", err)
+	}
+	return fo.Close()
+}
+
+// addBundleTree adds the file or directory tree at src under name,
+// a missing src is skipped
+func addBundleTree(tw *tar.Writer, src, name string) error {
+	if _, err := os.Lstat(src); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if rel != "." {
+			hdr.Name += "/" + filepath.ToSlash(rel)
+		}
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		// owners mean nothing on another machine
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// extractBundle extracts a bundle into dest, entries that would land
+// outside of dest are refused
+func extractBundle(bundle, dest string) error {
+	fi, err := os.Open(bundle)
+	if err != nil {
+		return fmt.Errorf("cannot open bundle %w", err)
+	}
+	defer fi.Close()
+	gz, err := gzip.NewReader(fi)
+	if err != nil {
+		return fmt.Errorf("cannot read bundle %w", err)
+	}
+	defer gz.Close()
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read bundle %w", err)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." || name == "" {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path %s in bundle", hdr.Name)
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("cannot extract %s %w", hdr.Name, err)
+		}
+		// a symlink in the bundle must not lead later entries out of dest
+		parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+		if err != nil || (parent != root && !strings.HasPrefix(parent, root+string(filepath.Separator))) {
+			return fmt.Errorf("invalid path %s in bundle", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("cannot extract %s %w", hdr.Name, err)
+			}
+		case tar.TypeReg:
+			fo, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return fmt.Errorf("cannot extract %s %w", hdr.Name, err)
+			}
+			_, err = io.Copy(fo, tr)
+			fo.Close()
+			if err != nil {
+				return fmt.Errorf("cannot extract %s %w", hdr.Name, err)
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("cannot extract %s %w", hdr.Name, err)
+			}
+		}
+	}
+}
+
+// readManifest reads the manifest of an extracted bundle
+func readManifest(dir string) (*ProjectManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "manifest.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("not an oda project bundle %w", err)
+	}
+	manifest := &ProjectManifest{}
+	if err := yaml.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest %w", err)
+	}
+	if manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format %d", manifest.Format)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+)
+
+const testDump = "CREATE TABLE res_partner (id int);\n"
+
+// exportProject exports p1 with an addon and an attachment to file
+func exportProject(t *testing.T, p *testProject, file string) {
+	t.Helper()
+	p.backend.AddInstance("p1", "Running")
+	p.backend.AddInstance("db", "Running")
+	p.backend.ExecFunc = func(instanceName string, opts incus.ExecOptions, command ...string) error {
+		if command[0] == "pg_dump" {
+			io.WriteString(opts.Stdout, testDump)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(p.dir, "addons", "my_module"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(p.dir, "addons", "my_module", "__manifest__.py"), "{}")
+	if err := os.MkdirAll(filepath.Join(p.dir, "data", "filestore", "p1_local", "ab"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(p.dir, "data", "filestore", "p1_local", "ab", "abcdef0123"), "attachment")
+
+	if err := (&ODA{}).ProjectExport(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// bundleEntries reads the names and regular file contents of a bundle
+func bundleEntries(t *testing.T, file string) map[string]string {
+	t.Helper()
+	fi, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	gz, err := gzip.NewReader(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = string(content)
+	}
+}
+
+func TestProjectExport(t *testing.T) {
+	p := setupProject(t)
+	file := filepath.Join(p.root, "p1.tar.gz")
+	exportProject(t, p, file)
+
+	assertCalled(t, p.backend, "Exec", "Exec db pg_dump -h db.local -U odoo --no-owner p1_local")
+	entries := bundleEntries(t, file)
+	for name, want := range map[string]string{
+		"./.oda.yaml":                        "version: \"17.0\"\n",
+		"./conf/odoo.conf":                   testOdooConf,
+		"./addons/my_module/__manifest__.py": "{}",
+		"./dump.sql":                         testDump,
+		"./filestore/ab/abcdef0123":          "attachment",
+	} {
+		got, ok := entries[name]
+		if !ok {
+			t.Errorf("bundle has no %s", name)
+		} else if got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	for _, want := range []string{"project: p1", "version: \"17.0\"", "edition: community", "instance_type: container", "database: p1_local"} {
+		if !strings.Contains(entries["./manifest.yaml"], want) {
+			t.Errorf("manifest has no %q\n%s", want, entries["./manifest.yaml"])
+		}
+	}
+}
+
+func TestProjectImport(t *testing.T) {
+	p := setupProject(t)
+	file := filepath.Join(p.root, "p1.tar.gz")
+	exportProject(t, p, file)
+	p.backend.Aliases["oda/odoo-17.0"] = "fingerprint"
+	p.backend.Calls = nil
+
+	if err := (&ODA{}).ProjectImport(file, "p-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(p.odaConf.Dirs.Project, "p-2")
+	assertCalled(t, p.backend, "CreateInstanceFromImage", "CreateInstanceFromImage p-2 oda/odoo-17.0 container")
+	assertCalled(t, p.backend, "Exec",
+		"Exec db createdb -U postgres --encoding unicode --lc-collate C -T template0 -O odoo p_2_local",
+		"Exec db psql -h db.local -U odoo --dbname p_2_local -q",
+	)
+	for _, call := range p.backend.Calls {
+		if call.Method == "Exec" && call.Args[1] == "psql" && call.Stdin != testDump {
+			t.Errorf("psql received %q, want %q", call.Stdin, testDump)
+		}
+	}
+
+	odooConf, err := config.LoadOdooConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if odooConf.DbName != "p_2_local" || odooConf.DbTemplate != "template0" {
+		t.Errorf("odoo.conf db_name %q db_template %q", odooConf.DbName, odooConf.DbTemplate)
+	}
+	for name, want := range map[string]string{
+		".oda.yaml":                              "schema: 2\nversion: \"17.0\"\nedition: community\ndatabase: p_2_local\n",
+		".env":                                   "ODOO_V=17.0",
+		"addons/my_module/__manifest__.py":       "{}",
+		"data/filestore/p_2_local/ab/abcdef0123": "attachment",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s not imported %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// the import directory is cleaned up
+	entries, _ := os.ReadDir(filepath.Join(p.odaConf.Dirs.Project, "backups"))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".import-") {
+			t.Errorf("import directory %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestProjectImportExisting(t *testing.T) {
+	p := setupProject(t)
+	file := filepath.Join(p.root, "p1.tar.gz")
+	exportProject(t, p, file)
+	p.backend.Calls = nil
+
+	if err := (&ODA{}).ProjectImport(file, ""); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("import over p1 got %v", err)
+	}
+	assertNotCalled(t, p.backend, "CreateInstanceFromImage")
+}
+
+func TestExtractBundleRefusesEscape(t *testing.T) {
+	dir := t.TempDir()
+	for _, files := range []map[string]string{
+		{"../evil": "x"},
+		{"/etc/evil": "x"},
+	} {
+		file := filepath.Join(dir, "bad.tar.gz")
+		writeBackup(t, file, files)
+		if err := extractBundle(file, t.TempDir()); err == nil {
+			t.Errorf("extracting %v did not fail", files)
+		}
+	}
+}
+
+func TestRepoMismatches(t *testing.T) {
+	got := repoMismatches(
+		map[string]string{"odoo": "aaa", "enterprise": "bbb", "industry": "ccc"},
+		map[string]string{"odoo": "aaa", "enterprise": "ddd"},
+	)
+	want := []string{
+		"repository enterprise is at ddd, bundle used bbb",
+		"repository industry is not cloned, bundle used ccc",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProjectImportWithoutImage(t *testing.T) {
+	p := setupProject(t)
+	file := filepath.Join(p.root, "p1.tar.gz")
+	exportProject(t, p, file)
+	p.backend.Calls = nil
+
+	if err := (&ODA{}).ProjectImport(file, "p2"); err == nil || !strings.Contains(err.Error(), "not created") {
+		t.Fatalf("import without an image got %v", err)
+	}
+	assertNotCalled(t, p.backend, "Exec")
+	if _, err := os.Stat(filepath.Join(p.odaConf.Dirs.Project, "p2")); !os.IsNotExist(err) {
+		t.Errorf("project directory left behind after a failed import: %v", err)
+	}
+}
+
+func TestProjectImportRestoreFails(t *testing.T) {
+	p := setupProject(t)
+	file := filepath.Join(p.root, "p1.tar.gz")
+	exportProject(t, p, file)
+	p.backend.Aliases["oda/odoo-17.0"] = "fingerprint"
+	p.backend.ExecFunc = func(instanceName string, opts incus.ExecOptions, command ...string) error {
+		if command[0] == "psql" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	if err := (&ODA{}).ProjectImport(file, "p2"); err == nil {
+		t.Fatal("import with a failed restore succeeded")
+	}
+	assertCalled(t, p.backend, "DeleteInstance", "DeleteInstance p2")
+	if _, err := os.Stat(filepath.Join(p.odaConf.Dirs.Project, "p2")); !os.IsNotExist(err) {
+		t.Errorf("project directory left behind after a failed import: %v", err)
+	}
+
+	// nothing is left behind, so the import can be run again
+	p.backend.ExecFunc = nil
+	if err := (&ODA{}).ProjectImport(file, "p2"); err != nil {
+		t.Fatalf("second import: %v", err)
+	}
+}
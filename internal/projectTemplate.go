@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/ui"
+)
+
+// ProjectTemplatesList
+// list the project templates and the directory each one is loaded from
+func (o *ODA) ProjectTemplatesList() error {
+	templates, err := config.LoadProjectTemplates()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, projectTemplateTable(templates))
+	return nil
+}
+
+func projectTemplateTable(templates []*config.ProjectTemplate) *table.Table {
+	rows := [][]string{}
+	for _, tmpl := range templates {
+		rows = append(rows, []string{tmpl.Name, tmpl.Description, tmpl.Source})
+	}
+	return ui.NewTable().
+		Headers("NAME", "DESCRIPTION", "SOURCE").
+		Rows(rows...)
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+)
+
+func TestProjectTemplateTable(t *testing.T) {
+	setupProject(t)
+	dir, err := config.ProjectTemplatesDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "shop"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "shop", "template.yaml"), "description: web shop\n")
+
+	templates, err := config.LoadProjectTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := projectTemplateTable(templates).String()
+	for _, want := range []string{"customer", config.ProjectTemplatesEmbedded, "shop", "web shop", dir} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table has no %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProjectReset(t *testing.T) {
+	p := setupProject(t)
+	inst := p.backend.AddInstance("p1", "Running")
+	p.backend.AddInstance("db", "Running")
+	writeFile(t, filepath.Join(p.dir, "data", "sessions"), "x")
+
+	if err := (&ODA{}).ProjectReset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inst.State != "Stopped" {
+		t.Errorf("state %q, want Stopped", inst.State)
+	}
+	entries, err := os.ReadDir(filepath.Join(p.dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("data directory not emptied, %d entries left", len(entries))
+	}
+	assertCalled(t, p.backend, "IncusGetUid", "IncusGetUid db postgres")
+	assertCalled(t, p.backend, "Exec", "Exec db dropdb --if-exists -U postgres -f p1_local")
+}
+
+func TestProjectResetCanceled(t *testing.T) {
+	p := setupProject(t)
+	inst := p.backend.AddInstance("p1", "Running")
+	areYouSure = func(string) bool { return false }
+
+	if err := (&ODA{}).ProjectReset(); err == nil {
+		t.Fatal("expected canceled error")
+	}
+	if inst.State != "Running" {
+		t.Errorf("state %q, want Running", inst.State)
+	}
+	assertNotCalled(t, p.backend, "Exec")
+}
+
+func TestValidateProjectSpec(t *testing.T) {
+	setupProject(t)
+	projects, versions := []string{"p1"}, []string{"17.0", "16.0"}
+	valid := ProjectSpec{Name: "p2", Edition: "community", Version: "17.0"}
+	if err := validateProjectSpec(valid, projects, versions); err != nil {
+		t.Errorf("valid spec: %v", err)
+	}
+	for want, spec := range map[string]ProjectSpec{
+		"already exists":   {Name: "p1", Edition: "community", Version: "17.0"},
+		"name is required": {Edition: "community", Version: "17.0"},
+		"has no edition":   {Name: "p2", Version: "17.0"},
+		"unknown edition":  {Name: "p2", Edition: "pro", Version: "17.0"},
+		"has no version":   {Name: "p2", Edition: "community"},
+		"not cloned":       {Name: "p2", Edition: "community", Version: "18.0"},
+		"pg9 not found":    {Name: "p2", Edition: "community", Version: "17.0", DBServer: "pg9"},
+		"shop not found":   {Name: "p2", Edition: "community", Version: "17.0", Template: "shop"},
+	} {
+		err := validateProjectSpec(spec, projects, versions)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%+v: %v, want %s", spec, err, want)
+		}
+	}
+}
+
+func TestProjectInitFile(t *testing.T) {
+	p := setupProject(t)
+	for _, version := range []string{"17.0", "16.0"} {
+		if err := os.MkdirAll(filepath.Join(p.odaConf.Dirs.Repo, version), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spec := filepath.Join(p.root, "spec.yaml")
+	writeFile(t, spec, `projects:
+  - name: acme
+    edition: enterprise
+    version: "17.0"
+    create_instance: true
+    restore: latest
+  - name: acme
+    edition: community
+    version: "16.0"
+`)
+	specs, err := loadProjectSpecs(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 || !specs[0].CreateInstance || specs[0].Restore != "latest" {
+		t.Errorf("specs %+v", specs)
+	}
+
+	// the duplicate is found before anything is created
+	if err := (&ODA{}).ProjectInitFile(spec); err == nil || !strings.Contains(err.Error(), "acme already exists") {
+		t.Errorf("duplicate project: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.odaConf.Dirs.Project, "acme")); !os.IsNotExist(err) {
+		t.Error("created acme from an invalid spec file")
+	}
+
+	writeFile(t, spec, "projects:\n  - name: acme\n    editon: community\n")
+	if _, err := loadProjectSpecs(spec); err == nil {
+		t.Error("loaded a spec with an unknown field")
+	}
+	writeFile(t, spec, "projects: []\n")
+	if _, err := loadProjectSpecs(spec); err == nil {
+		t.Error("loaded a spec without projects")
+	}
+}
+
+func TestProjectBackup(t *testing.T) {
+	p := setupProject(t)
+	backups := filepath.Join(p.odaConf.Dirs.Project, "backups")
+	for _, name := range []string{
+		"2024_01_02_10_00_00__p1.tar.zst",
+		"2024_03_01_10_00_00__p1.tar.zst",
+		"2024_02_01_10_00_00__other.tar.zst",
+		"2024_04_01_10_00_00__p10.tar.zst",
+		"2024_04_02_10_00_00__xp1.tar.zst",
+	} {
+		writeFile(t, filepath.Join(backups, name), "")
+	}
+
+	for restore, want := range map[string]string{
+		"latest":                             "2024_03_01_10_00_00__p1.tar.zst",
+		"2024_02_01_10_00_00__other.tar.zst": "2024_02_01_10_00_00__other.tar.zst",
+	} {
+		if got, err := projectBackup("p1", restore); err != nil || got != want {
+			t.Errorf("restore %s = %q, %v", restore, got, err)
+		}
+	}
+	if _, err := projectBackup("p2", "latest"); err == nil {
+		t.Error("found a backup of p2")
+	}
+	if _, err := projectBackup("p1", "missing.tar.zst"); err == nil {
+		t.Error("found a missing backup")
+	}
+}
+
+func TestProjectSetupRollback(t *testing.T) {
+	p := setupProject(t)
+	// odoo.conf can't be written without the embedded templates
+	spec := ProjectSpec{Name: "p2", Edition: "community", Version: "17.0", Template: "customer"}
+	if err := projectSetup(spec, embed.FS{}); err == nil {
+		t.Fatal("setup without templates succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(p.odaConf.Dirs.Project, "p2")); !os.IsNotExist(err) {
+		t.Errorf("project directory left behind after a failed setup: %v", err)
+	}
+}
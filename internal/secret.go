@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/secret"
+	"github.com/ppreeper/oda/ui"
+	"golang.org/x/term"
+)
+
+// readSecret reads a secret value without echo on a terminal or from
+// piped stdin, so it stays out of the shell history
+var readSecret = func(name string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "value for ", name, ": ")
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret %w", err)
+		}
+		return string(value), nil
+	}
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret %w", err)
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+// SecretSet
+// store a secret, the value is prompted for or read from stdin, never
+// taken as an argument where it would end up in the shell history
+func (o *ODA) SecretSet(name string) error {
+	if err := secret.ValidateName(name); err != nil {
+		return err
+	}
+	store, err := config.OpenSecretStore()
+	if err != nil {
+		return err
+	}
+	value, err := readSecret(name)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("empty value for secret %s", name)
+	}
+	if err := store.Set(name, value); err != nil {
+		return fmt.Errorf("could not store secret %s %w", name, err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("secret", name, "stored in", store.Backend()))
+	fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("use it as", secret.Scheme+name))
+	return nil
+}
+
+// SecretGet
+// print a secret
+func (o *ODA) SecretGet(name string) error {
+	store, err := config.OpenSecretStore()
+	if err != nil {
+		return err
+	}
+	value, err := store.Get(name)
+	if errors.Is(err, secret.ErrNotFound) {
+		return fmt.Errorf("secret %s not found in %s", name, store.Backend())
+	}
+	if err != nil {
+		return fmt.Errorf("could not read secret %s %w", name, err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// SecretList
+// list the secret names, never the values
+func (o *ODA) SecretList() error {
+	store, err := config.OpenSecretStore()
+	if err != nil {
+		return err
+	}
+	names, err := store.List()
+	if err != nil {
+		return fmt.Errorf("could not list secrets %w", err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("secrets in", store.Backend()))
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// SecretRemove
+// delete a secret
+func (o *ODA) SecretRemove(name string) error {
+	store, err := config.OpenSecretStore()
+	if err != nil {
+		return err
+	}
+	err = store.Delete(name)
+	if errors.Is(err, secret.ErrNotFound) {
+		return fmt.Errorf("secret %s not found in %s", name, store.Backend())
+	}
+	if err != nil {
+		return fmt.Errorf("could not remove secret %s %w", name, err)
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("secret", name, "removed"))
+	return nil
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/secret"
+)
+
+func TestSecretSetRemove(t *testing.T) {
+	setupProject(t)
+	odaConf, _ := config.LoadOdaConfigFile()
+	odaConf.Secrets.Backend = secret.BackendFile
+	odaConf.Database.Password = "secret://db/password"
+	if err := config.SaveOdaConfig(odaConf); err != nil {
+		t.Fatal(err)
+	}
+	origRead := readSecret
+	t.Cleanup(func() { readSecret = origRead })
+	readSecret = func(string) (string, error) { return "s3cret", nil }
+	oda := &ODA{}
+
+	if err := oda.SecretSet("db password"); err == nil {
+		t.Error("set an invalid name")
+	}
+	if err := oda.SecretSet("db/password"); err != nil {
+		t.Fatal(err)
+	}
+	if odaConf, err := config.LoadOdaConfig(); err != nil || odaConf.Database.Password != "s3cret" {
+		t.Errorf("password %q, %v", odaConf.Database.Password, err)
+	}
+
+	readSecret = func(string) (string, error) { return "", nil }
+	if err := oda.SecretSet("github/token"); err == nil {
+		t.Error("set an empty secret")
+	}
+
+	if err := oda.SecretRemove("db/password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oda.SecretRemove("db/password"); err == nil {
+		t.Error("removed db/password twice")
+	}
+	if _, err := config.LoadOdaConfig(); !errors.Is(err, secret.ErrNotFound) {
+		t.Errorf("load with a removed secret: %v", err)
+	}
+}
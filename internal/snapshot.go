@@ -0,0 +1,381 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/lib"
+	"github.com/ppreeper/oda/ui"
+)
+
+var snapshotNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// snapshotDBName is the database holding the copy of dbName taken with snapshotName
+func snapshotDBName(dbName, snapshotName string) (string, error) {
+	name := dbName + "_snap_" + snapshotName
+	// postgresql truncates identifiers longer than 63 bytes
+	if len(name) > 63 {
+		return "", fmt.Errorf("snapshot name %s is too long for database %s", snapshotName, dbName)
+	}
+	return name, nil
+}
+
+// restoringDBName is the database a snapshot database is copied to before
+// it replaces dbName
+func restoringDBName(dbName string) (string, error) {
+	name := dbName + "_restoring"
+	if len(name) > 63 {
+		return "", fmt.Errorf("database name %s is too long to restore a snapshot", dbName)
+	}
+	return name, nil
+}
+
+// quoteIdent quotes a postgresql identifier
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes a postgresql string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// postgresSQL runs sql as the postgres superuser on the database instance
+func postgresSQL(inc incus.Backend, dbHost, sql string, stdout io.Writer) error {
+	uid, err := inc.IncusGetUid(dbHost, "postgres")
+	if err != nil {
+		return fmt.Errorf("could not get postgres user id %w", err)
+	}
+	var stderr bytes.Buffer
+	if err := inc.Exec(dbHost, incus.ExecOptions{User: uid, Stdout: stdout, Stderr: &stderr},
+		"psql", "-U", "postgres", "-d", "postgres", "-v", "ON_ERROR_STOP=1", "-tA", "-c", sql,
+	); err != nil {
+		return fmt.Errorf("psql failed %s %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return nil
+}
+
+// terminateSessions disconnects the sessions on dbName
+func terminateSessions(inc incus.Backend, dbHost, dbName string) error {
+	terminate := "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = " + quoteLiteral(dbName)
+	if err := postgresSQL(inc, dbHost, terminate, nil); err != nil {
+		return fmt.Errorf("could not disconnect sessions on %s %w", dbName, err)
+	}
+	return nil
+}
+
+// copyDatabase creates target as a copy of source, disconnecting any
+// sessions on source first as postgresql requires for a template
+func copyDatabase(inc incus.Backend, dbHost, source, target, owner string) error {
+	if err := terminateSessions(inc, dbHost, source); err != nil {
+		return err
+	}
+	create := "CREATE DATABASE " + quoteIdent(target) + " TEMPLATE " + quoteIdent(source)
+	if owner != "" {
+		create += " OWNER " + quoteIdent(owner)
+	}
+	if err := postgresSQL(inc, dbHost, create, nil); err != nil {
+		return fmt.Errorf("could not copy database %s to %s %w", source, target, err)
+	}
+	return nil
+}
+
+// renameDatabase renames source to target, source must have no sessions
+func renameDatabase(inc incus.Backend, dbHost, source, target string) error {
+	if err := postgresSQL(inc, dbHost, "ALTER DATABASE "+quoteIdent(source)+" RENAME TO "+quoteIdent(target), nil); err != nil {
+		return fmt.Errorf("could not rename database %s to %s %w", source, target, err)
+	}
+	return nil
+}
+
+// dropDatabase drops dbName if it exists, the sessions are disconnected
+// first as DROP DATABASE WITH (FORCE) needs postgresql 13
+func dropDatabase(inc incus.Backend, dbHost, dbName string) error {
+	if err := terminateSessions(inc, dbHost, dbName); err != nil {
+		return err
+	}
+	if err := postgresSQL(inc, dbHost, "DROP DATABASE IF EXISTS "+quoteIdent(dbName), nil); err != nil {
+		return fmt.Errorf("could not drop database %s %w", dbName, err)
+	}
+	return nil
+}
+
+// databaseSizes returns the size in bytes of every database on the server
+func databaseSizes(inc incus.Backend, dbHost string) (map[string]int64, error) {
+	var out bytes.Buffer
+	if err := postgresSQL(inc, dbHost, "SELECT datname, pg_database_size(datname) FROM pg_database", &out); err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		name, size, ok := strings.Cut(line, "|")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[name] = n
+	}
+	return sizes, nil
+}
+
+// snapshotContext gathers what every snapshot command needs for the current project
+func snapshotContext() (inc incus.Backend, project string, odooConf *config.OdooConfig, err error) {
+	cwd, project := lib.GetProject()
+	odooConf, err = config.LoadOdooConfig(cwd)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("load odoo config failed %w", err)
+	}
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("load oda config failed %w", err)
+	}
+	return newBackend(odaConf), project, odooConf, nil
+}
+
+// stopForSnapshot stops the instance and returns a func that starts it
+// again if it was running, so the database has no open sessions
+func stopForSnapshot(inc incus.Backend, project string) (func(), error) {
+	instanceStatus, err := inc.GetInstanceState(project)
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s state %w", project, err)
+	}
+	if !strings.EqualFold(instanceStatus.Metadata.Status, "Running") {
+		return func() {}, nil
+	}
+	if err := inc.SetInstanceState(project, "stop"); err != nil {
+		return nil, fmt.Errorf("stopping %s failed %w", project, err)
+	}
+	return func() {
+		if err := inc.SetInstanceState(project, "start"); err != nil {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("starting", project, "failed", err.Error()))
+		}
+	}, nil
+}
+
+// SnapshotCreate
+// checkpoint the project instance and its database together
+// the instance is stopped while the snapshot is taken
+func (o *ODA) SnapshotCreate(snapshotName string) error {
+	if !IsProject() {
+		return nil
+	}
+	if snapshotName == "" {
+		snapshotName = "snap-" + time.Now().Format("20060102-150405")
+	}
+	if !snapshotNameRe.MatchString(snapshotName) {
+		return fmt.Errorf("invalid snapshot name %s, use letters, digits, - and _", snapshotName)
+	}
+
+	inc, project, odooConf, err := snapshotContext()
+	if err != nil {
+		return err
+	}
+	snapDB, err := snapshotDBName(odooConf.DbName, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := inc.GetSnapshots(project)
+	if err != nil {
+		return fmt.Errorf("could not list snapshots of %s %w", project, err)
+	}
+	if existsIn(snapshotNames(snapshots), snapshotName) {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("snapshot", snapshotName, "already exists"))
+		return nil
+	}
+
+	restart, err := stopForSnapshot(inc, project)
+	if err != nil {
+		return err
+	}
+	defer restart()
+
+	if err := inc.CreateSnapshot(project, snapshotName); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Copying database", odooConf.DbName, "to", snapDB))
+	if err := copyDatabase(inc, odooConf.DbHost, odooConf.DbName, snapDB, ""); err != nil {
+		// keep the pair consistent, a snapshot without its database cannot be restored
+		if derr := inc.DeleteSnapshot(project, snapshotName); derr != nil {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(derr.Error()))
+		}
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("snapshot", snapshotName, "created"))
+	return nil
+}
+
+// SnapshotList
+// list the snapshots of the project instance
+func (o *ODA) SnapshotList() error {
+	if !IsProject() {
+		return nil
+	}
+	inc, project, odooConf, err := snapshotContext()
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := inc.GetSnapshots(project)
+	if err != nil {
+		return fmt.Errorf("could not list snapshots of %s %w", project, err)
+	}
+	dbSizes, err := databaseSizes(inc, odooConf.DbHost)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.WarningStyle.Render("could not get database sizes", err.Error()))
+	}
+
+	rows := [][]string{}
+	for _, snapshot := range snapshots {
+		dbSize := "-"
+		if snapDB, err := snapshotDBName(odooConf.DbName, snapshot.Name); err == nil {
+			if size, ok := dbSizes[snapDB]; ok {
+				dbSize = formatBytes(size)
+			}
+		}
+		rows = append(rows, []string{
+			snapshot.Name,
+			snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			formatBytes(snapshot.Size),
+			dbSize,
+		})
+	}
+	t := ui.NewTable().
+		Headers("NAME", "CREATED", "SIZE", "DB SIZE").
+		Rows(rows...)
+
+	fmt.Fprintln(os.Stderr, t)
+	return nil
+}
+
+// SnapshotRestore
+// roll back the project instance and its database to a snapshot
+func (o *ODA) SnapshotRestore(snapshotName string) error {
+	if !IsProject() {
+		return nil
+	}
+	inc, project, odooConf, err := snapshotContext()
+	if err != nil {
+		return err
+	}
+	snapDB, err := snapshotDBName(odooConf.DbName, snapshotName)
+	if err != nil {
+		return err
+	}
+	restoreDB, err := restoringDBName(odooConf.DbName)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := inc.GetSnapshots(project)
+	if err != nil {
+		return fmt.Errorf("could not list snapshots of %s %w", project, err)
+	}
+	if !existsIn(snapshotNames(snapshots), snapshotName) {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("no snapshot", snapshotName, "for", project))
+		return nil
+	}
+	dbSizes, err := databaseSizes(inc, odooConf.DbHost)
+	if err != nil {
+		return err
+	}
+	if _, ok := dbSizes[snapDB]; !ok {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("snapshot database", snapDB, "is missing, not restoring"))
+		return nil
+	}
+
+	confim := areYouSure("restore " + project + " and database " + odooConf.DbName + " to snapshot " + snapshotName)
+	if !confim {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("restoring snapshot canceled"))
+		return nil
+	}
+
+	// the snapshot database is copied before anything is changed, so a
+	// failed copy leaves the project as it was
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Copying database", snapDB, "to", restoreDB))
+	if err := dropDatabase(inc, odooConf.DbHost, restoreDB); err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		if derr := dropDatabase(inc, odooConf.DbHost, restoreDB); derr != nil {
+			fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render(derr.Error()))
+		}
+		return err
+	}
+	if err := copyDatabase(inc, odooConf.DbHost, snapDB, restoreDB, odooConf.DbUser); err != nil {
+		return abort(err)
+	}
+
+	restart, err := stopForSnapshot(inc, project)
+	if err != nil {
+		return abort(err)
+	}
+	defer restart()
+
+	if err := inc.RestoreSnapshot(project, snapshotName); err != nil {
+		return abort(err)
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("Restoring database", odooConf.DbName, "from", snapDB))
+	if err := dropDatabase(inc, odooConf.DbHost, odooConf.DbName); err != nil {
+		return abort(err)
+	}
+	if err := renameDatabase(inc, odooConf.DbHost, restoreDB, odooConf.DbName); err != nil {
+		return fmt.Errorf("the snapshot database is kept as %s %w", restoreDB, err)
+	}
+
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render(project, "restored to snapshot", snapshotName))
+	return nil
+}
+
+// SnapshotDelete
+// remove a snapshot of the project instance and its database copy
+func (o *ODA) SnapshotDelete(snapshotName string) error {
+	if !IsProject() {
+		return nil
+	}
+	inc, project, odooConf, err := snapshotContext()
+	if err != nil {
+		return err
+	}
+	snapDB, err := snapshotDBName(odooConf.DbName, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	confim := areYouSure("delete snapshot " + snapshotName + " of " + project)
+	if !confim {
+		fmt.Fprintln(os.Stderr, ui.ErrorStyle.Render("deleting snapshot canceled"))
+		return nil
+	}
+
+	if err := inc.DeleteSnapshot(project, snapshotName); err != nil && !incus.IsNotFound(err) {
+		return err
+	}
+	if err := dropDatabase(inc, odooConf.DbHost, snapDB); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ui.StepStyle.Render("snapshot", snapshotName, "deleted"))
+	return nil
+}
+
+func snapshotNames(snapshots []incus.Snapshot) []string {
+	names := []string{}
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	return names
+}
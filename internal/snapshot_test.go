@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ppreeper/oda/incus"
+)
+
+// setupSnapshots wires the postgresql sizes query to report the databases
+// and returns the sql run by the snapshot commands
+func setupSnapshots(t *testing.T, p *testProject, databases ...string) func() []string {
+	t.Helper()
+	p.backend.AddInstance("p1", "Running")
+	p.backend.AddInstance("db", "Running")
+	p.backend.ExecFunc = func(instanceName string, opts incus.ExecOptions, command ...string) error {
+		if strings.HasPrefix(command[len(command)-1], "SELECT datname, pg_database_size") {
+			for _, db := range databases {
+				io.WriteString(opts.Stdout, db+"|1024\n")
+			}
+		}
+		return nil
+	}
+	return func() []string {
+		sql := []string{}
+		for _, call := range p.backend.Calls {
+			if call.Method == "Exec" && call.Args[1] == "psql" {
+				sql = append(sql, call.Args[len(call.Args)-1])
+			}
+		}
+		return sql
+	}
+}
+
+func TestDropDatabase(t *testing.T) {
+	p := setupProject(t)
+	p.backend.AddInstance("db", "Running")
+
+	if err := dropDatabase(p.backend, "db", "p1_snap"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"Exec db psql -U postgres -d postgres -v ON_ERROR_STOP=1 -tA -c SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'p1_snap'",
+		`Exec db psql -U postgres -d postgres -v ON_ERROR_STOP=1 -tA -c DROP DATABASE IF EXISTS "p1_snap"`,
+	}
+	if got := p.backend.CallsTo("Exec"); !slices.Equal(got, want) {
+		t.Errorf("calls %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotCreate(t *testing.T) {
+	p := setupProject(t)
+	sql := setupSnapshots(t, p)
+
+	if err := (&ODA{}).SnapshotCreate("s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalled(t, p.backend, "CreateSnapshot", "CreateSnapshot p1 s1")
+	assertCalled(t, p.backend, "SetInstanceState", "SetInstanceState p1 stop", "SetInstanceState p1 start")
+	if got := sql(); !slices.Contains(got, `CREATE DATABASE "p1_local_snap_s1" TEMPLATE "p1_local"`) {
+		t.Errorf("snapshot database not copied %q", got)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	p := setupProject(t)
+	sql := setupSnapshots(t, p, "p1_local", "p1_local_snap_s1")
+	p.backend.CreateSnapshot("p1", "s1")
+	p.backend.Calls = nil
+
+	if err := (&ODA{}).SnapshotRestore("s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalled(t, p.backend, "RestoreSnapshot", "RestoreSnapshot p1 s1")
+	want := []string{
+		"SELECT datname, pg_database_size(datname) FROM pg_database",
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'p1_local_restoring'",
+		`DROP DATABASE IF EXISTS "p1_local_restoring"`,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'p1_local_snap_s1'",
+		`CREATE DATABASE "p1_local_restoring" TEMPLATE "p1_local_snap_s1" OWNER "odoo"`,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'p1_local'",
+		`DROP DATABASE IF EXISTS "p1_local"`,
+		`ALTER DATABASE "p1_local_restoring" RENAME TO "p1_local"`,
+	}
+	if got := sql(); !slices.Equal(got, want) {
+		t.Errorf("sql\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestSnapshotRestoreCopyFails(t *testing.T) {
+	p := setupProject(t)
+	sql := setupSnapshots(t, p, "p1_local", "p1_local_snap_s1")
+	p.backend.CreateSnapshot("p1", "s1")
+	p.backend.Calls = nil
+	sizes := p.backend.ExecFunc
+	p.backend.ExecFunc = func(instanceName string, opts incus.ExecOptions, command ...string) error {
+		if strings.HasPrefix(command[len(command)-1], "CREATE DATABASE") {
+			return errors.New("disk full")
+		}
+		return sizes(instanceName, opts, command...)
+	}
+
+	if err := (&ODA{}).SnapshotRestore("s1"); err == nil {
+		t.Fatal("restore with a failed copy succeeded")
+	}
+
+	assertNotCalled(t, p.backend, "RestoreSnapshot")
+	assertNotCalled(t, p.backend, "SetInstanceState")
+	got := sql()
+	if slices.Contains(got, `DROP DATABASE IF EXISTS "p1_local"`) {
+		t.Errorf("live database dropped after a failed copy %q", got)
+	}
+	if got[len(got)-1] != `DROP DATABASE IF EXISTS "p1_local_restoring"` {
+		t.Errorf("partial copy not cleaned up %q", got)
+	}
+}
+
+func TestSnapshotDelete(t *testing.T) {
+	p := setupProject(t)
+	sql := setupSnapshots(t, p)
+	p.backend.CreateSnapshot("p1", "s1")
+
+	if err := (&ODA{}).SnapshotDelete("s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalled(t, p.backend, "DeleteSnapshot", "DeleteSnapshot p1 s1")
+	if got := sql(); !slices.Contains(got, `DROP DATABASE IF EXISTS "p1_local_snap_s1"`) {
+		t.Errorf("snapshot database not dropped %q", got)
+	}
+	if snapshots, _ := p.backend.GetSnapshots("p1"); len(snapshots) != 0 {
+		t.Errorf("snapshots left %v", snapshots)
+	}
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
+	"github.com/ppreeper/oda/ui"
+)
+
+// InstanceUsage is the resource usage of one instance between two samples
+type InstanceUsage struct {
+	Name        string  `json:"name"`
+	State       string  `json:"state"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage int64   `json:"memory_usage"`
+	MemoryLimit int64   `json:"memory_limit"`
+	DiskUsage   int64   `json:"disk_usage"`
+	DiskTotal   int64   `json:"disk_total"`
+	RxRate      float64 `json:"rx_bytes_per_second"`
+	TxRate      float64 `json:"tx_bytes_per_second"`
+	RxBytes     int64   `json:"rx_bytes"`
+	TxBytes     int64   `json:"tx_bytes"`
+}
+
+// usageSample is an instance state taken at a point in time
+type usageSample struct {
+	at    time.Time
+	state incus.IncusInstanceStatus
+}
+
+// OdooTop shows live resource usage of the project instances and the db server
+func (o *ODA) OdooTop(interval time.Duration, jsonOut bool) error {
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		return fmt.Errorf("load oda config failed %w", err)
+	}
+	inc := newBackend(odaConf)
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	names := topInstances(odaConf)
+	prev, err := sampleUsage(inc, names)
+	if err != nil {
+		return err
+	}
+
+	if jsonOut {
+		time.Sleep(interval)
+		cur, err := sampleUsage(inc, names)
+		if err != nil {
+			return err
+		}
+		usage := computeUsage(names, prev, cur)
+		if usage == nil {
+			usage = []InstanceUsage{}
+		}
+		out, err := json.MarshalIndent(usage, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling usage %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		// projects are picked up again each round
+		names = topInstances(odaConf)
+		cur, err := sampleUsage(inc, names)
+		if err != nil {
+			return err
+		}
+		// clear the screen and redraw from the top left
+		fmt.Fprint(os.Stderr, "\033[H\033[2J")
+		fmt.Fprintln(os.Stderr, usageTable(computeUsage(names, prev, cur)))
+		fmt.Fprintln(os.Stderr, ui.SubStepStyle.Render("every", interval.String(), "- ctrl+c to quit"))
+		prev = cur
+	}
+}
+
+// topInstances is the db servers followed by the project instances
+func topInstances(odaConf *config.OdaConf) []string {
+	names := []string{}
+	for _, db := range odaConf.DatabaseServers() {
+		names = append(names, db.Host)
+	}
+	for _, project := range GetCurrentOdooProjects() {
+		if !existsIn(names, project) {
+			names = append(names, project)
+		}
+	}
+	return names
+}
+
+// sampleUsage gets the state of each instance, instances that do not exist are skipped
+func sampleUsage(inc incus.Backend, names []string) (map[string]usageSample, error) {
+	samples := map[string]usageSample{}
+	for _, name := range names {
+		state, err := inc.GetInstanceState(name)
+		if incus.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get state of %s %w", name, err)
+		}
+		samples[name] = usageSample{at: time.Now(), state: state}
+	}
+	return samples, nil
+}
+
+// computeUsage turns two samples of each instance into usage rates in the
+// order of names, instances missing from the current sample are left out
+func computeUsage(names []string, prev, cur map[string]usageSample) []InstanceUsage {
+	var usage []InstanceUsage
+	for _, name := range names {
+		c, ok := cur[name]
+		if !ok {
+			continue
+		}
+		m := c.state.Metadata
+		u := InstanceUsage{
+			Name:        name,
+			State:       m.Status,
+			MemoryUsage: int64(m.Memory.Usage),
+			MemoryLimit: m.Memory.Total,
+			DiskUsage:   int64(m.Disk.Root.Usage),
+			DiskTotal:   int64(m.Disk.Root.Total),
+		}
+		u.RxBytes, u.TxBytes = networkBytes(m)
+		p, ok := prev[name]
+		elapsed := c.at.Sub(p.at)
+		if ok && elapsed > 0 {
+			pm := p.state.Metadata
+			prevRx, prevTx := networkBytes(pm)
+			u.CPUPercent = rate(m.CPU.Usage, pm.CPU.Usage, elapsed) / float64(time.Second) * 100
+			u.RxRate = rate(u.RxBytes, prevRx, elapsed)
+			u.TxRate = rate(u.TxBytes, prevTx, elapsed)
+		}
+		usage = append(usage, u)
+	}
+	return usage
+}
+
+// networkBytes totals the traffic of every interface except loopback
+func networkBytes(state incus.InstanceState) (rx, tx int64) {
+	for name, network := range state.Network {
+		if name == "lo" || network.Type == "loopback" {
+			continue
+		}
+		rx += int64(network.Counters.BytesReceived)
+		tx += int64(network.Counters.BytesSent)
+	}
+	return rx, tx
+}
+
+// rate is the per second change of a counter, a counter that went
+// backwards was reset by a restart and has no rate
+func rate(cur, prev int64, elapsed time.Duration) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed.Seconds()
+}
+
+func usageTable(usage []InstanceUsage) *table.Table {
+	rows := [][]string{}
+	for _, u := range usage {
+		rows = append(rows, []string{
+			u.Name,
+			u.State,
+			fmt.Sprintf("%.1f%%", u.CPUPercent),
+			usedOf(u.MemoryUsage, u.MemoryLimit),
+			usedOf(u.DiskUsage, u.DiskTotal),
+			formatBytes(int64(u.RxRate)) + "/s",
+			formatBytes(int64(u.TxRate)) + "/s",
+		})
+	}
+	return ui.NewTable().
+		Headers("NAME", "STATE", "CPU", "MEMORY", "DISK", "RX", "TX").
+		Rows(rows...)
+}
+
+// usedOf renders used/limit, the limit is left off when there is none
+func usedOf(used, limit int64) string {
+	if limit <= 0 {
+		return formatBytes(used)
+	}
+	return formatBytes(used) + "/" + formatBytes(limit)
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppreeper/oda/config"
+)
+
+func testSample(t *testing.T, at time.Time, state string) usageSample {
+	t.Helper()
+	var sample usageSample
+	if err := json.Unmarshal([]byte(state), &sample.state); err != nil {
+		t.Fatal(err)
+	}
+	sample.at = at
+	return sample
+}
+
+func TestComputeUsage(t *testing.T) {
+	start := time.Now()
+	prev := map[string]usageSample{
+		"db": testSample(t, start, `{"metadata":{"status":"Running","cpu":{"usage":1000000000},
+			"network":{"eth0":{"counters":{"bytes_received":1000,"bytes_sent":500}}}}}`),
+		"p1": testSample(t, start, `{"metadata":{"status":"Running","cpu":{"usage":5000000000},
+			"network":{"eth0":{"counters":{"bytes_received":9000,"bytes_sent":9000}}}}}`),
+	}
+	cur := map[string]usageSample{
+		"db": testSample(t, start.Add(2*time.Second), `{"metadata":{"status":"Running","cpu":{"usage":2000000000},
+			"memory":{"usage":1024,"total":4096},"disk":{"root":{"usage":2048}},
+			"network":{"eth0":{"counters":{"bytes_received":3000,"bytes_sent":1500}}}}}`),
+		// p1 restarted, its counters started again from zero
+		"p1": testSample(t, start.Add(2*time.Second), `{"metadata":{"status":"Running","cpu":{"usage":100},
+			"network":{"eth0":{"counters":{"bytes_received":10,"bytes_sent":10}}}}}`),
+		"p2": testSample(t, start.Add(2*time.Second), `{"metadata":{"status":"Stopped"}}`),
+	}
+
+	usage := computeUsage([]string{"db", "p1", "p2", "p3"}, prev, cur)
+	if len(usage) != 3 {
+		t.Fatalf("got %d rows, want 3", len(usage))
+	}
+
+	db := usage[0]
+	if db.Name != "db" || db.CPUPercent != 50 || db.RxRate != 1000 || db.TxRate != 500 {
+		t.Errorf("db usage %+v", db)
+	}
+	if db.MemoryUsage != 1024 || db.MemoryLimit != 4096 || db.DiskUsage != 2048 {
+		t.Errorf("db memory and disk %+v", db)
+	}
+	if p1 := usage[1]; p1.CPUPercent != 0 || p1.RxRate != 0 || p1.TxRate != 0 {
+		t.Errorf("reset counters gave rates %+v", p1)
+	}
+	if p2 := usage[2]; p2.State != "Stopped" || p2.CPUPercent != 0 {
+		t.Errorf("p2 usage %+v", p2)
+	}
+}
+
+func TestUsedOf(t *testing.T) {
+	if got := usedOf(512, 0); got != "512B" {
+		t.Errorf("usedOf without limit %q", got)
+	}
+	if got := usedOf(1024, 2048); got != "1.0KiB/2.0KiB" {
+		t.Errorf("usedOf with limit %q", got)
+	}
+}
+
+func TestTopInstances(t *testing.T) {
+	p := setupProject(t)
+	addDatabaseServer(t, p)
+	odaConf, err := config.LoadOdaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(topInstances(odaConf), ","); got != "db,pg12,p1" {
+		t.Errorf("top instances %s, want db,pg12,p1", got)
+	}
+}
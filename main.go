@@ -18,11 +18,15 @@ package main
 
 import (
 	"embed"
+	"errors"
 	// _ "embed"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/ppreeper/oda/config"
+	"github.com/ppreeper/oda/incus"
 	"github.com/ppreeper/oda/internal"
 	"github.com/ppreeper/oda/ui"
 	"github.com/urfave/cli/v2"
@@ -45,6 +49,23 @@ func main() {
 		Usage:                oda.Usage,
 		Version:              oda.Version,
 		EnableBashCompletion: true,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "oda.yaml to use instead of ~/.config/oda/oda.yaml",
+				EnvVars: []string{"ODA_CONFIG"},
+			},
+			&cli.StringFlag{
+				Name:    "context",
+				Usage:   "oda.yaml context to use instead of the current one",
+				EnvVars: []string{"ODA_CONTEXT"},
+			},
+		},
+		Before: func(cCtx *cli.Context) error {
+			config.SetConfigFile(cCtx.String("config"))
+			config.SetContext(cCtx.String("context"))
+			return nil
+		},
 		Commands: []*cli.Command{
 			// ####################################
 			// Admin User Management
@@ -75,7 +96,7 @@ func main() {
 					if modlen == 0 {
 						return fmt.Errorf("no modules specified")
 					}
-					// calls into "incus exec <project> odoo-bin install <module>"
+					// runs "odas install <module>" in the project instance
 					return oda.InstanceAppInstallUpgrade(true, cCtx.Args().Slice()...)
 				},
 			},
@@ -89,7 +110,7 @@ func main() {
 					if modlen == 0 {
 						return fmt.Errorf("no modules specified")
 					}
-					// calls into "incus exec <project> odoo-bin upgrade <module>"
+					// runs "odas upgrade <module>" in the project instance
 					return oda.InstanceAppInstallUpgrade(false, cCtx.Args().Slice()...)
 				},
 			},
@@ -103,7 +124,7 @@ func main() {
 					if modlen == 0 {
 						return fmt.Errorf("no modules specified")
 					}
-					// calls into "incus exec <project> odoo-bin scaffold <module>"
+					// runs "odas scaffold <module>" in the project instance
 					return oda.Scaffold(cCtx.Args().First())
 				},
 			},
@@ -115,7 +136,7 @@ func main() {
 				Usage:    "Backup database filestore and addons",
 				Category: "Backup Management",
 				Action: func(cCtx *cli.Context) error {
-					// calls into "incus exec <project> odas backup"
+					// runs "odas backup" in the project instance
 					return oda.Backup()
 				},
 			},
@@ -158,6 +179,110 @@ func main() {
 			// ####################################
 			// Config Commands (Requires root access)
 			//   config      config commands
+			{
+				Name:     "secret",
+				Usage:    "store passwords and tokens in the keyring",
+				Category: "Config Commands",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "set",
+						Usage:     "store a secret, the value is prompted for or read from stdin",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("usage: oda secret set <name>")
+							}
+							return oda.SecretSet(cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "get",
+						Usage:     "print a secret",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no secret specified")
+							}
+							return oda.SecretGet(cCtx.Args().First())
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "list the secret names",
+						Action: func(cCtx *cli.Context) error {
+							return oda.SecretList()
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "remove a secret",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no secret specified")
+							}
+							return oda.SecretRemove(cCtx.Args().First())
+						},
+					},
+				},
+			},
+			{
+				Name:     "context",
+				Usage:    "switch between oda.yaml contexts",
+				Category: "Config Commands",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list contexts",
+						Action: func(cCtx *cli.Context) error {
+							return oda.ContextList()
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "make a context current, default for the base settings",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no context specified")
+							}
+							return oda.ContextUse(cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "add",
+						Usage:     "add a context",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "set",
+								Usage: "setting the context changes, as section.key=value",
+							},
+							&cli.BoolFlag{
+								Name:  "use",
+								Usage: "make the new context current",
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no context specified")
+							}
+							return oda.ContextAdd(cCtx.Args().First(), cCtx.StringSlice("set"), cCtx.Bool("use"))
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "remove a context",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no context specified")
+							}
+							return oda.ContextRemove(cCtx.Args().First())
+						},
+					},
+				},
+			},
 			{
 				Name:     "config",
 				Usage:    "config commands",
@@ -171,6 +296,49 @@ func main() {
 							return oda.ConfigInit()
 						},
 					},
+					{
+						Name:  "show",
+						Usage: "show the effective config and where each setting comes from",
+						Action: func(cCtx *cli.Context) error {
+							return oda.ConfigShow()
+						},
+					},
+					{
+						Name:  "odoo",
+						Usage: "get and set options of the project odoo.conf",
+						Subcommands: []*cli.Command{
+							{
+								Name:      "get",
+								Usage:     "print an option, every option without a key",
+								ArgsUsage: "[key]",
+								Action: func(cCtx *cli.Context) error {
+									return oda.ConfigOdooGet(cCtx.Args().First())
+								},
+							},
+							{
+								Name:      "set",
+								Usage:     "set an option",
+								ArgsUsage: "<key> <value>",
+								Action: func(cCtx *cli.Context) error {
+									if cCtx.Args().Len() != 2 {
+										return fmt.Errorf("usage: oda config odoo set <key> <value>")
+									}
+									return oda.ConfigOdooSet(cCtx.Args().Get(0), cCtx.Args().Get(1))
+								},
+							},
+							{
+								Name:      "unset",
+								Usage:     "remove an option so odoo uses its default",
+								ArgsUsage: "<key>",
+								Action: func(cCtx *cli.Context) error {
+									if cCtx.Args().Len() != 1 {
+										return fmt.Errorf("no key specified")
+									}
+									return oda.ConfigOdooUnset(cCtx.Args().First())
+								},
+							},
+						},
+					},
 					{
 						Name:  "pyright",
 						Usage: "Setup pyright settings",
@@ -189,6 +357,57 @@ func main() {
 							return oda.ConfigVSCode()
 						},
 					},
+					{
+						Name:  "remote",
+						Usage: "remote incus server",
+						Subcommands: []*cli.Command{
+							{
+								Name:      "add",
+								Usage:     "trust a remote incus server over https and use it",
+								ArgsUsage: "<url>",
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:  "token",
+										Usage: "trust token from incus config trust add on the server",
+									},
+								},
+								Action: func(cCtx *cli.Context) error {
+									if cCtx.Args().Len() != 1 {
+										return fmt.Errorf("remote url required")
+									}
+									return oda.ConfigRemoteAdd(cCtx.Args().First(), cCtx.String("token"))
+								},
+							},
+						},
+					},
+					{
+						Name:  "profile",
+						Usage: "oda incus profile",
+						Subcommands: []*cli.Command{
+							{
+								Name:  "sync",
+								Usage: "apply oda.yaml limits, idmap and mounts to the oda and oda-vm profiles",
+								Action: func(cCtx *cli.Context) error {
+									return oda.ConfigProfileSync()
+								},
+							},
+						},
+					},
+				},
+			},
+			//   doctor      Check the environment oda depends on
+			{
+				Name:     "doctor",
+				Usage:    "Check the environment oda depends on",
+				Category: "Config Commands",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the checks as json",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return oda.Doctor(cCtx.Bool("json"))
 				},
 			},
 			//   hostsfile   Update /etc/hosts file (Requires root access)
@@ -209,55 +428,88 @@ func main() {
 				Category: "Database Management",
 				Subcommands: []*cli.Command{
 					{
-						Name:  "fullreset",
-						Usage: "database full reset",
+						Name:  "list",
+						Usage: "list the database servers",
+						Action: func(cCtx *cli.Context) error {
+							return oda.DBList()
+						},
+					},
+					{
+						Name:      "create",
+						Usage:     "create a database server from oda.yaml",
+						ArgsUsage: "[server]",
+						Action: func(cCtx *cli.Context) error {
+							return oda.DBCreate(cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "switch the project to another database server",
+						ArgsUsage: "<server>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no database server specified")
+							}
+							return oda.DBUse(cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "fullreset",
+						Usage:     "database full reset",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
-							return oda.DBFullReset()
+							return oda.DBFullReset(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "exec",
-						Usage: "database exec (root)",
+						Name:      "exec",
+						Usage:     "database exec (root)",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
-							return oda.DBEXEC()
+							return oda.DBEXEC(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "psql",
-						Usage: "database psql",
+						Name:      "psql",
+						Usage:     "database psql",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
-							return oda.DBPSQL()
+							return oda.DBPSQL(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "logs",
-						Usage: "follow the database logs",
+						Name:      "logs",
+						Usage:     "follow the database logs",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
-							return oda.DBLogs()
+							return oda.DBLogs(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "start",
-						Usage: "start database",
+						Name:      "start",
+						Usage:     "start database",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
 							// incus starts db instance
-							return oda.DBStart()
+							return oda.DBStart(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "stop",
-						Usage: "stop database",
+						Name:      "stop",
+						Usage:     "stop database",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
 							// incus stops db instance
-							return oda.DBStop()
+							return oda.DBStop(cCtx.Args().First())
 						},
 					},
 					{
-						Name:  "restart",
-						Usage: "restart database",
+						Name:      "restart",
+						Usage:     "restart database",
+						ArgsUsage: "[server]",
 						Action: func(cCtx *cli.Context) error {
 							// incus restarts db instance
-							return oda.DBRestart()
+							return oda.DBRestart(cCtx.Args().First())
 						},
 					},
 				},
@@ -323,7 +575,8 @@ func main() {
 						Name:        "password",
 						Aliases:     []string{"p"},
 						Value:       "admin",
-						Usage:       "password",
+						Usage:       "password, or a secret:// reference",
+						EnvVars:     []string{"ODA_QUERY_PASSWORD"},
 						Destination: &oda.Q.Password,
 					},
 				},
@@ -339,6 +592,31 @@ func main() {
 			},
 			// ####################################
 			// Image Management
+			{
+				Name:     "branch",
+				Usage:    "Odoo branch definitions",
+				Category: "Image Management",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list the odoo branches",
+						Action: func(cCtx *cli.Context) error {
+							return oda.BranchList()
+						},
+					},
+					{
+						Name:      "show",
+						Usage:     "show the image, repos and packages of a branch",
+						ArgsUsage: "<version>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("no version specified")
+							}
+							return oda.BranchShow(cCtx.Args().First())
+						},
+					},
+				},
+			},
 			{
 				Name:     "base",
 				Usage:    "Base Image Management",
@@ -347,9 +625,15 @@ func main() {
 					{
 						Name:  "create",
 						Usage: "Create Base Instance",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "type",
+								Usage: "container or virtual-machine, defaults to incus.instance_type in oda.yaml",
+							},
+						},
 						Action: func(cCtx *cli.Context) error {
 							// builds base image for odoo version (15,16,17,18)
-							return oda.BaseCreate()
+							return oda.BaseCreate(cCtx.String("type"))
 						},
 					},
 					{
@@ -360,6 +644,36 @@ func main() {
 							return oda.BaseUpdate()
 						},
 					},
+					{
+						Name:  "publish",
+						Usage: "Publish Base Instance as an image",
+						Action: func(cCtx *cli.Context) error {
+							// publishes base instance as oda/odoo-<version> image
+							return oda.BasePublish()
+						},
+					},
+					{
+						Name:  "images",
+						Usage: "List published base images",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "prune",
+								Value: false,
+								Usage: "delete old unaliased images",
+							},
+							&cli.IntFlag{
+								Name:  "keep",
+								Value: 2,
+								Usage: "images to keep per base when pruning",
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Int("keep") < 1 {
+								return fmt.Errorf("keep must be at least 1")
+							}
+							return oda.BaseImages(cCtx.Bool("prune"), cCtx.Int("keep"))
+						},
+					},
 					{
 						Name:  "destroy",
 						Usage: "Build Base Instance",
@@ -449,6 +763,47 @@ func main() {
 					return oda.OdooPS()
 				},
 			},
+			{
+				Name:     "top",
+				Usage:    "Show live resource usage of the instances",
+				Category: "Container Management",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 2 * time.Second,
+						Usage: "time between samples",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print one sample as json and exit",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return oda.OdooTop(cCtx.Duration("interval"), cCtx.Bool("json"))
+				},
+			},
+			{
+				Name:     "expose",
+				Usage:    "Forward a host port to the instance",
+				Category: "Container Management",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "port",
+						Usage: "host port, allocated from system.expose_ports when not set",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return oda.OdooExpose(cCtx.Int("port"))
+				},
+			},
+			{
+				Name:     "unexpose",
+				Usage:    "Remove the forwarded host port",
+				Category: "Container Management",
+				Action: func(cCtx *cli.Context) error {
+					return oda.OdooUnexpose()
+				},
+			},
 			//   logs        Follow the logs
 			{
 				Name:     "logs",
@@ -459,6 +814,52 @@ func main() {
 				},
 			},
 			// ####################################
+			// Snapshot Management
+			{
+				Name:     "snapshot",
+				Usage:    "Snapshot the instance and its database",
+				Category: "Container Management",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "create",
+						Usage:     "create a snapshot",
+						ArgsUsage: "[name]",
+						Action: func(cCtx *cli.Context) error {
+							return oda.SnapshotCreate(cCtx.Args().First())
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "list snapshots",
+						Action: func(cCtx *cli.Context) error {
+							return oda.SnapshotList()
+						},
+					},
+					{
+						Name:      "restore",
+						Usage:     "restore the instance and database to a snapshot",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("snapshot name required")
+							}
+							return oda.SnapshotRestore(cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "delete",
+						Usage:     "delete a snapshot",
+						ArgsUsage: "<name>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("snapshot name required")
+							}
+							return oda.SnapshotDelete(cCtx.Args().First())
+						},
+					},
+				},
+			},
+			// ####################################
 			// Project Commands
 			//   project     Project level commands
 			{
@@ -468,9 +869,73 @@ func main() {
 				Subcommands: []*cli.Command{
 					{
 						Name:  "init",
-						Usage: "initialize project directory",
+						Usage: "initialize project directory, prompts for the values not given",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "project name",
+							},
+							&cli.StringFlag{
+								Name:  "edition",
+								Usage: "odoo edition, community or enterprise",
+							},
+							&cli.StringFlag{
+								Name:  "version",
+								Usage: "odoo version, one of the cloned branches",
+							},
+							&cli.StringFlag{
+								Name:  "db-server",
+								Usage: "database server from oda.yaml, the default server when not set",
+							},
+							&cli.StringFlag{
+								Name:  "template",
+								Usage: "project template to add files from, see oda project templates list",
+							},
+							&cli.BoolFlag{
+								Name:  "create-instance",
+								Usage: "create the project instance",
+							},
+							&cli.StringFlag{
+								Name:  "restore",
+								Usage: "backup file to restore, latest for the newest backup of the project",
+							},
+							&cli.StringFlag{
+								Name:    "file",
+								Aliases: []string{"f"},
+								Usage:   "create the projects of a spec file",
+							},
+						},
 						Action: func(cCtx *cli.Context) error {
-							return oda.ProjectInit()
+							if file := cCtx.String("file"); file != "" {
+								for _, flag := range []string{"name", "edition", "version", "db-server", "template", "create-instance", "restore"} {
+									if cCtx.IsSet(flag) {
+										return fmt.Errorf("use either --file or the project flags, --%s is set", flag)
+									}
+								}
+								return oda.ProjectInitFile(file)
+							}
+							return oda.ProjectInit(internal.ProjectSpec{
+								Name:           cCtx.String("name"),
+								Edition:        cCtx.String("edition"),
+								Version:        cCtx.String("version"),
+								DBServer:       cCtx.String("db-server"),
+								Template:       cCtx.String("template"),
+								CreateInstance: cCtx.Bool("create-instance"),
+								Restore:        cCtx.String("restore"),
+							})
+						},
+					},
+					{
+						Name:  "templates",
+						Usage: "project templates for project init",
+						Subcommands: []*cli.Command{
+							{
+								Name:  "list",
+								Usage: "list the embedded and user project templates",
+								Action: func(cCtx *cli.Context) error {
+									return oda.ProjectTemplatesList()
+								},
+							},
 						},
 					},
 					{
@@ -480,6 +945,37 @@ func main() {
 							return oda.ProjectReset()
 						},
 					},
+					{
+						Name:  "export",
+						Usage: "export project config, addons, db and filestore to a bundle",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "bundle file, defaults to the backups directory",
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							return oda.ProjectExport(cCtx.String("output"))
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "recreate a project from an exported bundle",
+						ArgsUsage: "<file>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "project name, defaults to the exported project name",
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.Args().Len() != 1 {
+								return fmt.Errorf("bundle file required")
+							}
+							return oda.ProjectImport(cCtx.Args().First(), cCtx.String("name"))
+						},
+					},
 				},
 			},
 			// ####################################
@@ -543,6 +1039,11 @@ func main() {
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
+		// pass through the exit status of commands run in an instance
+		var exitErr *incus.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		log.Fatal(err)
 	}
 }
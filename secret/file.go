@@ -0,0 +1,184 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// files of the file backend in the oda config dir
+const (
+	secretsFileName  = "secrets.age"
+	identityFileName = "secrets.key"
+)
+
+// fileStore keeps secrets in an age encrypted yaml file, for systems
+// without a keyring
+type fileStore struct {
+	path     string
+	identity string
+}
+
+// newFileStore uses secrets.age in dir, identity defaults to secrets.key
+// next to it and is generated on the first secret set
+func newFileStore(dir, identity string) *fileStore {
+	if identity == "" {
+		identity = filepath.Join(dir, identityFileName)
+	}
+	return &fileStore{path: filepath.Join(dir, secretsFileName), identity: identity}
+}
+
+func (s *fileStore) Backend() string {
+	return BackendFile
+}
+
+func (s *fileStore) Get(name string) (string, error) {
+	secrets, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *fileStore) Set(name, value string) error {
+	secrets, err := s.read()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.write(secrets)
+}
+
+func (s *fileStore) Delete(name string) error {
+	secrets, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return ErrNotFound
+	}
+	delete(secrets, name)
+	return s.write(secrets)
+}
+
+func (s *fileStore) List() ([]string, error) {
+	secrets, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// read decrypts the secrets, a missing file holds none
+func (s *fileStore) read() (map[string]string, error) {
+	secrets := map[string]string{}
+	encrypted, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", s.path, err)
+	}
+	identity, err := s.loadIdentity(false)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(encrypted), identity)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s with %s: %w", s.path, s.identity, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s: %w", s.path, err)
+	}
+	if err := yaml.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("could not unmarshal %s: %w", s.path, err)
+	}
+	return secrets, nil
+}
+
+// write encrypts the secrets to the identity and replaces the file
+func (s *fileStore) write(secrets map[string]string) error {
+	identity, err := s.loadIdentity(true)
+	if err != nil {
+		return err
+	}
+	plain, err := yaml.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("could not marshal secrets: %w", err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	if err != nil {
+		return fmt.Errorf("could not encrypt secrets: %w", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		return fmt.Errorf("could not encrypt secrets: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not encrypt secrets: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, encrypted.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("could not write %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// loadIdentity reads the age identity, create generates a missing one
+func (s *fileStore) loadIdentity(create bool) (*age.X25519Identity, error) {
+	content, err := os.ReadFile(s.identity)
+	if os.IsNotExist(err) && create {
+		return s.generateIdentity()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read age identity %s: %w", s.identity, err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse age identity %s: %w", s.identity, err)
+	}
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			return x25519, nil
+		}
+	}
+	return nil, fmt.Errorf("no X25519 identity in %s", s.identity)
+}
+
+func (s *fileStore) generateIdentity() (*age.X25519Identity, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate age identity: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.identity), 0o700); err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", filepath.Dir(s.identity), err)
+	}
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), identity.Recipient(), identity)
+	if err := os.WriteFile(s.identity, []byte(content), 0o600); err != nil {
+		return nil, fmt.Errorf("could not write age identity %s: %w", s.identity, err)
+	}
+	return identity, nil
+}
@@ -0,0 +1,98 @@
+package secret
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService groups the oda secrets in the keyring
+const keyringService = "oda"
+
+// keyringIndex is the keyring entry listing the secret names, the
+// Secret Service api has no listing by service
+const keyringIndex = ".index"
+
+// keyringStore keeps secrets in the Secret Service over D-Bus, or the
+// keychain and credential manager on other systems
+type keyringStore struct{}
+
+func newKeyringStore() *keyringStore {
+	return &keyringStore{}
+}
+
+// keyringAvailable probes the keyring, a missing entry means it answered
+func keyringAvailable() bool {
+	_, err := keyring.Get(keyringService, keyringIndex)
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
+
+func (s *keyringStore) Backend() string {
+	return BackendKeyring
+}
+
+func (s *keyringStore) Get(name string) (string, error) {
+	value, err := keyring.Get(keyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (s *keyringStore) Set(name, value string) error {
+	if err := keyring.Set(keyringService, name, value); err != nil {
+		return err
+	}
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+	return s.writeIndex(append(names, name))
+}
+
+func (s *keyringStore) Delete(name string) error {
+	err := keyring.Delete(keyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+	kept := names[:0]
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return s.writeIndex(kept)
+}
+
+func (s *keyringStore) List() ([]string, error) {
+	index, err := keyring.Get(keyringService, keyringIndex)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(index), nil
+}
+
+func (s *keyringStore) writeIndex(names []string) error {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return keyring.Set(keyringService, keyringIndex, strings.Join(unique, "\n"))
+}
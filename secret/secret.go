@@ -0,0 +1,167 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scheme starts a reference to a secret in oda.yaml and .oda.yaml,
+// secret://db/password is the secret db/password
+const Scheme = "secret://"
+
+// backends of the secret store
+const (
+	BackendAuto    = "auto"
+	BackendKeyring = "keyring"
+	BackendFile    = "file"
+)
+
+// ErrNotFound is returned for a secret that is not in the store
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secrets by name
+type Store interface {
+	// Backend is the name of the backend holding the secrets
+	Backend() string
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	// List is the secret names, sorted
+	List() ([]string, error)
+}
+
+// Open opens the store of backend, secrets of the file backend are kept
+// in dir and decrypted with the age identity file, auto uses the keyring
+// when a Secret Service is running and the file otherwise
+func Open(backend, dir, identity string) (Store, error) {
+	switch backend {
+	case "", BackendAuto:
+		if keyringAvailable() {
+			return newKeyringStore(), nil
+		}
+		return newFileStore(dir, identity), nil
+	case BackendKeyring:
+		if !keyringAvailable() {
+			return nil, fmt.Errorf("no keyring available, is a Secret Service running?")
+		}
+		return newKeyringStore(), nil
+	case BackendFile:
+		return newFileStore(dir, identity), nil
+	}
+	return nil, fmt.Errorf("unknown secrets backend %s, use %s, %s or %s", backend, BackendAuto, BackendKeyring, BackendFile)
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*$`)
+
+// ValidateName checks a secret name, slash separated words like db/password
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q, use words separated by / like db/password", name)
+	}
+	return nil
+}
+
+// RefName is the secret a value refers to
+func RefName(value string) (string, bool) {
+	if !strings.HasPrefix(value, Scheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, Scheme), true
+}
+
+// Resolve is the secret a value refers to, other values are returned as
+// they are, the store is only opened for a reference
+func Resolve(value string, open func() (Store, error)) (string, error) {
+	name, ok := RefName(value)
+	if !ok {
+		return value, nil
+	}
+	store, err := open()
+	if err != nil {
+		return "", err
+	}
+	secretValue, err := store.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", value, err)
+	}
+	return secretValue, nil
+}
+
+// Refs are the references ResolveRefs replaced, by field path
+type Refs map[string]Ref
+
+// Ref is a reference and the secret it resolved to
+type Ref struct {
+	Ref   string
+	Value string
+}
+
+// ResolveRefs replaces the references in the string fields of v, a
+// pointer to a struct, and returns them for RestoreRefs
+func ResolveRefs(v any, open func() (Store, error)) (Refs, error) {
+	refs := Refs{}
+	var store Store
+	var err error
+	eachString(reflect.ValueOf(v).Elem(), "", func(path string, field reflect.Value) {
+		if err != nil || !strings.HasPrefix(field.String(), Scheme) {
+			return
+		}
+		if store == nil {
+			if store, err = open(); err != nil {
+				return
+			}
+		}
+		var value string
+		ref := field.String()
+		if value, err = Resolve(ref, func() (Store, error) { return store, nil }); err != nil {
+			return
+		}
+		refs[path] = Ref{Ref: ref, Value: value}
+		field.SetString(value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// RestoreRefs puts the references ResolveRefs replaced back into v, so
+// writing v out does not write the secrets, fields changed since keep
+// their new value
+func RestoreRefs(v any, refs Refs) {
+	eachString(reflect.ValueOf(v).Elem(), "", func(path string, field reflect.Value) {
+		if ref, ok := refs[path]; ok && field.String() == ref.Value {
+			field.SetString(ref.Ref)
+		}
+	})
+}
+
+// eachString calls fn with the path and value of every string in v,
+// walking structs, pointers and slices
+func eachString(v reflect.Value, path string, fn func(path string, field reflect.Value)) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			fn(path, v)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			eachString(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				eachString(v.Field(i), path+"."+t.Field(i).Name, fn)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			eachString(v.Index(i), path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	}
+}
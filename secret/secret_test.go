@@ -0,0 +1,152 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// exerciseStore runs the same set, get, list and delete steps on a store
+func exerciseStore(t *testing.T, store Store) {
+	t.Helper()
+	if _, err := store.Get("db/password"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing secret: %v", err)
+	}
+	for name, value := range map[string]string{"db/password": "s3cret", "github/token": "ghp_x"} {
+		if err := store.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Set("db/password", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("db/password"); err != nil || got != "changed" {
+		t.Errorf("get db/password = %q, %v", got, err)
+	}
+	if got, err := store.List(); err != nil || !reflect.DeepEqual(got, []string{"db/password", "github/token"}) {
+		t.Errorf("list = %v, %v", got, err)
+	}
+	if err := store.Delete("github/token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("github/token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete twice: %v", err)
+	}
+	if got, _ := store.List(); !reflect.DeepEqual(got, []string{"db/password"}) {
+		t.Errorf("list after delete = %v", got)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(BackendFile, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exerciseStore(t, store)
+
+	encrypted, err := os.ReadFile(filepath.Join(dir, secretsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("changed")) || !bytes.HasPrefix(encrypted, []byte("age-encryption.org/v1")) {
+		t.Error("secrets file is not age encrypted")
+	}
+	info, err := os.Stat(filepath.Join(dir, identityFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("identity mode %v, want 0600", info.Mode().Perm())
+	}
+
+	// another identity cannot read the secrets, and does not replace them
+	other := newFileStore(dir, filepath.Join(t.TempDir(), "other.key"))
+	if _, err := other.Get("db/password"); err == nil {
+		t.Error("read secrets without the identity file")
+	}
+	if err := other.Set("db/password", "x"); err == nil {
+		t.Error("overwrote secrets without the identity file")
+	}
+}
+
+func TestKeyringStore(t *testing.T) {
+	keyring.MockInit()
+	store, err := Open(BackendAuto, t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Backend() != BackendKeyring {
+		t.Fatalf("auto backend %s with a keyring", store.Backend())
+	}
+	exerciseStore(t, store)
+
+	keyring.MockInitWithError(errors.New("no dbus session"))
+	if store, _ := Open(BackendAuto, t.TempDir(), ""); store.Backend() != BackendFile {
+		t.Errorf("auto backend %s without a keyring", store.Backend())
+	}
+	if _, err := Open(BackendKeyring, t.TempDir(), ""); err == nil {
+		t.Error("opened the keyring without one")
+	}
+}
+
+func TestResolveRefs(t *testing.T) {
+	type addon struct{ Path string }
+	type conf struct {
+		Host     string
+		Password string
+		Addons   []addon
+		Port     int
+	}
+	store := newFileStore(t.TempDir(), "")
+	store.Set("db/password", "s3cret")
+	store.Set("addons/path", "/srv/addons")
+	opened := 0
+	open := func() (Store, error) { opened++; return store, nil }
+
+	c := &conf{Host: "db", Password: "secret://db/password", Addons: []addon{{Path: "secret://addons/path"}}}
+	refs, err := ResolveRefs(c, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "s3cret" || c.Addons[0].Path != "/srv/addons" || c.Host != "db" || opened != 1 {
+		t.Errorf("resolved %+v, store opened %d times", c, opened)
+	}
+
+	c.Host = "pg"
+	RestoreRefs(c, refs)
+	if c.Password != "secret://db/password" || c.Addons[0].Path != "secret://addons/path" || c.Host != "pg" {
+		t.Errorf("restored %+v", c)
+	}
+
+	if _, err := ResolveRefs(&conf{Host: "db"}, func() (Store, error) { return nil, errors.New("not opened") }); err != nil {
+		t.Errorf("store opened without references: %v", err)
+	}
+	missing := &conf{Password: "secret://db/missing"}
+	if _, err := ResolveRefs(missing, open); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing secret: %v", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"db/password":   true,
+		"github/token":  true,
+		"odoo/p1.admin": true,
+		"":              false,
+		"/db":           false,
+		"db/":           false,
+		"db//password":  false,
+		"db password":   false,
+		"../db":         false,
+	} {
+		if err := ValidateName(name); (err == nil) != valid {
+			t.Errorf("ValidateName(%q) = %v, want valid %v", name, err, valid)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package ui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+)
 
 // ========= Banner =========
 // func cText(color, msg string) string {
@@ -34,3 +37,23 @@ var WarningStyle = lipgloss.NewStyle().
 var ErrorStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.Color("#EE0000")).
 	Bold(true)
+
+// TableStyle is the bold header and striped rows of the list tables
+func TableStyle(row, col int) lipgloss.Style {
+	switch {
+	case row == table.HeaderRow:
+		return HeaderStyle
+	case row%2 == 0:
+		return EvenRowStyle
+	default:
+		return OddRowStyle
+	}
+}
+
+// NewTable is a list table with the oda border and TableStyle
+func NewTable() *table.Table {
+	return table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+		StyleFunc(TableStyle)
+}
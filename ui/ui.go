@@ -6,6 +6,16 @@ import (
 	"github.com/charmbracelet/huh"
 )
 
+// Confirm asks a single yes or no question
+func Confirm(prompt string) bool {
+	var confirm bool
+	huh.NewConfirm().
+		Title(prompt).
+		Value(&confirm).
+		Run()
+	return confirm
+}
+
 func AreYouSure(prompt string) bool {
 	var confirm1, confirm2 bool
 	huh.NewConfirm().